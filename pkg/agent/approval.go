@@ -0,0 +1,211 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/ardaguclu/kubectl-interact/pkg/audit"
+	"github.com/ardaguclu/kubectl-interact/pkg/policy"
+	"github.com/ardaguclu/kubectl-interact/pkg/tools"
+	"github.com/ardaguclu/kubectl-interact/pkg/ui"
+)
+
+// Approval decides the tool calls the policy asks confirmation for.
+type Approval string
+
+const (
+	// ApproveAsk asks the user.
+	ApproveAsk Approval = "ask"
+	// ApproveNever declines them, e.g. when there is no terminal to ask on.
+	ApproveNever Approval = "never"
+	// ApproveReads approves the read-only calls and declines the others.
+	ApproveReads Approval = "reads"
+	// ApproveAll approves them all.
+	ApproveAll Approval = "all"
+)
+
+// Approvals lists the supported approval modes.
+var Approvals = []Approval{ApproveAsk, ApproveNever, ApproveReads, ApproveAll}
+
+// ParseApproval validates the given approval mode.
+func ParseApproval(s string) (Approval, error) {
+	for _, a := range Approvals {
+		if string(a) == s {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("invalid approval mode %q, must be one of %v", s, Approvals)
+}
+
+// autoApprove decides a tool call the policy asks confirmation for without asking the user.
+// It returns false as second value if the user is to be asked. Calls running kubectl in a way which
+// can not be resolved are never approved, as what they do is unknown.
+func (c *Conversation) autoApprove(call *tools.ToolCall) (approved bool, decided bool) {
+	switch c.Approve {
+	case ApproveNever:
+		return false, true
+	case ApproveReads:
+		return call.Classification() == tools.ReadOnly && !unresolvedKubectl(call), true
+	case ApproveAll:
+		return !unresolvedKubectl(call), true
+	}
+	return false, false
+}
+
+// unresolvedKubectl returns true if the command of the tool call mentions kubectl in a stage which was not
+// resolved to a kubectl invocation, e.g. `$KUBECTL delete ns prod` or `bash -c "$SCRIPT"`.
+func unresolvedKubectl(call *tools.ToolCall) bool {
+	if call.Command() == nil {
+		return false
+	}
+	for _, stage := range call.Command().Stages {
+		if unresolvedStage(stage) {
+			return true
+		}
+	}
+	return false
+}
+
+func unresolvedStage(stage *tools.Stage) bool {
+	return stage.Kubectl == nil && stage.Script == "" && !stage.IsTextFilter() && strings.Contains(stage.Raw, "kubectl")
+}
+
+func (c *Conversation) policy() *policy.Policy {
+	if c.Policy == nil {
+		return policy.Default()
+	}
+	return c.Policy
+}
+
+// readOnlyToolRule approves the calls of structured tools which can not modify the cluster,
+// such as get_resources, when no policy rule matched them.
+var readOnlyToolRule = &policy.Rule{Name: "read-only-tool", Action: policy.ActionAllow}
+
+// decide evaluates the policy for the tool call.
+func (c *Conversation) decide(call *tools.ToolCall) policy.Decision {
+	decision := c.policy().EvaluateAll(c.policyRequests(call))
+	if decision.Rule == nil && decision.Action == policy.ActionAsk && call.Command() == nil && call.Classification() == tools.ReadOnly {
+		return policy.Decision{Action: policy.ActionAllow, Rule: readOnlyToolRule}
+	}
+	return decision
+}
+
+// policyRequests describes the tool call for the policy engine, one request per kubectl invocation
+// and one for the other programs it runs, text filters such as grep excepted.
+func (c *Conversation) policyRequests(call *tools.ToolCall) []policy.Request {
+	command := call.Command()
+	if command == nil {
+		req := policy.Request{Tool: call.Name(), Namespace: c.Namespace, Context: c.KubeContext, Classification: string(call.Classification())}
+		// structured tools take the resource type and namespace as arguments
+		// the arguments are read as the tools read them, so that the policy sees what the tool will do
+		if kind := call.StringArgument("kind"); kind != "" {
+			req.Resources = []string{kind}
+		}
+		if namespace := call.StringArgument("namespace"); namespace != "" {
+			req.Namespace = namespace
+		}
+		if call.BoolArgument("all_namespaces") {
+			req.Namespace = policy.AllNamespaces
+		}
+		return []policy.Request{req}
+	}
+
+	var reqs []policy.Request
+	for _, stage := range command.Stages {
+		k := stage.Kubectl
+		if k == nil {
+			// the stages of the scripts run by shells are evaluated on their own
+			if !stage.IsTextFilter() && stage.Script == "" {
+				reqs = append(reqs, policy.Request{
+					Tool: call.Name(), Namespace: c.Namespace, Context: c.KubeContext, Classification: string(stage.Classification()),
+					Unresolved: unresolvedStage(stage),
+				})
+			}
+			continue
+		}
+
+		req := policy.Request{
+			Tool:      call.Name(),
+			Verb:      k.Verb,
+			Resources: k.Resources,
+			Namespace: k.Namespace,
+			Context:   k.Context,
+
+			Classification: string(k.Classification()),
+		}
+		if req.Namespace == "" {
+			req.Namespace = c.Namespace
+		}
+		if k.AllNamespaces {
+			req.Namespace = policy.AllNamespaces
+		}
+		if req.Context == "" {
+			req.Context = c.KubeContext
+		}
+		reqs = append(reqs, req)
+	}
+	if len(reqs) == 0 {
+		reqs = append(reqs, policy.Request{Tool: call.Name(), Namespace: c.Namespace, Context: c.KubeContext, Classification: string(command.Classification())})
+	}
+	return reqs
+}
+
+// functionCallRequestBlock renders the tool call along with its verified classification,
+// warning if it disagrees with the LLM's claim.
+func (c *Conversation) functionCallRequestBlock(call *tools.ToolCall, text string) *ui.FunctionCallRequestBlock {
+	block := ui.NewFunctionCallRequestBlock().SetText(text, c.streams).SetCall(uiToolCall(call), c.streams)
+	if mismatch := call.ClassificationMismatch(); mismatch != "" {
+		klog.Warningf("classification mismatch for %q: %s", call.PrettyPrint(), mismatch)
+		block.SetWarning(mismatch, c.streams)
+	}
+	return block
+}
+
+// uiToolCall describes the tool call for the UIs rendering it as structured data.
+func uiToolCall(call *tools.ToolCall) *ui.ToolCall {
+	return &ui.ToolCall{
+		ID:             call.ID(),
+		Name:           call.Name(),
+		Arguments:      call.Arguments(),
+		Command:        call.PrettyPrint(),
+		Classification: string(call.Classification()),
+	}
+}
+
+// showResult reports the outcome of the tool call along with how it was decided.
+func (c *Conversation) showResult(call *tools.ToolCall, decision audit.Decision, approval string, result map[string]any) {
+	c.doc.AddBlock(ui.NewFunctionCallResultBlock().SetResult(uiToolCall(call), string(decision), approval, result, c.streams), c.streams)
+}
+
+// ranDecision returns how a tool call which ran was decided.
+func ranDecision(decision policy.Decision) audit.Decision {
+	if decision.Action == policy.ActionAllow {
+		return audit.DecisionAllowed
+	}
+	return audit.DecisionApproved
+}
+
+// showPreview renders the expected effect of a mutating tool call before asking for confirmation.
+func (c *Conversation) showPreview(preview *tools.Preview) {
+	switch {
+	case preview.Error != "":
+		c.doc.AddBlock(ui.NewErrorBlock().SetText(fmt.Sprintf("  Server-side dry-run failed: %s\n", preview.Error), c.streams), c.streams)
+	case preview.Diff == "":
+		c.doc.AddBlock(ui.NewAgentTextBlock().SetText("  The server-side dry-run reports no changes.", c.streams), c.streams)
+	default:
+		c.doc.AddBlock(ui.NewDiffBlock().SetDiff("Expected changes (server-side dry-run):", preview.Diff, c.streams), c.streams)
+	}
+}
+
+// approvalSummary describes for the LLM how the tool call was approved.
+func (c *Conversation) approvalSummary(decision policy.Decision) string {
+	if decision.Action == policy.ActionAllow {
+		return fmt.Sprintf("allowed by policy rule %q", decision.RuleName())
+	}
+	if c.Approve != ApproveAsk {
+		return fmt.Sprintf("approved by approval mode %q, policy rule %q asked for confirmation", c.Approve, decision.RuleName())
+	}
+	return fmt.Sprintf("approved by the user, policy rule %q asked for confirmation", decision.RuleName())
+}
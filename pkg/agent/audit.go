@@ -0,0 +1,174 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"k8s.io/klog/v2"
+
+	"github.com/ardaguclu/kubectl-interact/pkg/audit"
+	"github.com/ardaguclu/kubectl-interact/pkg/policy"
+	"github.com/ardaguclu/kubectl-interact/pkg/redact"
+	"github.com/ardaguclu/kubectl-interact/pkg/snapshot"
+	"github.com/ardaguclu/kubectl-interact/pkg/tools"
+)
+
+// auditRequest records the tool call and how it was approved or rejected, with the command and the arguments
+// redacted the same way as the output.
+func (c *Conversation) auditRequest(call *tools.ToolCall, d audit.Decision, decision policy.Decision) {
+	if c.Audit == nil {
+		return
+	}
+	ev := call.RequestEvent()
+	contexts, namespaces := c.targets(call)
+	e := audit.Entry{
+		Type:           audit.EntryRequest,
+		CallID:         ev.CallID,
+		Context:        contexts,
+		Namespace:      namespaces,
+		Tool:           ev.Name,
+		Command:        call.PrettyPrint(),
+		Arguments:      ev.Arguments,
+		Classification: string(call.Classification()),
+		Decision:       d,
+		Rule:           decision.RuleName(),
+	}
+	c.writeRequest(e)
+}
+
+// auditRollback records the rollback of the snapshot and whether the user confirmed it, it returns the call ID
+// of the rollback for auditRollbackResponse.
+func (c *Conversation) auditRollback(snap *snapshot.Snapshot, d audit.Decision) string {
+	if c.Audit == nil {
+		return ""
+	}
+	kubeContext := snap.Context
+	if kubeContext == "" {
+		kubeContext = c.KubeContext
+	}
+	var namespaces, objects []string
+	for _, ref := range snap.Refs() {
+		if ref.Namespace != "" && !slices.Contains(namespaces, ref.Namespace) {
+			namespaces = append(namespaces, ref.Namespace)
+		}
+		objects = append(objects, ref.String())
+	}
+	e := audit.Entry{
+		Type:           audit.EntryRequest,
+		CallID:         uuid.NewString(),
+		Context:        kubeContext,
+		Namespace:      strings.Join(namespaces, ","),
+		Tool:           "rollback",
+		Command:        "rollback " + snap.Command,
+		Classification: string(tools.Mutating),
+		Decision:       d,
+		RollbackOf:     snap.CallID,
+		Objects:        objects,
+	}
+	c.writeRequest(e)
+	return e.CallID
+}
+
+// writeRequest writes the request entry with the command and the arguments redacted.
+func (c *Conversation) writeRequest(e audit.Entry) {
+	if c.Redactor != nil {
+		e.Command = c.Redactor.Text(e.Command, redact.Report{})
+		// the arguments are the ones of the call, they are copied rather than redacted in place
+		arguments := e.Arguments
+		e.Arguments = map[string]any{}
+		for name, value := range arguments {
+			if s, ok := value.(string); ok {
+				value = c.Redactor.Text(s, redact.Report{})
+			}
+			e.Arguments[name] = value
+		}
+	}
+	c.writeAudit(e)
+}
+
+// auditResponse records the outcome of the tool call, with the output redacted the same way as for the LLM.
+func (c *Conversation) auditResponse(call *tools.ToolCall, ev tools.ToolResponseEvent) {
+	if c.Audit == nil {
+		return
+	}
+	contexts, namespaces := c.targets(call)
+	e := audit.Entry{
+		Type:      audit.EntryResponse,
+		CallID:    ev.CallID,
+		Context:   contexts,
+		Namespace: namespaces,
+		Duration:  ev.Duration,
+		Error:     ev.Error,
+	}
+	c.writeResponse(e, c.maskSecretValues(call, ev.Response, redact.Report{}))
+}
+
+// auditRollbackResponse records the outcome of the rollback audited with the call ID.
+func (c *Conversation) auditRollbackResponse(callID string, result *tools.ExecResult, duration time.Duration, err error) {
+	if c.Audit == nil {
+		return
+	}
+	e := audit.Entry{
+		Type:     audit.EntryResponse,
+		CallID:   callID,
+		Duration: duration,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	c.writeResponse(e, result)
+}
+
+// writeResponse writes the response entry with the outcome of the call, the output redacted the same way as for the LLM.
+func (c *Conversation) writeResponse(e audit.Entry, response any) {
+	switch response := response.(type) {
+	case *tools.ExecResult:
+		if response == nil {
+			break
+		}
+		exitCode := response.ExitCode
+		e.ExitCode = &exitCode
+		e.Output = response.Stdout + response.Stderr
+		if response.Error != "" && e.Error == "" {
+			e.Error = response.Error
+		}
+	case nil:
+	default:
+		e.Output = fmt.Sprint(response)
+		// the results of the structured tools are redacted as objects, e.g. the Secrets of get_resources
+		if m, err := tools.ToolResultToMap(response); err == nil && c.Redactor != nil {
+			c.Redactor.Value(m, redact.Report{})
+			if b, err := json.Marshal(m); err == nil {
+				e.Output = string(b)
+			}
+		}
+	}
+	if c.Redactor != nil {
+		e.Output = c.Redactor.Text(e.Output, redact.Report{})
+	}
+	c.writeAudit(e)
+}
+
+func (c *Conversation) writeAudit(e audit.Entry) {
+	if err := c.Audit.Write(e); err != nil {
+		klog.Warningf("error writing audit log: %v", err)
+	}
+}
+
+// targets returns the kube contexts and namespaces the tool call targets, comma separated.
+func (c *Conversation) targets(call *tools.ToolCall) (string, string) {
+	var contexts, namespaces []string
+	for _, req := range c.policyRequests(call) {
+		if !slices.Contains(contexts, req.Context) {
+			contexts = append(contexts, req.Context)
+		}
+		if !slices.Contains(namespaces, req.Namespace) {
+			namespaces = append(namespaces, req.Namespace)
+		}
+	}
+	return strings.Join(contexts, ","), strings.Join(namespaces, ",")
+}
@@ -0,0 +1,213 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/kubectl-ai/gollm"
+	"k8s.io/klog/v2"
+
+	providers "github.com/ardaguclu/kubectl-interact/pkg/providers"
+	"github.com/ardaguclu/kubectl-interact/pkg/tools"
+	"github.com/ardaguclu/kubectl-interact/pkg/ui"
+	"github.com/ardaguclu/kubectl-interact/pkg/usage"
+)
+
+// DefaultContextLimit is the context window assumed for models which do not report theirs.
+const DefaultContextLimit = 32768
+
+const (
+	// compactThreshold is the share of the context limit above which the history is compacted.
+	compactThreshold = 0.8
+
+	// compactTarget is the share of the context limit the history is compacted down to.
+	compactTarget = 0.5
+
+	// recentMessages is the number of most recent messages of the history which are never compacted.
+	recentMessages = 6
+
+	// minCompactTokens is the size of the tool outputs below which they are not worth summarizing.
+	minCompactTokens = 256
+
+	// messageOverhead approximates the tokens of the role and the separators of a message.
+	messageOverhead = 4
+
+	// toolResultPrefix starts the observations of the tool calls which ran.
+	toolResultPrefix = "Result of running"
+
+	// compactedPrefix starts the tool outputs which were compacted.
+	compactedPrefix = "[Compacted to fit the context window]"
+)
+
+const summaryPrompt = `Summarize the following output of a tool call made while operating a Kubernetes cluster.
+Keep the command, the names and namespaces of the resources, their statuses, counts, error messages and anything
+unusual, drop what is repeated or irrelevant. Answer with the summary only, in at most 15 lines.
+
+Output:
+%s`
+
+// messageTokens approximates the tokens a message takes in the context window.
+func messageTokens(content string) int {
+	return usage.EstimateTokens(content) + messageOverhead
+}
+
+// contentTokens approximates the tokens of the contents about to be sent to the LLM.
+func contentTokens(contents []any) int {
+	tokens := 0
+	for _, content := range contents {
+		switch c := content.(type) {
+		case string:
+			tokens += messageTokens(c)
+		case gollm.FunctionCallResult:
+			b, _ := json.Marshal(c.Result)
+			tokens += messageTokens(string(b))
+		}
+	}
+	return tokens
+}
+
+// contextTokens approximates the tokens of the history, zero if the provider does not expose it.
+func (c *Conversation) contextTokens() int {
+	if c.history == nil {
+		return 0
+	}
+	tokens := 0
+	for _, m := range c.history.History() {
+		tokens += messageTokens(m.Content)
+	}
+	return tokens
+}
+
+// isObservation returns true for the messages reporting the output of a tool call which was not compacted yet.
+// The ReAct shim reports them in user messages.
+func isObservation(m providers.Message) bool {
+	switch m.Role {
+	case "tool":
+		return !strings.HasPrefix(m.Content, compactedPrefix)
+	case "user":
+		return strings.HasPrefix(m.Content, toolResultPrefix)
+	}
+	return false
+}
+
+// compactHistory replaces the oldest tool outputs of the history with summaries once the history and the contents
+// about to be sent near the context limit, and drops the oldest outputs too short to summarize if that is not
+// enough. The system prompt, the queries, the answers of the LLM and the most recent messages are kept as they are.
+func (c *Conversation) compactHistory(ctx context.Context, pending []any) {
+	if c.history == nil || c.ContextLimit <= 0 {
+		return
+	}
+	messages := c.history.History()
+	tokens := make([]int, len(messages))
+	total := contentTokens(pending)
+	for i, m := range messages {
+		tokens[i] = messageTokens(m.Content)
+		total += tokens[i]
+	}
+	if total < int(float64(c.ContextLimit)*compactThreshold) {
+		return
+	}
+	klog.Infof("compacting the history of ~%d tokens, the context limit is %d tokens", total, c.ContextLimit)
+
+	target := int(float64(c.ContextLimit) * compactTarget)
+	before := total
+	compacted, trimmed, dropped := 0, 0, 0
+	done := make([]bool, len(messages))
+	var status *ui.StatusBlock
+	for i := 0; i < len(messages)-recentMessages && total > target; i++ {
+		if !isObservation(messages[i]) || tokens[i] < minCompactTokens {
+			continue
+		}
+		if status == nil {
+			status = ui.NewStatusBlock()
+			c.doc.AddBlock(status, c.streams)
+			defer status.SetText("", c.streams)
+		}
+		status.SetText(fmt.Sprintf("  Summarizing earlier tool outputs to fit the context window (%d done)...", compacted), c.streams)
+
+		content := fmt.Sprintf("%s Summary of a tool output of about %d tokens:\n", compactedPrefix, tokens[i])
+		summary, err := c.summarize(ctx, messages[i].Content)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			klog.Warningf("error summarizing message %d of the history, trimming it instead: %v", i, err)
+			content = fmt.Sprintf("%s Excerpt of a tool output of about %d tokens:\n", compactedPrefix, tokens[i])
+			summary = tools.Excerpt(messages[i].Content, 2000)
+			trimmed++
+		}
+		content += summary
+		if err := c.history.ReplaceContent(i, content); err != nil {
+			klog.Warningf("error compacting message %d of the history: %v", i, err)
+			continue
+		}
+		compacted++
+		done[i] = true
+		total += messageTokens(content) - tokens[i]
+	}
+
+	// the outputs too small to be worth summarizing are dropped, oldest first, when summarizing the others
+	// was not enough
+	for i := 0; i < len(messages)-recentMessages && total > target; i++ {
+		if !isObservation(messages[i]) || done[i] {
+			continue
+		}
+		content := fmt.Sprintf("%s A tool output of about %d tokens was dropped, run the tool call again if it is still needed.", compactedPrefix, tokens[i])
+		if messageTokens(content) >= tokens[i] {
+			continue
+		}
+		if err := c.history.ReplaceContent(i, content); err != nil {
+			klog.Warningf("error compacting message %d of the history: %v", i, err)
+			continue
+		}
+		compacted++
+		dropped++
+		total += messageTokens(content) - tokens[i]
+	}
+
+	if compacted == 0 {
+		if c.contextFullNoticed {
+			return
+		}
+		c.contextFullNoticed = true
+		c.doc.AddBlock(ui.NewNoticeBlock().SetText(fmt.Sprintf("  The conversation (~%d tokens) nears the context window of %d tokens and has no earlier tool output left to compact, use 'reset' to start over.\n", total, c.ContextLimit), c.streams), c.streams)
+		return
+	}
+	c.contextFullNoticed = false
+	text := fmt.Sprintf("  Compacted %d earlier tool outputs to fit the context window: ~%d -> ~%d of %d tokens", compacted, before, total, c.ContextLimit)
+	if trimmed > 0 {
+		text += fmt.Sprintf(", %d of them trimmed as they could not be summarized", trimmed)
+	}
+	if dropped > 0 {
+		text += fmt.Sprintf(", %d of them dropped as they were too short to summarize", dropped)
+	}
+	c.doc.AddBlock(ui.NewNoticeBlock().SetText(text+".\n", c.streams), c.streams)
+}
+
+// summarize asks the LLM to summarize a tool output, outside of the chat.
+func (c *Conversation) summarize(ctx context.Context, content string) (string, error) {
+	// leave room for the summary in the context window
+	content = tools.Excerpt(content, c.ContextLimit*2)
+	llm := c.SummaryLLM
+	if llm == nil {
+		llm = c.LLM
+	}
+	resp, err := llm.GenerateCompletion(ctx, &gollm.CompletionRequest{
+		Model:  c.Model,
+		Prompt: fmt.Sprintf(summaryPrompt, content),
+	})
+	if err != nil {
+		return "", err
+	}
+	if u, ok := usage.FromMetadata(resp.UsageMetadata()); ok {
+		reporter, _ := resp.(providers.ModelReporter)
+		c.addUsage(reporter, u)
+	}
+	summary := strings.TrimSpace(resp.Response())
+	if summary == "" {
+		return "", fmt.Errorf("the summary is empty")
+	}
+	return summary, nil
+}
@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+
+	providers "github.com/ardaguclu/kubectl-interact/pkg/providers"
+	"github.com/ardaguclu/kubectl-interact/pkg/ui"
+)
+
+// fakeHistory is a history which can be compacted.
+type fakeHistory struct {
+	messages []providers.Message
+}
+
+func (h *fakeHistory) History() []providers.Message {
+	return append([]providers.Message(nil), h.messages...)
+}
+
+func (h *fakeHistory) ReplaceContent(i int, content string) error {
+	h.messages[i].Content = content
+	return nil
+}
+
+// TestCompactHistoryShortOutputs checks that the history is compacted when it consists of many tool outputs
+// too short to be summarized, the oldest are dropped and the recent messages are left untouched.
+func TestCompactHistoryShortOutputs(t *testing.T) {
+	history := &fakeHistory{messages: []providers.Message{{Role: "system", Content: "You are a Kubernetes assistant."}}}
+	for i := 0; i < 10; i++ {
+		output := fmt.Sprintf("%s kubectl get pod web-%d: ", toolResultPrefix, i) + strings.Repeat("Running ", 50)
+		history.messages = append(history.messages, providers.Message{Role: "user", Content: output})
+	}
+	original := history.History()
+
+	streams, _, _, _ := genericiooptions.NewTestIOStreams()
+	c := &Conversation{ContextLimit: 1000, history: history, doc: ui.NewDocument(streams), streams: streams}
+	if c.contextTokens() < int(float64(c.ContextLimit)*compactThreshold) {
+		t.Fatalf("the history of ~%d tokens is not compacted with a context limit of %d tokens", c.contextTokens(), c.ContextLimit)
+	}
+	// the outputs are too short to be summarized, the LLM is not set as it must not be asked
+	c.compactHistory(context.Background(), nil)
+
+	recent := len(original) - recentMessages
+	for i, m := range history.messages {
+		switch {
+		case i == 0 || i >= recent:
+			if m.Content != original[i].Content {
+				t.Errorf("message %d = %q, want it untouched", i, m.Content)
+			}
+		case !strings.HasPrefix(m.Content, compactedPrefix):
+			t.Errorf("message %d = %q, want it dropped", i, m.Content)
+		}
+	}
+}
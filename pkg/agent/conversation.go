@@ -31,8 +31,14 @@ import (
 	"github.com/GoogleCloudPlatform/kubectl-ai/gollm"
 	"k8s.io/klog/v2"
 
+	"github.com/ardaguclu/kubectl-interact/pkg/audit"
+	"github.com/ardaguclu/kubectl-interact/pkg/policy"
+	providers "github.com/ardaguclu/kubectl-interact/pkg/providers"
+	"github.com/ardaguclu/kubectl-interact/pkg/redact"
+	"github.com/ardaguclu/kubectl-interact/pkg/snapshot"
 	"github.com/ardaguclu/kubectl-interact/pkg/tools"
 	"github.com/ardaguclu/kubectl-interact/pkg/ui"
+	"github.com/ardaguclu/kubectl-interact/pkg/usage"
 )
 
 //go:embed systemprompt_template_default.txt
@@ -43,15 +49,80 @@ type Conversation struct {
 
 	Model string
 
+	// SummaryLLM summarizes tool outputs to fit the context window, LLM is used if nil.
+	SummaryLLM gollm.Client
+
 	Tools tools.Tools
 
 	Kubeconfig string
 
+	// KubeContext is the current context of the kubeconfig.
+	KubeContext string
+
+	// Namespace is the namespace of the current context.
+	Namespace string
+
+	// Policy decides which tool calls run without confirmation, asks for every call if nil.
+	Policy *policy.Policy
+
+	// Approve decides the tool calls the policy asks confirmation for, the user is asked if empty.
+	Approve Approval
+
+	// ToolMode selects between native function calling and the ReAct shim.
+	// It is expected to be resolved already, ToolModeAuto is treated as ToolModeShim.
+	ToolMode ToolMode
+
+	// ToolTimeout bounds the execution of a single tool call, no timeout if zero.
+	ToolTimeout time.Duration
+
+	// Snapshots stores the objects affected by mutating tool calls before they run, no snapshots are taken if nil.
+	Snapshots *snapshot.Store
+
+	// Redactor masks secrets and credentials in tool output before it is sent to the LLM, the output is sent as is if nil.
+	Redactor *redact.Redactor
+
+	// Retry configures the retries of failed requests to the LLM, DefaultRetryConfig is used if MaxAttempts is zero.
+	Retry gollm.RetryConfig
+
+	// Audit records the tool calls, their approval and their outcome, nothing is recorded if nil.
+	Audit *audit.Log
+
+	// Prices estimates the cost of the tokens used by the session, no cost is shown if nil.
+	Prices *usage.Prices
+
+	// TokenBudget stops the conversation once the session used as many tokens, no limit if zero.
+	TokenBudget int
+
+	// MaxToolOutput is the size in bytes above which command outputs are truncated before they are sent to the LLM,
+	// they are sent whole if zero.
+	MaxToolOutput int
+
+	// ContextLimit is the number of tokens of the context window of the model. Earlier tool outputs are
+	// summarized as the history nears it, the history is never compacted if zero.
+	ContextLimit int
+
+	// usage is the token usage of the session, it is kept across resets
+	usage usage.Usage
+
+	// usageByModel is the token usage of the session by model, the endpoints serving the requests may use
+	// different models
+	usageByModel map[string]usage.Usage
+
+	// servedModel tells the model which served the last request of llmChat, nil if the chat does not tell it
+	servedModel providers.ModelReporter
+
 	// doc is the document which renders the conversation
 	doc *ui.Document
 
 	llmChat gollm.Chat
 
+	// history gives access to the history of llmChat, nil if the provider does not expose it
+	history providers.HistoryEditor
+
+	// contextFullNoticed is set once the user was told that the history nears the context window and can not be
+	// compacted, so that it is told once per turn until the history is compacted or reset
+	contextFullNoticed bool
+
 	workDir string
 
 	streams genericiooptions.IOStreams
@@ -65,23 +136,22 @@ func (s *Conversation) Init(ctx context.Context, doc *ui.Document, streams gener
 	}
 
 	systemPrompt, err := s.generatePrompt(ctx, PromptData{
-		Tools: s.Tools,
+		Tools:             s.Tools,
+		EnableToolUseShim: s.enableToolUseShim(),
 	})
 	if err != nil {
 		return fmt.Errorf("generating system prompt: %w", err)
 	}
 
 	// Start a new chat session
-	s.llmChat = gollm.NewRetryChat(
-		s.LLM.StartChat(systemPrompt, s.Model),
-		gollm.RetryConfig{
-			MaxAttempts:    3,
-			InitialBackoff: 10 * time.Second,
-			MaxBackoff:     60 * time.Second,
-			BackoffFactor:  2,
-			Jitter:         true,
-		},
-	)
+	chat := s.LLM.StartChat(systemPrompt, s.Model)
+	s.history, _ = chat.(providers.HistoryEditor)
+	s.contextFullNoticed = false
+	s.servedModel, _ = chat.(providers.ModelReporter)
+	if f, ok := chat.(providers.FallbackChat); ok {
+		f.SetFallbackHandler(s.showFallback)
+	}
+	s.llmChat = s.newRetryChat(chat)
 
 	var functionDefinitions []*gollm.FunctionDefinition
 	for _, tool := range s.Tools.AllTools() {
@@ -102,6 +172,12 @@ func (s *Conversation) Init(ctx context.Context, doc *ui.Document, streams gener
 	return nil
 }
 
+// enableToolUseShim returns true if function calls are parsed from the ReAct JSON block
+// instead of the provider's native function calling.
+func (c *Conversation) enableToolUseShim() bool {
+	return c.ToolMode != ToolModeNative
+}
+
 func (c *Conversation) Close() error {
 	if c.workDir != "" {
 		if err := os.RemoveAll(c.workDir); err != nil {
@@ -118,7 +194,16 @@ func (c *Conversation) RunOneRound(ctx context.Context, query string) error {
 	currentIteration := 0
 	maxIterations := 20
 
+	var turn usage.Usage
+	defer c.showTurnUsage(&turn)
+	c.contextFullNoticed = false
+
 	for currentIteration < maxIterations {
+		if c.budgetExhausted() {
+			return nil
+		}
+		c.compactHistory(ctx, currChatContent)
+
 		stream, err := c.llmChat.SendStreaming(ctx, currChatContent...)
 		if err != nil {
 			return err
@@ -127,18 +212,22 @@ func (c *Conversation) RunOneRound(ctx context.Context, query string) error {
 		// Clear our "response" now that we sent the last response
 		currChatContent = nil
 
-		// convert the candidate response into a gollm.ChatResponse
-		stream, err = candidateToShimCandidate(stream)
-		if err != nil {
-			return err
+		if c.enableToolUseShim() {
+			// convert the candidate response into a gollm.ChatResponse
+			stream, err = candidateToShimCandidate(stream)
+			if err != nil {
+				return err
+			}
 		}
 
 		// Process each part of the response
-		// only applicable is not using tooluse shim
 		var functionCalls []gollm.FunctionCall
 
 		var agentTextBlock *ui.AgentTextBlock
 
+		// usageMetadata is the last usage reported in the stream, usually along with the last response
+		var usageMetadata any
+
 		for response, err := range stream {
 			if err != nil {
 				return fmt.Errorf("reading streaming LLM response: %w", err)
@@ -148,6 +237,9 @@ func (c *Conversation) RunOneRound(ctx context.Context, query string) error {
 				break
 			}
 			klog.Infof("response: %+v", response)
+			if metadata := response.UsageMetadata(); metadata != nil {
+				usageMetadata = metadata
+			}
 
 			if len(response.Candidates()) == 0 {
 				return fmt.Errorf("no candidates in LLM response")
@@ -176,6 +268,10 @@ func (c *Conversation) RunOneRound(ctx context.Context, query string) error {
 		if agentTextBlock != nil {
 			agentTextBlock.SetStreaming(false, c.streams)
 		}
+		if u, ok := usage.FromMetadata(usageMetadata); ok {
+			turn.Add(u)
+			c.addUsage(c.servedModel, u)
+		}
 
 		// TODO(droot): Run all function calls in parallel
 		// (may have to specify in the prompt to make these function calls independent)
@@ -186,50 +282,107 @@ func (c *Conversation) RunOneRound(ctx context.Context, query string) error {
 			}
 
 			s := toolCall.PrettyPrint()
-			c.doc.AddBlock(ui.NewFunctionCallRequestBlock().SetText(fmt.Sprintf("  Running: %s\n", s), c.streams), c.streams)
-			confirmationPrompt := `  Do you want to proceed ?
+			classification := toolCall.Classification()
+			decision := c.decide(toolCall)
+			klog.V(1).Infof("policy decision for %q: %s", s, decision)
+
+			switch decision.Action {
+			case policy.ActionDeny:
+				c.doc.AddBlock(c.functionCallRequestBlock(toolCall, fmt.Sprintf("  Running: %s (%s)\n", s, classification)), c.streams)
+				c.doc.AddBlock(ui.NewErrorBlock().SetText(fmt.Sprintf("  Denied by policy rule %q.\n", decision.RuleName()), c.streams), c.streams)
+				c.auditRequest(toolCall, audit.DecisionDenied, decision)
+				observation := fmt.Sprintf("Running %q was denied by policy rule %q, do not retry it.\n", s, decision.RuleName())
+				c.showResult(toolCall, audit.DecisionDenied, fmt.Sprintf("denied by policy rule %q", decision.RuleName()), map[string]any{"error": observation})
+				currChatContent = append(currChatContent, c.toolObservation(call, observation, map[string]any{"error": observation}))
+				continue
+			case policy.ActionAllow:
+				c.doc.AddBlock(c.functionCallRequestBlock(toolCall, fmt.Sprintf("  Running: %s (%s, allowed by policy rule %q)\n", s, classification, decision.RuleName())), c.streams)
+				c.auditRequest(toolCall, audit.DecisionAllowed, decision)
+				c.noticeUnsnapshottable(toolCall)
+			default:
+				c.doc.AddBlock(c.functionCallRequestBlock(toolCall, fmt.Sprintf("  Running: %s (%s)\n", s, classification)), c.streams)
+				approved, decided := c.autoApprove(toolCall)
+				if decided && !approved {
+					c.doc.AddBlock(ui.NewNoticeBlock().SetText(fmt.Sprintf("  Declined by approval mode %q, policy rule %q asked for confirmation.\n", c.Approve, decision.RuleName()), c.streams), c.streams)
+					c.auditRequest(toolCall, audit.DecisionDeclined, decision)
+					reason := fmt.Sprintf("%s calls", classification)
+					if unresolvedKubectl(toolCall) {
+						reason = "calls running kubectl through variables or unparsed scripts"
+					}
+					observation := fmt.Sprintf("Running %q was declined, policy rule %q asked for confirmation and approval mode %q does not approve %s. Do not retry it, answer with what you found so far.\n", s, decision.RuleName(), c.Approve, reason)
+					c.showResult(toolCall, audit.DecisionDeclined, fmt.Sprintf("declined by approval mode %q", c.Approve), map[string]any{"error": observation})
+					currChatContent = append(currChatContent, c.toolObservation(call, observation, map[string]any{"error": observation}))
+					continue
+				}
+				c.noticeUnsnapshottable(toolCall)
+				if preview := toolCall.Preview(ctx, c.invokeToolOptions()); preview != nil {
+					c.showPreview(preview)
+				}
+				if decided {
+					c.auditRequest(toolCall, audit.DecisionApproved, decision)
+					break
+				}
+				confirmationPrompt := `  Do you want to proceed ?
   1) Yes
   2) No`
 
-			optionsBlock := ui.NewInputOptionBlock().SetPrompt(confirmationPrompt)
-			optionsBlock.SetOptions([]string{"1", "2"})
-			c.doc.AddBlock(optionsBlock, c.streams)
+				optionsBlock := ui.NewInputOptionBlock().SetPrompt(confirmationPrompt)
+				optionsBlock.SetOptions([]string{"1", "2"})
+				c.doc.AddBlock(optionsBlock, c.streams)
+
+				selectedChoice, err := optionsBlock.Observable().Wait()
+				if err != nil {
+					if err == io.EOF {
+						// Use hit control-D, or was piping and we reached the end of stdin.
+						// Not a "big" problem
+						c.auditRequest(toolCall, audit.DecisionDeclined, decision)
+						return nil
+					}
+					return fmt.Errorf("reading input: %w", err)
+				}
 
-			selectedChoice, err := optionsBlock.Observable().Wait()
-			if err != nil {
-				if err == io.EOF {
-					// Use hit control-D, or was piping and we reached the end of stdin.
-					// Not a "big" problem
-					return nil
+				switch selectedChoice {
+				case "1":
+					// Proceed with the operation
+					c.auditRequest(toolCall, audit.DecisionApproved, decision)
+				case "2":
+					c.doc.AddBlock(ui.NewAgentTextBlock().SetText("Operation was skipped.", c.streams), c.streams)
+					c.auditRequest(toolCall, audit.DecisionDeclined, decision)
+					observation := fmt.Sprintf("User didn't approve running %q (policy rule %q asked for confirmation).\n", call.Name, decision.RuleName())
+					c.showResult(toolCall, audit.DecisionDeclined, "declined by the user", map[string]any{"error": observation})
+					currChatContent = append(currChatContent, c.toolObservation(call, observation, map[string]any{"error": observation}))
+					continue
+				default:
+					// This case should technically not be reachable due to AskForConfirmation loop
+					err := fmt.Errorf("invalid confirmation choice: %q", selectedChoice)
+					c.doc.AddBlock(ui.NewErrorBlock().SetText("Invalid choice received. Cancelling operation.", c.streams), c.streams)
+					return err
 				}
-				return fmt.Errorf("reading input: %w", err)
 			}
 
-			switch selectedChoice {
-			case "1":
-				// Proceed with the operation
-			case "2":
-				c.doc.AddBlock(ui.NewAgentTextBlock().SetText("Operation was skipped.", c.streams), c.streams)
-				observation := fmt.Sprintf("User didn't approve running %q.\n", call.Name)
-				currChatContent = append(currChatContent, observation)
-				continue
-			default:
-				// This case should technically not be reachable due to AskForConfirmation loop
-				err := fmt.Errorf("invalid confirmation choice: %q", selectedChoice)
-				c.doc.AddBlock(ui.NewErrorBlock().SetText("Invalid choice received. Cancelling operation.", c.streams), c.streams)
-				return err
+			if classification == tools.Mutating {
+				c.takeSnapshot(ctx, toolCall)
 			}
 
-			output, err := toolCall.InvokeTool(ctx, tools.InvokeToolOptions{
-				Kubeconfig: c.Kubeconfig,
-				WorkDir:    c.workDir,
-			})
+			opt := c.invokeToolOptions()
+			opt.OnResponse = func(ev tools.ToolResponseEvent) {
+				c.auditResponse(toolCall, ev)
+			}
+			output, err := toolCall.InvokeTool(ctx, opt)
 			if err != nil {
 				return fmt.Errorf("executing action: %w", err)
 			}
 
-			observation := fmt.Sprintf("Result of running %q:\n%s", call.Name, output)
-			currChatContent = append(currChatContent, observation)
+			approval := c.approvalSummary(decision)
+			result, err := c.toolResult(toolCall, output)
+			if err != nil {
+				return err
+			}
+			observation := fmt.Sprintf(toolResultPrefix+" %q (%s):\n%s", call.Name, approval, tools.JSONResult(result))
+			result["approval"] = approval
+			result["classification"] = string(classification)
+			c.showResult(toolCall, ranDecision(decision), approval, result)
+			currChatContent = append(currChatContent, c.toolObservation(call, observation, result))
 		}
 
 		// If no function calls were made, we're done
@@ -241,11 +394,112 @@ func (c *Conversation) RunOneRound(ctx context.Context, query string) error {
 	}
 
 	// If we've reached the maximum number of iterations
-	errorBlock := ui.NewErrorBlock().SetText(fmt.Sprintf("Sorry, couldn't complete the task after %d iterations.\n", maxIterations, c.streams), c.streams)
+	errorBlock := ui.NewErrorBlock().SetText(fmt.Sprintf("Sorry, couldn't complete the task after %d iterations.\n", maxIterations), c.streams)
 	c.doc.AddBlock(errorBlock, c.streams)
 	return fmt.Errorf("max iterations reached")
 }
 
+func (c *Conversation) invokeToolOptions() tools.InvokeToolOptions {
+	return tools.InvokeToolOptions{
+		Kubeconfig:  c.Kubeconfig,
+		KubeContext: c.KubeContext,
+		WorkDir:     c.workDir,
+		Timeout:     c.ToolTimeout,
+	}
+}
+
+// toolResult converts the tool output to a map, truncating large command outputs and masking the secrets
+// and credentials in it. What was truncated and redacted is shown to the user, but not to the LLM.
+func (c *Conversation) toolResult(call *tools.ToolCall, output any) (map[string]any, error) {
+	report := redact.Report{}
+	output = c.maskSecretValues(call, output, report)
+	if r, ok := output.(*tools.ExecResult); ok {
+		output = c.truncateOutput(call, r, report)
+	}
+	result, err := tools.ToolResultToMap(output)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		// A nil output converts to a nil map, the approval and classification are still added to it.
+		result = map[string]any{}
+	}
+	if c.Redactor != nil {
+		c.Redactor.Value(result, report)
+	}
+	if len(report) > 0 {
+		c.doc.AddBlock(ui.NewNoticeBlock().SetText(fmt.Sprintf("  Redacted from the output sent to the model: %s\n", report), c.streams), c.streams)
+	}
+	return result, nil
+}
+
+// maskSecretValues masks the standard output of command lines with a kubectl stage reading Secrets, whatever
+// the output format and the later stages, as the values may be extracted or decoded beyond recognition.
+func (c *Conversation) maskSecretValues(call *tools.ToolCall, output any, report redact.Report) any {
+	r, ok := output.(*tools.ExecResult)
+	if !ok || r == nil || c.Redactor == nil || call.Command() == nil {
+		return output
+	}
+	for _, stage := range call.Command().Stages {
+		k := stage.Kubectl
+		if k == nil || !k.ReadsSecrets() {
+			continue
+		}
+		namespace := k.Namespace
+		if namespace == "" {
+			namespace = c.Namespace
+		}
+		masked := *r
+		masked.Stdout = c.Redactor.SecretOutput(r.Stdout, namespace, k.Names, report)
+		return &masked
+	}
+	return output
+}
+
+// truncateOutput replaces a command output larger than MaxToolOutput with an excerpt and a summary of it.
+// The full output is redacted and stored in the working directory, where the read_output tool reads it.
+func (c *Conversation) truncateOutput(call *tools.ToolCall, r *tools.ExecResult, report redact.Report) *tools.ExecResult {
+	if r == nil || c.MaxToolOutput <= 0 || len(r.Stdout)+len(r.Stderr) <= c.MaxToolOutput {
+		return r
+	}
+	stdout := r.Stdout
+	if c.Redactor != nil {
+		stdout = c.Redactor.Text(stdout, report)
+	}
+	summary := tools.SummarizeOutput(stdout)
+	if err := tools.StoreOutput(c.workDir, call.ID(), stdout); err != nil {
+		klog.Warningf("error storing the output of %q: %v", call.PrettyPrint(), err)
+	} else {
+		summary.OutputID = call.ID()
+	}
+
+	truncated := *r
+	truncated.Stderr = tools.Excerpt(r.Stderr, c.MaxToolOutput/4)
+	truncated.Stdout = tools.Excerpt(stdout, c.MaxToolOutput-len(truncated.Stderr))
+	truncated.Truncated = summary
+
+	text := fmt.Sprintf("  The output (%s) was truncated for the model", summary)
+	if summary.OutputID != "" {
+		text += ", it can read the rest with read_output"
+	}
+	c.doc.AddBlock(ui.NewNoticeBlock().SetText(text+".\n", c.streams), c.streams)
+	return &truncated
+}
+
+// toolObservation builds the content reporting the outcome of a function call back to the LLM.
+// The ReAct shim has no notion of function call IDs, so the observation is sent as plain text;
+// in native mode the result is sent as a gollm.FunctionCallResult matching the call ID.
+func (c *Conversation) toolObservation(call gollm.FunctionCall, observation string, result map[string]any) any {
+	if c.enableToolUseShim() {
+		return observation
+	}
+	return gollm.FunctionCallResult{
+		ID:     call.ID,
+		Name:   call.Name,
+		Result: result,
+	}
+}
+
 // toResult converts an arbitrary result to a map[string]any
 func toResult(v any) (map[string]any, error) {
 	b, err := json.Marshal(v)
@@ -279,6 +533,9 @@ func (a *Conversation) generatePrompt(_ context.Context, data PromptData) (strin
 type PromptData struct {
 	Query string
 	Tools tools.Tools
+
+	// EnableToolUseShim asks the LLM to answer in the ReAct JSON format
+	EnableToolUseShim bool
 }
 
 func (a *PromptData) ToolsAsJSON() string {
@@ -310,6 +567,9 @@ type Action struct {
 	Reason           string `json:"reason"`
 	Command          string `json:"command"`
 	ModifiesResource string `json:"modifies_resource"`
+
+	// Arguments are the parameters of the tools which do not take a command, e.g. get_resources.
+	Arguments map[string]any `json:"arguments,omitempty"`
 }
 
 func extractJSON(s string) (string, bool) {
@@ -361,11 +621,20 @@ func toMap(v any) (map[string]any, error) {
 func candidateToShimCandidate(iterator gollm.ChatResponseIterator) (gollm.ChatResponseIterator, error) {
 	return func(yield func(gollm.ChatResponse, error) bool) {
 		buffer := ""
+		found := false
+		var usageMetadata any
 		for response, err := range iterator {
 			if err != nil {
 				yield(nil, err)
 				return
 			}
+			if metadata := response.UsageMetadata(); metadata != nil {
+				usageMetadata = metadata
+			}
+			if found {
+				// drain the stream, the usage is reported at its end
+				continue
+			}
 
 			if len(response.Candidates()) == 0 {
 				yield(nil, fmt.Errorf("no candidates in LLM response"))
@@ -384,8 +653,8 @@ func candidateToShimCandidate(iterator gollm.ChatResponseIterator) (gollm.ChatRe
 				}
 			}
 
-			if _, found := extractJSON(buffer); found {
-				break
+			if _, ok := extractJSON(buffer); ok {
+				found = true
 			}
 		}
 
@@ -400,16 +669,19 @@ func candidateToShimCandidate(iterator gollm.ChatResponseIterator) (gollm.ChatRe
 			return
 		}
 		buffer = "" // TODO: any trailing text?
-		yield(&ShimResponse{candidate: parsedReActResp}, nil)
+		yield(&ShimResponse{candidate: parsedReActResp, usage: usageMetadata}, nil)
 	}, nil
 }
 
 type ShimResponse struct {
 	candidate *ReActResponse
+
+	// usage is the usage metadata of the underlying response
+	usage any
 }
 
 func (r *ShimResponse) UsageMetadata() any {
-	return nil
+	return r.usage
 }
 
 func (r *ShimResponse) Candidates() []gollm.Candidate {
@@ -454,6 +726,15 @@ func (p *ShimPart) AsFunctionCalls() ([]gollm.FunctionCall, bool) {
 			return nil, false
 		}
 		delete(functionCallArgs, "name") // passed separately
+		// the structured tools take no command, the command tools report a missing one to the model
+		if command, _ := functionCallArgs["command"].(string); command == "" && len(p.action.Arguments) > 0 {
+			delete(functionCallArgs, "command")
+		}
+		// the structured tools take their parameters as a nested object
+		delete(functionCallArgs, "arguments")
+		for k, v := range p.action.Arguments {
+			functionCallArgs[k] = v
+		}
 		// delete(functionCallArgs, "reason")
 		// delete(functionCallArgs, "modifies_resource")
 		return []gollm.FunctionCall{
@@ -0,0 +1,296 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+
+	providers "github.com/ardaguclu/kubectl-interact/pkg/providers"
+	"github.com/ardaguclu/kubectl-interact/pkg/redact"
+	"github.com/ardaguclu/kubectl-interact/pkg/tools"
+	"github.com/ardaguclu/kubectl-interact/pkg/ui"
+	"github.com/ardaguclu/kubectl-interact/pkg/usage"
+)
+
+// unreachableKubeconfig points to a cluster which refuses the connections, the tool calls fail the same way
+// wherever the tests run.
+const unreachableKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:1
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+    namespace: default
+current-context: test
+users:
+- name: test
+  user:
+    token: not-a-token
+`
+
+// TestRunOneRoundReplay replays conversations recorded with --cassette. The cassettes are recorded against a
+// cluster refusing the connections, the results of the tool calls are not compared on replay anyway.
+func TestRunOneRoundReplay(t *testing.T) {
+	tests := []struct {
+		name     string
+		cassette string
+		query    string
+
+		wantErr      string
+		wantCommands []string
+		wantAnswer   string
+		wantUsage    usage.Usage
+	}{
+		{
+			name:         "tool call",
+			cassette:     "get-pods.json",
+			query:        "How many pods run in the default namespace?",
+			wantCommands: []string{"kubectl get pods -n default"},
+			wantAnswer:   "The cluster could not be reached, so the pods could not be listed. Check that the API server is running and that your kubeconfig points to it.",
+			wantUsage:    usage.Usage{PromptTokens: 2410 + 2530, CompletionTokens: 42 + 35, Calls: 2},
+		},
+		{
+			name:     "query not recorded",
+			cassette: "get-pods.json",
+			query:    "How many pods run in the kube-system namespace?",
+			wantErr:  "message 0 of chat 0 differs from the recorded one: content 0 is not the recorded text",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+			if err := os.WriteFile(kubeconfig, []byte(unreachableKubeconfig), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			client, err := providers.NewReplayClient(filepath.Join("testdata", tt.cassette))
+			if err != nil {
+				t.Fatalf("loading cassette: %v", err)
+			}
+
+			streams, _, _, _ := genericiooptions.NewTestIOStreams()
+			doc := ui.NewDocument(streams)
+			c := &Conversation{
+				LLM:         client,
+				Model:       client.Model(),
+				Tools:       tools.Default(),
+				Kubeconfig:  kubeconfig,
+				KubeContext: "test",
+				Namespace:   "default",
+				Approve:     ApproveReads,
+				ToolMode:    ToolModeNative,
+			}
+			if err := c.Init(context.Background(), doc, streams); err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+			defer c.Close()
+
+			err = c.RunOneRound(context.Background(), tt.query)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RunOneRound error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RunOneRound: %v", err)
+			}
+
+			var commands []string
+			var answer string
+			for _, block := range doc.Blocks() {
+				switch block := block.(type) {
+				case *ui.FunctionCallRequestBlock:
+					commands = append(commands, block.Call().Command)
+				case *ui.AgentTextBlock:
+					answer = block.Text()
+				case *ui.ErrorBlock:
+					t.Errorf("error shown: %s", block.Text())
+				}
+			}
+			if !reflect.DeepEqual(commands, tt.wantCommands) {
+				t.Errorf("commands = %q, want %q", commands, tt.wantCommands)
+			}
+			if answer != tt.wantAnswer {
+				t.Errorf("answer = %q, want %q", answer, tt.wantAnswer)
+			}
+			if got := c.Usage(); got != tt.wantUsage {
+				t.Errorf("usage = %+v, want %+v", got, tt.wantUsage)
+			}
+		})
+	}
+}
+
+// TestToolResultSecretValues checks that the values of Secrets are not sent to the model, whatever the output format
+// and the commands the output is piped to.
+func TestToolResultSecretValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		stdout  string
+		want    string
+	}{
+		{
+			name:    "jsonpath",
+			command: "kubectl get secret db -o jsonpath='{.data.password}' | base64 -d",
+			stdout:  "hunter2",
+			want:    redact.Mask,
+		},
+		{
+			name:    "go-template",
+			command: `kubectl get secrets -n prod -o go-template='{{range .items}}{{.data.token}}{{"\n"}}{{end}}'`,
+			stdout:  "c2VjcmV0LXRva2Vu\n",
+			want:    redact.Mask,
+		},
+		{
+			name:    "custom-columns",
+			command: "kubectl get secret/db -o custom-columns=PASSWORD:.data.password",
+			stdout:  "PASSWORD\naHVudGVyMg==\n",
+			want:    redact.Mask,
+		},
+		{
+			name:    "jq",
+			command: "kubectl get secret db -o json | jq -r '.data.password' | base64 -d",
+			stdout:  "hunter2",
+			want:    redact.Mask,
+		},
+		{
+			name:    "grep",
+			command: "kubectl get secret db -o yaml | grep -A3 data",
+			stdout:  "data:\n  username: YWRtaW4=\n  dbpass: aHVudGVyMg==\n",
+			want:    redact.Mask,
+		},
+		{
+			name:    "unknown resource types",
+			command: "kubectl get -f objects.yaml -o yaml",
+			stdout:  "apiVersion: v1\nkind: Secret\n",
+			want:    redact.Mask,
+		},
+		{
+			name:    "configmap",
+			command: "kubectl get configmap model -o yaml | grep tokenizer",
+			stdout:  "  tokenizer: bert\n",
+			want:    "  tokenizer: bert\n",
+		},
+		{
+			name:    "allowed secret",
+			command: "kubectl get secret public -o jsonpath='{.data.ca\\.crt}'",
+			stdout:  "Y2VydGlmaWNhdGU=",
+			want:    "Y2VydGlmaWNhdGU=",
+		},
+		{
+			name:    "other resources",
+			command: "kubectl get pods -o jsonpath='{.items[*].metadata.name}'",
+			stdout:  "web-0 web-1",
+			want:    "web-0 web-1",
+		},
+	}
+	redactor, err := redact.New(redact.Options{AllowSecrets: []string{"default/public"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streams, _, _, _ := genericiooptions.NewTestIOStreams()
+			c := &Conversation{
+				Namespace: "default",
+				Redactor:  redactor,
+				doc:       ui.NewDocument(streams),
+				streams:   streams,
+			}
+			toolset := tools.Default()
+			call, err := toolset.ParseToolInvocation(context.Background(), "kubectl", map[string]any{"command": tt.command})
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := c.toolResult(call, &tools.ExecResult{Stdout: tt.stdout})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := result["stdout"]; got != tt.want {
+				t.Errorf("stdout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestShimPartCommand checks that the ReAct actions keep the command of the command tools, even empty, so that
+// the tool reports it missing to the model, while the structured tools get their arguments only.
+func TestShimPartCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		action *Action
+		want   map[string]any
+	}{
+		{
+			name:   "command tool",
+			action: &Action{Name: "kubectl", Command: "kubectl get pods", ModifiesResource: "no"},
+			want:   map[string]any{"command": "kubectl get pods", "modifies_resource": "no", "reason": ""},
+		},
+		{
+			name:   "command tool without command",
+			action: &Action{Name: "kubectl", ModifiesResource: "no"},
+			want:   map[string]any{"command": "", "modifies_resource": "no", "reason": ""},
+		},
+		{
+			name:   "structured tool",
+			action: &Action{Name: "get_resources", Arguments: map[string]any{"kind": "pods"}},
+			want:   map[string]any{"kind": "pods", "modifies_resource": "", "reason": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls, ok := (&ShimPart{action: tt.action}).AsFunctionCalls()
+			if !ok || len(calls) != 1 {
+				t.Fatalf("AsFunctionCalls() = %v, %v, want a call", calls, ok)
+			}
+			if !reflect.DeepEqual(calls[0].Arguments, tt.want) {
+				t.Errorf("arguments = %v, want %v", calls[0].Arguments, tt.want)
+			}
+		})
+	}
+}
+
+// TestToolResultSecretObject checks that the Secrets read by the structured tools are redacted by the redactor
+// of the conversation, which honors the allowlisted Secrets.
+func TestToolResultSecretObject(t *testing.T) {
+	redactor, err := redact.New(redact.Options{AllowSecrets: []string{"default/public"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"db": redact.Mask, "public": "aHVudGVyMg=="} {
+		t.Run(name, func(t *testing.T) {
+			streams, _, _, _ := genericiooptions.NewTestIOStreams()
+			c := &Conversation{Namespace: "default", Redactor: redactor, doc: ui.NewDocument(streams), streams: streams}
+			toolset := tools.Default()
+			call, err := toolset.ParseToolInvocation(context.Background(), "get_resources", map[string]any{"kind": "secrets", "name": name})
+			if err != nil {
+				t.Fatal(err)
+			}
+			output := tools.JSONResult{"object": map[string]any{
+				"apiVersion": "v1",
+				"kind":       "Secret",
+				"metadata":   map[string]any{"name": name, "namespace": "default"},
+				"data":       map[string]any{"password": "aHVudGVyMg=="},
+			}}
+			result, err := c.toolResult(call, output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			object, _ := result["object"].(map[string]any)
+			data, _ := object["data"].(map[string]any)
+			if got := data["password"]; got != want {
+				t.Errorf("password = %q, want %q", got, want)
+			}
+		})
+	}
+}
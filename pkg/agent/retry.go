@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubectl-ai/gollm"
+	"k8s.io/klog/v2"
+
+	providers "github.com/ardaguclu/kubectl-interact/pkg/providers"
+	"github.com/ardaguclu/kubectl-interact/pkg/ui"
+)
+
+// DefaultRetryConfig is used for the requests to the LLM unless the conversation configures retries.
+var DefaultRetryConfig = gollm.RetryConfig{
+	MaxAttempts:    3,
+	InitialBackoff: 10 * time.Second,
+	MaxBackoff:     60 * time.Second,
+	BackoffFactor:  2,
+	Jitter:         true,
+}
+
+// retryChat retries the requests to the LLM which fail with retryable errors. Unlike gollm.NewRetryChat,
+// it retries streaming requests until the stream started, waits as long as the server asks with Retry-After,
+// and reports the attempts.
+type retryChat struct {
+	gollm.Chat
+
+	config gollm.RetryConfig
+
+	// onRetry is called before waiting for the next attempt.
+	onRetry func(attempt int, wait time.Duration, err error)
+
+	// onDone is called once the request succeeded or failed for good.
+	onDone func()
+}
+
+func (rc *retryChat) Send(ctx context.Context, contents ...any) (gollm.ChatResponse, error) {
+	return retry(ctx, rc, func(ctx context.Context) (gollm.ChatResponse, error) {
+		return rc.Chat.Send(ctx, contents...)
+	})
+}
+
+func (rc *retryChat) SendStreaming(ctx context.Context, contents ...any) (gollm.ChatResponseIterator, error) {
+	return retry(ctx, rc, func(ctx context.Context) (gollm.ChatResponseIterator, error) {
+		return rc.Chat.SendStreaming(ctx, contents...)
+	})
+}
+
+// retryAfter returns the delay the server asked to wait before retrying, zero if it did not.
+func retryAfter(err error) time.Duration {
+	var e interface{ RetryAfter() time.Duration }
+	if errors.As(err, &e) {
+		return e.RetryAfter()
+	}
+	return 0
+}
+
+func retry[T any](ctx context.Context, rc *retryChat, operation func(context.Context) (T, error)) (T, error) {
+	var zero T
+	// clear the status of the retries, if any
+	defer rc.onDone()
+
+	backoff := rc.config.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		result, err := operation(ctx)
+		if err == nil {
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return zero, ctx.Err()
+		}
+		if !rc.IsRetryableError(err) {
+			return zero, err
+		}
+		if attempt >= rc.config.MaxAttempts {
+			return zero, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		wait := backoff
+		if rc.config.Jitter {
+			wait += time.Duration(rand.Float64() * float64(backoff) / 2)
+		}
+		if d := retryAfter(err); d > 0 {
+			if d > rc.config.MaxBackoff {
+				return zero, fmt.Errorf("the server asked to retry after %s, longer than the maximum backoff of %s: %w", d.Round(time.Second), rc.config.MaxBackoff, err)
+			}
+			wait = d
+		}
+		klog.Infof("LLM request failed with a retryable error, retrying in %s (attempt %d of %d): %v", wait, attempt+1, rc.config.MaxAttempts, err)
+		rc.onRetry(attempt, wait, err)
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		}
+
+		backoff = time.Duration(float64(backoff) * rc.config.BackoffFactor)
+		if backoff > rc.config.MaxBackoff {
+			backoff = rc.config.MaxBackoff
+		}
+	}
+}
+
+// newRetryChat wraps the chat with retries, showing the attempts in a status block.
+func (c *Conversation) newRetryChat(chat gollm.Chat) gollm.Chat {
+	config := c.Retry
+	if config.MaxAttempts == 0 {
+		config = DefaultRetryConfig
+	}
+	var status *ui.StatusBlock
+	return &retryChat{
+		Chat:   chat,
+		config: config,
+		onRetry: func(attempt int, wait time.Duration, err error) {
+			text := fmt.Sprintf("  The model API failed, retrying in %s (attempt %d of %d): %v", wait.Round(time.Second), attempt+1, config.MaxAttempts, err)
+			if status == nil {
+				status = ui.NewStatusBlock()
+				c.doc.AddBlock(status, c.streams)
+			}
+			status.SetText(text, c.streams)
+		},
+		onDone: func() {
+			if status != nil {
+				status.SetText("", c.streams)
+				status = nil
+			}
+		},
+	}
+}
+
+// showFallback tells the user that a request to the model failed and is sent to the next model of the chain.
+func (c *Conversation) showFallback(e providers.FallbackEvent) {
+	text := fmt.Sprintf("  %s failed, falling back to %s: %v", e.From, e.To, e.Err)
+	if e.HistoryLost {
+		text += ". Its history could not be carried over, the conversation starts over"
+	}
+	c.doc.AddBlock(ui.NewNoticeBlock().SetText(text+".\n", c.streams), c.streams)
+}
@@ -0,0 +1,152 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/ardaguclu/kubectl-interact/pkg/audit"
+	"github.com/ardaguclu/kubectl-interact/pkg/tools"
+	"github.com/ardaguclu/kubectl-interact/pkg/ui"
+)
+
+// takeSnapshot saves the objects affected by the tool call before it runs, so that it can be rolled back.
+func (c *Conversation) takeSnapshot(ctx context.Context, call *tools.ToolCall) {
+	if c.Snapshots == nil {
+		return
+	}
+	snap, err := call.Snapshot(ctx, c.invokeToolOptions())
+	if err == nil && snap != nil {
+		err = c.Snapshots.Save(snap)
+	}
+	if err != nil {
+		klog.Warningf("error taking snapshot of %q: %v", call.PrettyPrint(), err)
+		c.doc.AddBlock(ui.NewErrorBlock().SetText(fmt.Sprintf("  Could not take a snapshot, the change can not be rolled back: %v\n", err), c.streams), c.streams)
+		return
+	}
+	if snap == nil {
+		klog.V(1).Infof("no snapshot taken of %q, its targets are unknown", call.PrettyPrint())
+		if call.Snapshottable() {
+			// the notice was not shown before the approval
+			c.doc.AddBlock(ui.NewNoticeBlock().SetText("  Could not take a snapshot, this change can not be rolled back.\n", c.streams), c.streams)
+		}
+		return
+	}
+	klog.V(1).Infof("saved snapshot %s of %q with %d objects", snap.CallID, snap.Command, len(snap.Objects))
+}
+
+// noticeUnsnapshottable tells, before the mutating tool call is approved, that it can not be rolled back because
+// the objects it affects can not be determined, or because it deletes namespaces.
+func (c *Conversation) noticeUnsnapshottable(call *tools.ToolCall) {
+	if c.Snapshots == nil || call.Classification() != tools.Mutating || call.Snapshottable() {
+		return
+	}
+	if call.DeletesNamespaces() {
+		c.doc.AddBlock(ui.NewNoticeBlock().SetText("  Deleting a namespace deletes every object in it, this change can not be rolled back.\n", c.streams), c.streams)
+		return
+	}
+	c.doc.AddBlock(ui.NewNoticeBlock().SetText("  The objects affected by this command can not be determined, this change can not be rolled back.\n", c.streams), c.streams)
+}
+
+// Rollback lists the changes made during the session and restores the one the user selects,
+// after showing a server-side dry-run diff.
+func (c *Conversation) Rollback(ctx context.Context) error {
+	if c.Snapshots == nil {
+		c.doc.AddBlock(ui.NewErrorBlock().SetText("  Snapshots are not enabled, there is nothing to roll back.\n", c.streams), c.streams)
+		return nil
+	}
+	snaps, err := c.Snapshots.List()
+	if err != nil {
+		return err
+	}
+	if len(snaps) == 0 {
+		c.doc.AddBlock(ui.NewAgentTextBlock().SetText("No changes were made during this session.", c.streams), c.streams)
+		return nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("  Changes made during this session:\n")
+	options := []string{"0"}
+	for i, snap := range snaps {
+		var refs []string
+		for _, ref := range snap.Refs() {
+			refs = append(refs, ref.String())
+		}
+		status := ""
+		if snap.RolledBack != nil {
+			status = fmt.Sprintf(" (rolled back at %s)", snap.RolledBack.Format(time.TimeOnly))
+		}
+		fmt.Fprintf(&sb, "  %d) %s %s%s\n       %s\n", i+1, snap.Time.Format(time.TimeOnly), snap.Command, status, strings.Join(refs, ", "))
+		options = append(options, strconv.Itoa(i+1))
+	}
+	sb.WriteString("  0) Cancel")
+
+	choice, err := c.askOption(sb.String(), options)
+	if err != nil || choice == "" || choice == "0" {
+		return err
+	}
+	i, _ := strconv.Atoi(choice)
+	snap := snaps[i-1]
+
+	preview := tools.RollbackPreview(ctx, c.invokeToolOptions(), snap)
+	if preview.Error != "" {
+		c.doc.AddBlock(ui.NewErrorBlock().SetText(fmt.Sprintf("  Server-side dry-run of the rollback failed: %s\n", preview.Error), c.streams), c.streams)
+		return nil
+	}
+	if preview.Diff == "" {
+		c.doc.AddBlock(ui.NewAgentTextBlock().SetText("The objects are already in the state of the snapshot, there is nothing to roll back.", c.streams), c.streams)
+		return nil
+	}
+	c.doc.AddBlock(ui.NewDiffBlock().SetDiff(fmt.Sprintf("Rolling back %q (server-side dry-run):", snap.Command), preview.Diff, c.streams), c.streams)
+
+	choice, err = c.askOption(`  Do you want to proceed ?
+  1) Yes
+  2) No`, []string{"1", "2"})
+	if err != nil || choice == "" {
+		return err
+	}
+	if choice != "1" {
+		c.auditRollback(snap, audit.DecisionDeclined)
+		return nil
+	}
+
+	callID := c.auditRollback(snap, audit.DecisionApproved)
+	start := time.Now()
+	result, err := tools.Rollback(ctx, c.invokeToolOptions(), snap)
+	c.auditRollbackResponse(callID, result, time.Since(start), err)
+	if err != nil {
+		return fmt.Errorf("rolling back: %w", err)
+	}
+	if result.Error != "" || result.ExitCode != 0 {
+		c.doc.AddBlock(ui.NewErrorBlock().SetText(fmt.Sprintf("  Rollback failed: %s\n", strings.TrimSpace(result.Error+"\n"+result.Stderr)), c.streams), c.streams)
+		return nil
+	}
+	now := time.Now()
+	snap.RolledBack = &now
+	if err := c.Snapshots.Save(snap); err != nil {
+		return err
+	}
+	c.doc.AddBlock(ui.NewAgentTextBlock().SetText(fmt.Sprintf("Rolled back %q.\n\n```\n%s```", snap.Command, result.Stdout), c.streams), c.streams)
+	return nil
+}
+
+// askOption prompts the user to select one of the options, it returns an empty string on end of input.
+func (c *Conversation) askOption(prompt string, options []string) (string, error) {
+	optionsBlock := ui.NewInputOptionBlock().SetPrompt(prompt)
+	optionsBlock.SetOptions(options)
+	c.doc.AddBlock(optionsBlock, c.streams)
+
+	choice, err := optionsBlock.Observable().Wait()
+	if err != nil {
+		if err == io.EOF {
+			return "", nil
+		}
+		return "", fmt.Errorf("reading input: %w", err)
+	}
+	return choice, nil
+}
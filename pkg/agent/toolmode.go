@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ToolMode controls how tool invocations are exchanged with the LLM.
+type ToolMode string
+
+const (
+	// ToolModeAuto picks native or shim based on the provider and the model.
+	ToolModeAuto ToolMode = "auto"
+	// ToolModeNative uses the provider's function calling API.
+	ToolModeNative ToolMode = "native"
+	// ToolModeShim asks the model to emit a ReAct JSON block which is parsed into function calls.
+	ToolModeShim ToolMode = "shim"
+)
+
+// ToolModes lists the supported tool modes.
+var ToolModes = []ToolMode{ToolModeAuto, ToolModeNative, ToolModeShim}
+
+// ParseToolMode validates the given tool mode.
+func ParseToolMode(s string) (ToolMode, error) {
+	for _, m := range ToolModes {
+		if string(m) == s {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("invalid tool mode %q, must be one of %v", s, ToolModes)
+}
+
+var (
+	// nativeProviders are the providers whose models are expected to support function calling.
+	nativeProviders = []string{"gemini", "vertexai", "openai", "azopenai", "anthropic"}
+
+	// shimModels are model families known to produce unreliable native function calls.
+	shimModels = []string{"granite"}
+
+	// nativeModels are model families known to support function calling when served
+	// by generic providers such as ollama, llama.cpp or OpenAI compatible servers.
+	nativeModels = []string{"gpt-", "o1", "o3", "o4", "gemini", "claude", "llama3.1", "llama3.2", "llama3.3", "llama-3.1", "llama-3.2", "llama-3.3", "qwen2.5", "qwen3", "mistral", "mixtral", "command-r"}
+)
+
+// ResolveToolMode returns the tool mode to use for the given provider and model.
+// Explicit modes are returned as is, ToolModeAuto is resolved to either ToolModeNative or ToolModeShim.
+func ResolveToolMode(mode ToolMode, provider, model string) ToolMode {
+	if mode != ToolModeAuto && mode != "" {
+		return mode
+	}
+
+	model = strings.ToLower(model)
+	for _, m := range shimModels {
+		if strings.Contains(model, m) {
+			return ToolModeShim
+		}
+	}
+	for _, p := range nativeProviders {
+		if provider == p {
+			return ToolModeNative
+		}
+	}
+	// strip the registry or organization prefix, e.g. "meta-llama/llama-3.1-8b"
+	if i := strings.LastIndex(model, "/"); i != -1 {
+		model = model[i+1:]
+	}
+	for _, m := range nativeModels {
+		if strings.HasPrefix(model, m) {
+			return ToolModeNative
+		}
+	}
+	return ToolModeShim
+}
@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	providers "github.com/ardaguclu/kubectl-interact/pkg/providers"
+	"github.com/ardaguclu/kubectl-interact/pkg/ui"
+	"github.com/ardaguclu/kubectl-interact/pkg/usage"
+)
+
+// Usage returns the token usage of the session.
+func (c *Conversation) Usage() usage.Usage {
+	return c.usage
+}
+
+// addUsage accounts for the usage of a request, to the model which served it if the reporter tells it or else
+// to the model of the conversation.
+func (c *Conversation) addUsage(reporter providers.ModelReporter, u usage.Usage) {
+	model := c.Model
+	if reporter != nil && reporter.ServedModel() != "" {
+		model = reporter.ServedModel()
+	}
+	if c.usageByModel == nil {
+		c.usageByModel = map[string]usage.Usage{}
+	}
+	modelUsage := c.usageByModel[model]
+	modelUsage.Add(u)
+	c.usageByModel[model] = modelUsage
+	c.usage.Add(u)
+}
+
+// showTurnUsage renders a footer with the tokens used to answer the query, if the provider reported them.
+func (c *Conversation) showTurnUsage(turn *usage.Usage) {
+	if turn.Calls == 0 {
+		return
+	}
+	text := fmt.Sprintf("  Tokens: %s, session total %d", turn, c.usage.Total())
+	if cost, ok := c.Prices.TotalCost(c.usageByModel); ok {
+		text += fmt.Sprintf(", ~$%.4f", cost)
+	}
+	c.doc.AddBlock(ui.NewNoticeBlock().SetText(text+"\n", c.streams), c.streams)
+}
+
+// budgetExhausted returns true, telling the user, if the session used its token budget.
+func (c *Conversation) budgetExhausted() bool {
+	if c.TokenBudget <= 0 || c.usage.Total() < c.TokenBudget {
+		return false
+	}
+	c.doc.AddBlock(ui.NewErrorBlock().SetText(fmt.Sprintf("  Stopping: the session used %d tokens, its budget is %d tokens.\n", c.usage.Total(), c.TokenBudget), c.streams), c.streams)
+	return true
+}
+
+// ShowUsage renders the token usage of the session, its estimated cost and the remaining budget.
+func (c *Conversation) ShowUsage() {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "  Session usage: %s\n", c.usage)
+	var models []string
+	for model := range c.usageByModel {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	if len(models) == 0 {
+		models = []string{c.Model}
+	}
+	if len(models) > 1 {
+		for _, model := range models {
+			fmt.Fprintf(&sb, "    %s: %s\n", modelName(model), c.usageByModel[model])
+		}
+	}
+	if cost, ok := c.Prices.TotalCost(c.usageByModel); ok {
+		var names []string
+		for _, model := range models {
+			names = append(names, modelName(model))
+		}
+		fmt.Fprintf(&sb, "  Estimated cost: $%.4f (%s)\n", cost, strings.Join(names, ", "))
+	} else {
+		var unpriced []string
+		for _, model := range models {
+			if _, ok := c.Prices.Cost(model, c.usageByModel[model]); !ok {
+				unpriced = append(unpriced, fmt.Sprintf("%q", model))
+			}
+		}
+		fmt.Fprintf(&sb, "  Estimated cost: unknown, the price table has no price for %s\n", strings.Join(unpriced, ", "))
+	}
+	if c.TokenBudget > 0 {
+		fmt.Fprintf(&sb, "  Token budget: %d of %d tokens used\n", c.usage.Total(), c.TokenBudget)
+	}
+	if c.history != nil && c.ContextLimit > 0 {
+		fmt.Fprintf(&sb, "  Context window: ~%d of %d tokens used by the conversation\n", c.contextTokens(), c.ContextLimit)
+	}
+	c.doc.AddBlock(ui.NewNoticeBlock().SetText(sb.String(), c.streams), c.streams)
+}
+
+// modelName names the model in the usage, the model is unknown if the provider chose it.
+func modelName(model string) string {
+	if model == "" {
+		return "default model"
+	}
+	return model
+}
@@ -0,0 +1,179 @@
+// Package audit keeps an append-only log of the tool calls, their approval and their outcome.
+//
+// The log is a JSON Lines file, ~/.kubectl-interact/audit.jsonl by default. Every tool call adds
+// a request entry once it was approved or rejected, and a response entry once it ran.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"k8s.io/client-go/util/homedir"
+)
+
+// DefaultFile is the audit log used unless configured otherwise.
+var DefaultFile = filepath.Join(homedir.HomeDir(), ".kubectl-interact", "audit.jsonl")
+
+// maxOutput is the number of bytes of the tool output kept in the log.
+const maxOutput = 4 * 1024
+
+// EntryType is the type of an entry.
+type EntryType string
+
+const (
+	// EntryRequest records a tool call and its approval.
+	EntryRequest EntryType = "request"
+	// EntryResponse records the outcome of a tool call.
+	EntryResponse EntryType = "response"
+)
+
+// Decision is how a tool call was approved or rejected.
+type Decision string
+
+const (
+	// DecisionAllowed is a call run without confirmation because of a policy rule.
+	DecisionAllowed Decision = "allowed"
+	// DecisionApproved is a call the user confirmed.
+	DecisionApproved Decision = "approved"
+	// DecisionDenied is a call rejected by a policy rule.
+	DecisionDenied Decision = "denied"
+	// DecisionDeclined is a call the user did not confirm.
+	DecisionDeclined Decision = "declined"
+)
+
+// Entry is a line of the audit log.
+type Entry struct {
+	Type    EntryType `json:"type"`
+	Time    time.Time `json:"time"`
+	Session string    `json:"session"`
+	User    string    `json:"user,omitempty"`
+	CallID  string    `json:"callID"`
+
+	// Context and Namespace are the kube contexts and namespaces the call targets, comma separated.
+	Context   string `json:"context,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+
+	// Set on requests.
+	Tool           string         `json:"tool,omitempty"`
+	Command        string         `json:"command,omitempty"`
+	Arguments      map[string]any `json:"arguments,omitempty"`
+	Classification string         `json:"classification,omitempty"`
+	Decision       Decision       `json:"decision,omitempty"`
+	Rule           string         `json:"rule,omitempty"`
+	// RollbackOf is the call ID of the tool call a rollback restores, Objects are the objects it restores.
+	RollbackOf string   `json:"rollbackOf,omitempty"`
+	Objects    []string `json:"objects,omitempty"`
+
+	// Set on responses.
+	ExitCode *int          `json:"exitCode,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Output   string        `json:"output,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Log appends entries to the audit log of a session.
+type Log struct {
+	mu      sync.Mutex
+	file    *os.File
+	session string
+	user    string
+}
+
+// Open opens the audit log for appending, creating it if needed.
+func Open(filename, session string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0o700); err != nil {
+		return nil, fmt.Errorf("creating audit log directory: %w", err)
+	}
+	// the output of tool calls may be sensitive
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	l := &Log{file: f, session: session}
+	if u, err := user.Current(); err == nil {
+		l.user = u.Username
+	}
+	return l, nil
+}
+
+// Write appends the entry, filling in the time, session and user.
+func (l *Log) Write(e Entry) error {
+	e.Time = time.Now().UTC()
+	e.Session = l.session
+	e.User = l.user
+	if len(e.Output) > maxOutput {
+		// cut at a rune boundary, a split rune would be written as U+FFFD
+		n := maxOutput
+		for n > 0 && !utf8.RuneStart(e.Output[n]) {
+			n--
+		}
+		e.Output = e.Output[:n] + fmt.Sprintf("\n... (%d bytes truncated)", len(e.Output)-n)
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("converting audit entry to json: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// a single write per line keeps the lines of concurrent sessions apart
+	if _, err := l.file.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("writing audit log: %w", err)
+	}
+	return nil
+}
+
+// Close closes the audit log.
+func (l *Log) Close() error {
+	return l.file.Close()
+}
+
+// Action is a tool call along with its outcome, nil if it did not run.
+type Action struct {
+	Request  Entry  `json:"request"`
+	Response *Entry `json:"response,omitempty"`
+}
+
+// Read reads the actions of the audit log, oldest first.
+func Read(filename string) ([]*Action, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	defer f.Close()
+
+	var actions []*Action
+	byCallID := map[string]*Action{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("parsing line %d of audit log %q: %w", line, filename, err)
+		}
+		switch e.Type {
+		case EntryRequest:
+			a := &Action{Request: e}
+			byCallID[e.CallID] = a
+			actions = append(actions, a)
+		case EntryResponse:
+			if a, ok := byCallID[e.CallID]; ok {
+				a.Response = &e
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading audit log: %w", err)
+	}
+	return actions, nil
+}
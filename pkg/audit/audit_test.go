@@ -0,0 +1,42 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// TestWriteTruncatedOutput checks that long outputs are cut at a rune boundary, so that the log keeps valid UTF-8.
+func TestWriteTruncatedOutput(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(filename, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the two bytes of an "é" straddle maxOutput
+	output := strings.Repeat("a", maxOutput-1) + strings.Repeat("é", 10)
+	if err := l.Write(Entry{Output: output}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e Entry
+	if err := json.Unmarshal(b, &e); err != nil {
+		t.Fatal(err)
+	}
+	if strings.ContainsRune(e.Output, utf8.RuneError) {
+		t.Errorf("Output = %q, want no split rune", e.Output[maxOutput-8:])
+	}
+	if !strings.HasPrefix(e.Output, output[:maxOutput-1]+"\n... (20 bytes truncated)") {
+		t.Errorf("Output = %q, want it cut before the first é", e.Output[maxOutput-8:])
+	}
+}
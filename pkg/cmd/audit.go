@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+
+	"github.com/ardaguclu/kubectl-interact/pkg/audit"
+)
+
+var (
+	auditExample = `
+	# list the tool calls of the last 12 hours
+	%[1]s interact audit --since 12h
+
+	# list what was changed in the prod context
+	%[1]s interact audit --context 'prod*' --classification mutating --decision allowed,approved
+
+	# print the full entries as JSON
+	%[1]s interact audit --session 20250101-220000-1234 -o json
+`
+)
+
+type AuditOptions struct {
+	file            string
+	since           time.Duration
+	contexts        []string
+	namespaces      []string
+	classifications []string
+	decisions       []string
+	session         string
+	output          string
+
+	genericiooptions.IOStreams
+}
+
+// NewAuditOptions provides an instance of AuditOptions with default values
+func NewAuditOptions(streams genericiooptions.IOStreams) *AuditOptions {
+	return &AuditOptions{
+		file:      audit.DefaultFile,
+		output:    "table",
+		IOStreams: streams,
+	}
+}
+
+// NewCmdAudit provides a cobra command listing the tool calls recorded in the audit log
+func NewCmdAudit(streams genericiooptions.IOStreams) *cobra.Command {
+	o := NewAuditOptions(streams)
+	cmd := &cobra.Command{
+		Use:          "audit",
+		Short:        "List the tool calls recorded in the audit log",
+		Example:      fmt.Sprintf(auditExample, "kubectl"),
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.file, "file", o.file, "Path to the audit log")
+	cmd.Flags().DurationVar(&o.since, "since", o.since, "Only list the tool calls of the given duration, e.g. 12h")
+	cmd.Flags().StringSliceVar(&o.contexts, "context", o.contexts, "Only list the tool calls targeting kube contexts matching one of the glob patterns")
+	cmd.Flags().StringSliceVar(&o.namespaces, "namespace", o.namespaces, "Only list the tool calls targeting namespaces matching one of the glob patterns")
+	cmd.Flags().StringSliceVar(&o.classifications, "classification", o.classifications, "Only list the tool calls with one of the classifications, read-only, mutating or unknown")
+	cmd.Flags().StringSliceVar(&o.decisions, "decision", o.decisions, "Only list the tool calls with one of the decisions, allowed, approved, denied or declined")
+	cmd.Flags().StringVar(&o.session, "session", o.session, "Only list the tool calls of the session")
+	cmd.Flags().StringVarP(&o.output, "output", "o", o.output, "Output format, one of table or json")
+
+	return cmd
+}
+
+func (o *AuditOptions) Validate() error {
+	if o.output != "table" && o.output != "json" {
+		return fmt.Errorf("unsupported output format %q, must be one of table or json", o.output)
+	}
+	if o.since < 0 {
+		return fmt.Errorf("--since must not be negative")
+	}
+	for _, patterns := range [][]string{o.contexts, o.namespaces} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (o *AuditOptions) Run() error {
+	actions, err := audit.Read(o.file)
+	if err != nil {
+		return err
+	}
+
+	var matching []*audit.Action
+	for _, a := range actions {
+		if o.matches(a) {
+			matching = append(matching, a)
+		}
+	}
+
+	if o.output == "json" {
+		enc := json.NewEncoder(o.Out)
+		for _, a := range matching {
+			if err := enc.Encode(a); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(o.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tSESSION\tCONTEXT\tNAMESPACE\tCLASSIFICATION\tDECISION\tEXIT CODE\tDURATION\tCOMMAND")
+	for _, a := range matching {
+		r := a.Request
+		exitCode, duration := "-", "-"
+		if a.Response != nil {
+			duration = a.Response.Duration.Round(time.Millisecond).String()
+			switch {
+			case a.Response.ExitCode != nil:
+				exitCode = fmt.Sprint(*a.Response.ExitCode)
+			case a.Response.Error != "":
+				exitCode = "error"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Time.Local().Format(time.DateTime), r.Session, r.Context, r.Namespace, r.Classification, r.Decision, exitCode, duration,
+			strings.ReplaceAll(r.Command, "\n", " "))
+	}
+	return w.Flush()
+}
+
+// matches returns true if the action passes the filters.
+func (o *AuditOptions) matches(a *audit.Action) bool {
+	r := a.Request
+	switch {
+	case o.since > 0 && time.Since(r.Time) > o.since:
+		return false
+	case o.session != "" && r.Session != o.session:
+		return false
+	case len(o.classifications) > 0 && !slices.Contains(o.classifications, r.Classification):
+		return false
+	case len(o.decisions) > 0 && !slices.Contains(o.decisions, string(r.Decision)):
+		return false
+	case len(o.contexts) > 0 && !matchesAny(o.contexts, r.Context):
+		return false
+	case len(o.namespaces) > 0 && !matchesAny(o.namespaces, r.Namespace):
+		return false
+	}
+	return true
+}
+
+// matchesAny returns true if one of the comma separated values matches one of the glob patterns.
+func matchesAny(patterns []string, values string) bool {
+	for _, v := range strings.Split(values, ",") {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, v); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
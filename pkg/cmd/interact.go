@@ -7,19 +7,40 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/GoogleCloudPlatform/kubectl-ai/gollm"
 	"github.com/ardaguclu/kubectl-interact/pkg/agent"
+	"github.com/ardaguclu/kubectl-interact/pkg/audit"
+	"github.com/ardaguclu/kubectl-interact/pkg/completion"
+	"github.com/ardaguclu/kubectl-interact/pkg/config"
+	"github.com/ardaguclu/kubectl-interact/pkg/policy"
+	providers "github.com/ardaguclu/kubectl-interact/pkg/providers"
+	"github.com/ardaguclu/kubectl-interact/pkg/redact"
+	"github.com/ardaguclu/kubectl-interact/pkg/snapshot"
 	"github.com/ardaguclu/kubectl-interact/pkg/tools"
 	"github.com/ardaguclu/kubectl-interact/pkg/ui"
+	"github.com/ardaguclu/kubectl-interact/pkg/usage"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/homedir"
+	"k8s.io/klog/v2"
 )
 
 var (
+	defaultPolicyFile = filepath.Join(homedir.HomeDir(), ".kubectl-interact", "policy.yaml")
+
 	interactExample = `
 	# Run predefined kubectl commands via given LLM model
 	%[1]s interact
+
+	# Answer a single question and exit
+	%[1]s interact "why is my pod crashing"
+
+	# Pass additional context on stdin, printing only the answer
+	kubectl get events | %[1]s interact --quiet "summarize"
 `
 )
 
@@ -30,6 +51,39 @@ type InteractOptions struct {
 	modelID       string
 	apiKey        string
 	caCert        string
+	clientCert    string
+	clientKey     string
+	proxy         string
+	toolMode      string
+	policyFile    string
+	toolTimeout   time.Duration
+	auditLog      string
+	retry         gollm.RetryConfig
+	pricesFile    string
+	configFile    string
+	tokenBudget   int
+	contextLimit  int
+	maxToolOutput int
+	cassette      string
+	approve       string
+	quiet         bool
+	output        string
+	ui            string
+	listen        string
+	historyFile   string
+
+	// query is the question asked on the command line, answered without starting the interactive session
+	query string
+
+	redactAllowKeys    []string
+	redactAllowSecrets []string
+
+	kubeContext string
+	namespace   string
+	policy      *policy.Policy
+	redactor    *redact.Redactor
+	prices      *usage.Prices
+	config      *config.Config
 
 	genericiooptions.IOStreams
 }
@@ -41,6 +95,14 @@ func NewInteractOptions(streams genericiooptions.IOStreams) *InteractOptions {
 		modelURL:      os.Getenv("MODEL_URL"),
 		modelID:       os.Getenv("MODEL_ID"),
 		apiKey:        os.Getenv("MODEL_API_KEY"),
+		toolMode:      string(agent.ToolModeAuto),
+		toolTimeout:   2 * time.Minute,
+		auditLog:      audit.DefaultFile,
+		maxToolOutput: tools.DefaultMaxOutputBytes,
+		ui:            "terminal",
+		listen:        "127.0.0.1:8888",
+		historyFile:   ui.DefaultHistoryFile,
+		retry:         agent.DefaultRetryConfig,
 		IOStreams:     streams,
 	}
 }
@@ -49,15 +111,17 @@ func NewInteractOptions(streams genericiooptions.IOStreams) *InteractOptions {
 func NewCmdInteract(streams genericiooptions.IOStreams) *cobra.Command {
 	o := NewInteractOptions(streams)
 	cmd := &cobra.Command{
-		Use:          "interact",
+		Use:          "interact [query]",
 		Short:        "interact",
 		Example:      fmt.Sprintf(interactExample, "kubectl"),
 		SilenceUsage: true,
+		// the subcommands are found before the arguments are taken as the query, see queryAsSubcommand
+		Args: cobra.ArbitraryArgs,
 		Annotations: map[string]string{
 			cobra.CommandDisplayNameAnnotation: "kubectl interact",
 		},
 		RunE: func(c *cobra.Command, args []string) error {
-			if err := o.Complete(); err != nil {
+			if err := o.Complete(args); err != nil {
 				return err
 			}
 			if err := o.Validate(); err != nil {
@@ -71,16 +135,82 @@ func NewCmdInteract(streams genericiooptions.IOStreams) *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVar(&o.modelProvider, "model-provider", o.modelProvider, "The model provider to use, defaults to generic provider")
-	cmd.Flags().StringVar(&o.modelURL, "model-url", o.modelURL, "URL of the model API. This is ignored if model-provider is other than generic")
+	cmd.Flags().StringVar(&o.configFile, "config", "", "Path to the config file declaring the models, their fallback chain and the routing of tasks to them, defaults to ~/.kubectl-interact/config.yaml if it exists. The models it declares take precedence over the model flags")
+	cmd.Flags().StringVar(&o.modelProvider, "model-provider", o.modelProvider, "The model provider to use, defaults to generic provider. generic and openai talk to OpenAI compatible APIs, anthropic to the Anthropic Messages API, replay replays the responses recorded in --cassette")
+	cmd.Flags().StringVar(&o.modelURL, "model-url", o.modelURL, "URL of the model API, e.g. https://granite.example.com/v1. This is ignored if model-provider is other than generic, openai or anthropic")
 	cmd.Flags().StringVar(&o.modelID, "model-id", o.modelID, "ID of the model")
 	cmd.Flags().StringVar(&o.apiKey, "api-key", o.apiKey, "API Key of the model API")
 	cmd.Flags().StringVar(&o.caCert, "ca-cert", o.caCert, "CA Cert path for the model API")
+	cmd.Flags().StringVar(&o.clientCert, "client-cert", o.clientCert, "Client certificate path authenticating with the model API over mTLS, requires --client-key")
+	cmd.Flags().StringVar(&o.clientKey, "client-key", o.clientKey, "Client key path authenticating with the model API over mTLS, requires --client-cert")
+	cmd.Flags().StringVar(&o.proxy, "proxy", o.proxy, "URL of the HTTP proxy to reach the model API through, defaults to HTTPS_PROXY and HTTP_PROXY")
 	cmd.Flags().StringVar(&o.kubeConfig, "kubeconfig", "", "path to the kubeconfig file")
+	cmd.Flags().StringVar(&o.policyFile, "policy", "", "Path to the policy file deciding which tool calls run without confirmation, defaults to ~/.kubectl-interact/policy.yaml if it exists")
+	cmd.Flags().StringVar(&o.toolMode, "tool-mode", o.toolMode, "How tool calls are exchanged with the model. One of auto, native or shim. auto uses native function calling for models known to support it and the ReAct JSON shim otherwise")
+	cmd.Flags().DurationVar(&o.toolTimeout, "tool-timeout", o.toolTimeout, "Maximum duration of a single tool call, e.g. a kubectl command. Zero means no timeout")
+	cmd.Flags().IntVar(&o.retry.MaxAttempts, "retry-max-attempts", o.retry.MaxAttempts, "Maximum number of attempts of a request to the model API failing with a rate limit, server or connection error. 1 disables retries")
+	cmd.Flags().DurationVar(&o.retry.InitialBackoff, "retry-initial-backoff", o.retry.InitialBackoff, "Delay before retrying a failed request to the model API, doubled on every attempt")
+	cmd.Flags().DurationVar(&o.retry.MaxBackoff, "retry-max-backoff", o.retry.MaxBackoff, "Maximum delay before retrying a failed request to the model API. Requests are not retried if the server asks to wait longer with Retry-After")
+	cmd.Flags().StringVar(&o.pricesFile, "prices", "", "Path to the price table estimating the cost of the tokens used, defaults to ~/.kubectl-interact/prices.yaml if it exists")
+	cmd.Flags().IntVar(&o.tokenBudget, "token-budget", o.tokenBudget, "Maximum number of tokens the session may use, the conversation stops once it is exhausted. Zero means no limit")
+	cmd.Flags().IntVar(&o.maxToolOutput, "max-tool-output", o.maxToolOutput, "Size in bytes above which command outputs are truncated before they are sent to the model, which can read the rest on demand. Zero sends outputs whole")
+	cmd.Flags().IntVar(&o.contextLimit, "context-limit", o.contextLimit, "Number of tokens of the context window of the model, earlier tool outputs are summarized as the conversation nears it. Zero uses the context length reported by the model API, or 32768 if it reports none")
+	cmd.Flags().StringVar(&o.cassette, "cassette", o.cassette, "Path to the cassette recording the requests sent to the model and its responses, to attach to bug reports or to replay with --model-provider=replay. Tool outputs are recorded as sent to the model, after redaction")
+	cmd.Flags().StringVar(&o.approve, "approve", o.approve, "How the tool calls the policy asks confirmation for are decided. One of ask, never, reads (approves read-only calls) or all. Defaults to ask, or to never with --quiet and when a query is given with piped input as there is no one to ask")
+	cmd.Flags().BoolVarP(&o.quiet, "quiet", "q", o.quiet, "Print only the answer of the model to the query given as argument, and the errors to stderr")
+	cmd.Flags().StringVarP(&o.output, "output", "o", o.output, "Output format, json or jsonl to emit the conversation as JSON events for other programs instead of rendering it. jsonl writes a line per event as it happens and reads the input line by line, e.g. the queries and the confirmations. json writes an array once the query given as argument is answered, it requires --approve other than ask as the confirmations can not be answered")
+	cmd.Flags().StringVar(&o.ui, "ui", o.ui, "User interface, terminal or web. web serves the conversation to browsers on --listen, the URL to open is printed on start")
+	cmd.Flags().StringVar(&o.listen, "listen", o.listen, "Address the web UI listens on. The URL carries a token, but other hosts can see the conversation if it is not a loopback address")
+	cmd.Flags().StringVar(&o.historyFile, "history", o.historyFile, "Path to the history of the queries, recalled with the arrows and searched with Ctrl-R. Empty keeps the history of the session only")
+	cmd.Flags().StringVar(&o.auditLog, "audit-log", o.auditLog, "Path to the audit log recording every tool call, its approval and its outcome. Empty disables the audit log")
+	cmd.Flags().StringSliceVar(&o.redactAllowKeys, "redact-allow-key", o.redactAllowKeys, "Glob patterns of field and variable names whose values are not redacted from tool output sent to the model, e.g. '*_TOKEN_PATH'")
+	cmd.Flags().StringSliceVar(&o.redactAllowSecrets, "redact-allow-secret", o.redactAllowSecrets, "Glob patterns of the 'namespace/name' of Secrets whose data is not redacted from tool output sent to the model, e.g. 'dev/*'")
+
+	cmd.AddCommand(queryAsSubcommand(cmd, NewCmdAudit(streams)))
+	// the default help and completion commands would take the queries starting with these words, such as
+	// "help me find the crashing pods", the help is shown with --help
+	cmd.CompletionOptions.DisableDefaultCmd = true
+	cmd.SetHelpCommand(&cobra.Command{Use: "__help", Hidden: true})
 	return cmd
 }
 
-func (o *InteractOptions) Complete() error {
+// queryAsSubcommand hands the queries starting with the name of the subcommand, such as
+// `kubectl interact audit the rbac of the default namespace`, back to the interact command. cobra finds the
+// subcommand by the first word, it runs only if no other words are given.
+func queryAsSubcommand(root, sub *cobra.Command) *cobra.Command {
+	run := sub.RunE
+	// the flags are parsed below, as they may be the flags of the interact command
+	sub.DisableFlagParsing = true
+	sub.Args = cobra.ArbitraryArgs
+	sub.RunE = func(c *cobra.Command, args []string) error {
+		subErr := c.Flags().Parse(args)
+		if subErr == nil && c.Flags().NArg() == 0 {
+			if help, _ := c.Flags().GetBool("help"); help {
+				return c.Help()
+			}
+			return run(c, nil)
+		}
+		if err := root.ParseFlags(args); err == nil && root.Flags().NArg() > 0 {
+			return root.RunE(root, append([]string{sub.Name()}, root.Flags().Args()...))
+		}
+		if subErr != nil {
+			return subErr
+		}
+		return fmt.Errorf("unknown command %q for %q", c.Flags().Arg(0), c.CommandPath())
+	}
+	return sub
+}
+
+func (o *InteractOptions) Complete(args []string) error {
+	o.query = strings.TrimSpace(strings.Join(args, " "))
+	if o.approve == "" {
+		o.approve = string(agent.ApproveAsk)
+		// confirmations are read from stdin, which is not a terminal in scripts
+		if o.quiet || (o.query != "" && !isTerminal(o.In)) {
+			o.approve = string(agent.ApproveNever)
+		}
+	}
+
 	kubeconfigPath := o.kubeConfig
 	if kubeconfigPath == "" {
 		// Check environment variable
@@ -96,13 +226,168 @@ func (o *InteractOptions) Complete() error {
 	}
 	o.kubeConfig = kubeconfigPath
 
+	kubeContext, namespace, err := currentKubeContext(o.kubeConfig)
+	if err != nil {
+		klog.Warningf("error reading current context from kubeconfig %q: %v", o.kubeConfig, err)
+	}
+	o.kubeContext = kubeContext
+	o.namespace = namespace
+
+	configFile := o.configFile
+	if configFile == "" {
+		if _, err := os.Stat(config.DefaultFile); err == nil {
+			configFile = config.DefaultFile
+		}
+	}
+	if configFile != "" {
+		c, err := config.Load(configFile)
+		if err != nil {
+			return err
+		}
+		o.config = c
+	}
+
+	policyFile := o.policyFile
+	if policyFile == "" {
+		if _, err := os.Stat(defaultPolicyFile); err == nil {
+			policyFile = defaultPolicyFile
+		}
+	}
+	if policyFile != "" {
+		p, err := policy.Load(policyFile)
+		if err != nil {
+			return err
+		}
+		o.policy = p
+	}
+
+	pricesFile := o.pricesFile
+	if pricesFile == "" {
+		if _, err := os.Stat(usage.DefaultPricesFile); err == nil {
+			pricesFile = usage.DefaultPricesFile
+		}
+	}
+	if pricesFile != "" {
+		prices, err := usage.LoadPrices(pricesFile)
+		if err != nil {
+			return err
+		}
+		o.prices = prices
+	}
+
+	redactor, err := redact.New(redact.Options{AllowKeys: o.redactAllowKeys, AllowSecrets: o.redactAllowSecrets})
+	if err != nil {
+		return err
+	}
+	o.redactor = redactor
+
 	return nil
 }
 
+// currentKubeContext returns the current context of the kubeconfig and the namespace it points to.
+func currentKubeContext(kubeconfig string) (string, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.Precedence = filepath.SplitList(kubeconfig)
+	config, err := rules.Load()
+	if err != nil {
+		return "", "default", err
+	}
+	namespace := "default"
+	if c, ok := config.Contexts[config.CurrentContext]; ok && c.Namespace != "" {
+		namespace = c.Namespace
+	}
+	return config.CurrentContext, namespace, nil
+}
+
 func (o *InteractOptions) Validate() error {
+	if _, err := agent.ParseToolMode(o.toolMode); err != nil {
+		return err
+	}
+	if _, err := agent.ParseApproval(o.approve); err != nil {
+		return err
+	}
+	if o.quiet && o.query == "" {
+		return fmt.Errorf("--quiet requires a query")
+	}
+	if o.output != "" && o.output != "json" && o.output != "jsonl" {
+		return fmt.Errorf("invalid output format %q, must be json or jsonl", o.output)
+	}
+	// the json array is written once the session ends, a program could not answer the prompts it did not see
+	if o.output == "json" && (o.query == "" || o.approve == string(agent.ApproveAsk)) {
+		return fmt.Errorf("--output=json requires a query and --approve other than ask, use --output=jsonl for interactive sessions")
+	}
+	if o.quiet && o.output != "" {
+		return fmt.Errorf("--quiet and --output can not be used together")
+	}
+	switch o.ui {
+	case "terminal":
+	case "web":
+		if o.query != "" || o.quiet || o.output != "" {
+			return fmt.Errorf("--ui=web can not be used with a query, --quiet or --output")
+		}
+	default:
+		return fmt.Errorf("invalid user interface %q, must be terminal or web", o.ui)
+	}
+	if o.toolTimeout < 0 {
+		return fmt.Errorf("--tool-timeout must not be negative")
+	}
+	if o.tokenBudget < 0 {
+		return fmt.Errorf("--token-budget must not be negative")
+	}
+	if o.maxToolOutput < 0 {
+		return fmt.Errorf("--max-tool-output must not be negative")
+	}
+	if o.contextLimit < 0 {
+		return fmt.Errorf("--context-limit must not be negative")
+	}
+	if o.retry.MaxAttempts < 1 {
+		return fmt.Errorf("--retry-max-attempts must be at least 1")
+	}
+	if o.retry.InitialBackoff < 0 || o.retry.MaxBackoff < o.retry.InitialBackoff {
+		return fmt.Errorf("--retry-initial-backoff must not be negative nor greater than --retry-max-backoff")
+	}
+	if o.modelProvider == "replay" && o.cassette == "" {
+		return fmt.Errorf("--model-provider=replay requires --cassette")
+	}
+	// the models of the config file are not checked, as requests fall back to the next model if one is down
+	if o.modelProvider == "anthropic" && !o.configuresModels() {
+		if err := o.clientOptions().ValidateAnthropic(); err != nil {
+			return err
+		}
+	}
+	if o.openAICompatible() && !o.configuresModels() {
+		if err := o.clientOptions().Validate(); err != nil {
+			return err
+		}
+		// fail before the session starts, rather than on the first query
+		if err := providers.CheckEndpoint(context.TODO(), o.clientOptions()); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// configuresModels returns true if the config file declares the models, rather than the model flags.
+func (o *InteractOptions) configuresModels() bool {
+	return o.config != nil && len(o.config.Models) > 0
+}
+
+// openAICompatible returns true if the model provider is configured with the model URL, API key and certificates.
+func (o *InteractOptions) openAICompatible() bool {
+	return o.modelProvider == "generic" || o.modelProvider == "openai"
+}
+
+func (o *InteractOptions) clientOptions() providers.ClientOptions {
+	return providers.ClientOptions{
+		BaseURL:    o.modelURL,
+		APIKey:     o.apiKey,
+		CACert:     o.caCert,
+		ClientCert: o.clientCert,
+		ClientKey:  o.clientKey,
+		Proxy:      o.proxy,
+	}
+}
+
 func (o *InteractOptions) Run() error {
 	err := o.Generate(context.TODO())
 	if err != nil {
@@ -112,37 +397,102 @@ func (o *InteractOptions) Run() error {
 }
 
 func (o *InteractOptions) Generate(ctx context.Context) error {
-	var llmClient gollm.Client
-	if o.modelProvider == "generic" || o.modelProvider == "openai" {
-		client, err := gollm.NewClient(ctx, "custom-openai")
+	clients, err := o.newLLMClients(ctx)
+	if err != nil {
+		return err
+	}
+	defer clients.Close()
+	if o.cassette != "" && o.modelProvider != "replay" {
+		clients.record(o.cassette)
+	}
+
+	query, err := o.oneShotQuery()
+	if err != nil {
+		return err
+	}
+
+	doc := ui.NewDocument(o.IOStreams)
+
+	var u ui.UI
+	switch {
+	case o.output != "":
+		jsonUI := ui.NewJSONUI(doc, o.IOStreams, o.output == "jsonl")
+		defer func() {
+			if err := jsonUI.Close(); err != nil {
+				klog.Warningf("error writing the events: %v", err)
+			}
+		}()
+		u = jsonUI
+	case o.quiet:
+		u = ui.NewQuietUI(doc)
+	case o.ui == "web":
+		webUI, err := ui.NewWebUI(doc, o.listen)
 		if err != nil {
-			return fmt.Errorf("creating llm client: %w", err)
+			return err
 		}
-		// TODO: if generic is passed, configure ca-cert
-
-		llmClient = client
-	} else {
-		client, err := gollm.NewClient(ctx, o.modelProvider)
+		defer func() {
+			if err := webUI.Close(); err != nil {
+				klog.Warningf("error stopping the web UI: %v", err)
+			}
+		}()
+		fmt.Fprintf(o.ErrOut, "Open %s to interact, the session ends with exit.\n", webUI.URL())
+		u = webUI
+	default:
+		history, err := ui.LoadHistory(o.historyFile)
+		if err != nil {
+			klog.Warningf("error loading the history: %v", err)
+		}
+		completer := completion.New(completion.Options{
+			Kubeconfig: o.kubeConfig,
+			Context:    o.kubeContext,
+			Namespace:  o.namespace,
+			Commands:   replCommands,
+		})
+		u, err = ui.NewTerminalUI(doc, history, completer)
 		if err != nil {
-			return fmt.Errorf("creating llm client: %w", err)
+			return err
 		}
-		llmClient = client
 	}
 
-	defer llmClient.Close()
+	model := clients.model()
+	toolMode := o.resolveToolMode(clients)
+	klog.V(1).Infof("Using %s tool mode for model %q", toolMode, model)
 
-	doc := ui.NewDocument(o.IOStreams)
-
-	u, err := ui.NewTerminalUI(doc)
+	sessionID := fmt.Sprintf("%s-%d", time.Now().Format("20060102-150405"), os.Getpid())
+	snapshots, err := snapshot.NewStore(snapshot.DefaultDir, sessionID)
 	if err != nil {
-		return err
+		klog.Warningf("snapshots are disabled: %v", err)
+	}
+
+	var auditLog *audit.Log
+	if o.auditLog != "" {
+		auditLog, err = audit.Open(o.auditLog, sessionID)
+		if err != nil {
+			return err
+		}
+		defer auditLog.Close()
 	}
 
 	conversation := &agent.Conversation{
-		Model:      o.modelID,
-		Kubeconfig: o.kubeConfig,
-		LLM:        llmClient,
-		Tools:      tools.Default(),
+		Model:         model,
+		Kubeconfig:    o.kubeConfig,
+		LLM:           clients.chat,
+		SummaryLLM:    clients.summarize,
+		Tools:         tools.Default(),
+		ToolMode:      toolMode,
+		Approve:       agent.Approval(o.approve),
+		KubeContext:   o.kubeContext,
+		Namespace:     o.namespace,
+		Policy:        o.policy,
+		ToolTimeout:   o.toolTimeout,
+		Snapshots:     snapshots,
+		Redactor:      o.redactor,
+		Audit:         auditLog,
+		Retry:         o.retry,
+		Prices:        o.prices,
+		TokenBudget:   o.tokenBudget,
+		MaxToolOutput: o.maxToolOutput,
+		ContextLimit:  o.resolveContextLimit(ctx, clients.endpoints),
 	}
 
 	err = conversation.Init(ctx, doc, o.IOStreams)
@@ -152,17 +502,54 @@ func (o *InteractOptions) Generate(ctx context.Context) error {
 	defer conversation.Close()
 
 	chatSession := session{
-		model:        o.modelID,
+		model:        model,
+		routes:       clients.routes,
 		doc:          doc,
 		ui:           u,
 		conversation: conversation,
-		LLM:          llmClient,
+		LLM:          clients.chat,
 		streams:      o.IOStreams,
 	}
 
+	if query != "" {
+		return chatSession.answerOnce(ctx, query)
+	}
 	return chatSession.repl(ctx)
 }
 
+// oneShotQuery returns the query given on the command line along with the input piped to the command, if any.
+// The input is redacted and truncated as the tool outputs are.
+func (o *InteractOptions) oneShotQuery() (string, error) {
+	if o.query == "" || isTerminal(o.In) {
+		return o.query, nil
+	}
+	b, err := io.ReadAll(o.In)
+	if err != nil {
+		return "", fmt.Errorf("reading input: %w", err)
+	}
+	input := strings.TrimSpace(string(b))
+	if input == "" {
+		return o.query, nil
+	}
+	if o.redactor != nil {
+		report := redact.Report{}
+		input = o.redactor.Text(input, report)
+		if len(report) > 0 {
+			klog.Infof("redacted %s from the input", report)
+		}
+	}
+	if o.maxToolOutput > 0 {
+		input = tools.Excerpt(input, o.maxToolOutput)
+	}
+	return fmt.Sprintf("%s\n\nThe following input was given along with the question:\n```\n%s\n```", o.query, input), nil
+}
+
+// isTerminal returns true if the reader is a terminal, rather than a pipe or a file.
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
 // session represents the user chat session (interactive/non-interactive both)
 type session struct {
 	model           string
@@ -172,8 +559,14 @@ type session struct {
 	availableModels []string
 	LLM             gollm.Client
 	streams         genericiooptions.IOStreams
+
+	// routes are the chains of models serving the tasks, nil unless the config file declares models
+	routes map[config.Task]*providers.Chain
 }
 
+// replCommands are the commands of the interactive session, any other input is a query.
+var replCommands = []string{"reset", "clear", "usage", "rollback", "model", "models", "exit", "quit"}
+
 // repl is a read-eval-print loop for the chat session.
 func (s *session) repl(ctx context.Context) error {
 	query := "Hey there, what can I help you with today?"
@@ -205,6 +598,14 @@ func (s *session) repl(ctx context.Context) error {
 			}
 		case query == "clear":
 			s.ui.ClearScreen()
+		case query == "usage":
+			s.conversation.ShowUsage()
+		case query == "rollback":
+			if err := s.conversation.Rollback(ctx); err != nil {
+				errorBlock := &ui.ErrorBlock{}
+				errorBlock.SetText(fmt.Sprintf("Error: %v\n", err), s.streams)
+				s.doc.AddBlock(errorBlock, s.streams)
+			}
 		case query == "exit" || query == "quit":
 			// s.ui.RenderOutput(ctx, "Allright...bye.\n")
 			return nil
@@ -220,8 +621,25 @@ func (s *session) repl(ctx context.Context) error {
 	}
 }
 
+// answerOnce answers the query given on the command line, without greeting nor waiting for further queries.
+func (s *session) answerOnce(ctx context.Context, query string) error {
+	return s.conversation.RunOneRound(ctx, query)
+}
+
+// listModels lists the models of the provider, along with their capabilities if the provider reports them.
 func (s *session) listModels(ctx context.Context) ([]string, error) {
 	if s.availableModels == nil {
+		if lister, ok := s.LLM.(providers.ModelInfoLister); ok {
+			models, err := lister.ListModelInfo(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("listing models: %w", err)
+			}
+			s.availableModels = []string{}
+			for _, m := range models {
+				s.availableModels = append(s.availableModels, m.String())
+			}
+			return s.availableModels, nil
+		}
 		modelNames, err := s.LLM.ListModels(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("listing models: %w", err)
@@ -235,7 +653,11 @@ func (s *session) answerQuery(ctx context.Context, query string) error {
 	switch {
 	case query == "model":
 		infoBlock := &ui.AgentTextBlock{}
-		infoBlock.AppendText(fmt.Sprintf("Current model is `%s`\n", s.model), s.streams)
+		if s.routes != nil {
+			infoBlock.AppendText(describeRoutes(s.routes), s.streams)
+		} else {
+			infoBlock.AppendText(fmt.Sprintf("Current model is `%s`\n", s.model), s.streams)
+		}
 		s.doc.AddBlock(infoBlock, s.streams)
 
 	case query == "models":
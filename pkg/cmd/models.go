@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/kubectl-ai/gollm"
+	"k8s.io/klog/v2"
+
+	"github.com/ardaguclu/kubectl-interact/pkg/agent"
+	"github.com/ardaguclu/kubectl-interact/pkg/config"
+	providers "github.com/ardaguclu/kubectl-interact/pkg/providers"
+)
+
+// llmClients are the clients serving the tasks of the conversation.
+type llmClients struct {
+	chat      gollm.Client
+	summarize gollm.Client
+
+	// routes are the chains serving the tasks, nil unless the config file declares models
+	routes map[config.Task]*providers.Chain
+
+	// endpoints are the endpoints serving the chat, in the order they are tried
+	endpoints []*providers.Endpoint
+
+	all []gollm.Client
+}
+
+func (c *llmClients) Close() {
+	for _, client := range c.all {
+		if err := client.Close(); err != nil {
+			klog.Warningf("error closing llm client: %v", err)
+		}
+	}
+}
+
+// newLLMClients creates the clients of the models declared in the config file, or else of the model flags.
+func (o *InteractOptions) newLLMClients(ctx context.Context) (*llmClients, error) {
+	if !o.configuresModels() {
+		client, err := o.newFlagsClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("creating llm client: %w", err)
+		}
+		return &llmClients{
+			chat:      client,
+			endpoints: []*providers.Endpoint{{Name: o.modelProvider, Client: client, Model: o.modelID}},
+			all:       []gollm.Client{client},
+		}, nil
+	}
+
+	clients := &llmClients{routes: map[config.Task]*providers.Chain{}}
+	byName := map[string]gollm.Client{}
+	for _, task := range config.Tasks {
+		var endpoints []*providers.Endpoint
+		for _, m := range o.config.Route(task) {
+			client, ok := byName[m.Name]
+			if !ok {
+				var err error
+				client, err = newModelClient(ctx, m)
+				if err != nil {
+					clients.Close()
+					return nil, fmt.Errorf("creating llm client of model %q: %w", m.Name, err)
+				}
+				byName[m.Name] = client
+				clients.all = append(clients.all, client)
+			}
+			endpoints = append(endpoints, &providers.Endpoint{Name: m.Name, Client: client, Model: m.Model, Timeout: m.Timeout.Duration})
+		}
+		chain, err := providers.NewChain(endpoints...)
+		if err != nil {
+			clients.Close()
+			return nil, fmt.Errorf("routing task %q: %w", task, err)
+		}
+		clients.routes[task] = chain
+	}
+	clients.chat = clients.routes[config.TaskChat]
+	clients.summarize = clients.routes[config.TaskSummarize]
+	clients.endpoints = clients.routes[config.TaskChat].Endpoints()
+	return clients, nil
+}
+
+// newFlagsClient creates the client of the model configured with the flags.
+func (o *InteractOptions) newFlagsClient(ctx context.Context) (gollm.Client, error) {
+	switch {
+	case o.modelProvider == "replay":
+		client, err := providers.NewReplayClient(o.cassette)
+		if err != nil {
+			return nil, err
+		}
+		if o.modelID == "" {
+			o.modelID = client.Model()
+		}
+		return client, nil
+	case o.modelProvider == "anthropic":
+		return providers.NewAnthropicClient(ctx, o.clientOptions())
+	case o.openAICompatible():
+		return providers.NewOpenAIClient(ctx, o.clientOptions())
+	}
+	return gollm.NewClient(ctx, o.modelProvider)
+}
+
+// newModelClient creates the client of a model declared in the config file.
+func newModelClient(ctx context.Context, m *config.Model) (gollm.Client, error) {
+	opts := providers.ClientOptions{
+		BaseURL:    m.URL,
+		APIKey:     m.Key(),
+		CACert:     m.CACert,
+		ClientCert: m.ClientCert,
+		ClientKey:  m.ClientKey,
+		Proxy:      m.Proxy,
+	}
+	switch {
+	case m.Provider == "anthropic":
+		return providers.NewAnthropicClient(ctx, opts)
+	case m.OpenAICompatible():
+		return providers.NewOpenAIClient(ctx, opts)
+	}
+	return gollm.NewClient(ctx, m.Provider)
+}
+
+// record records the chats and completions of the clients to the cassette of the given file.
+func (c *llmClients) record(filename string) {
+	cassette := providers.NewCassette(filename)
+	c.chat = cassette.Record(c.chat)
+	if c.summarize != nil {
+		c.summarize = cassette.Record(c.summarize)
+	}
+}
+
+// model returns the model answering the chat first.
+func (c *llmClients) model() string {
+	return c.endpoints[0].Model
+}
+
+// resolveToolMode resolves the tool mode, native function calling is only used if every model of the chat supports it.
+func (o *InteractOptions) resolveToolMode(clients *llmClients) agent.ToolMode {
+	if clients.routes == nil {
+		return agent.ResolveToolMode(agent.ToolMode(o.toolMode), o.modelProvider, o.modelID)
+	}
+	for _, m := range o.config.Route(config.TaskChat) {
+		if mode := agent.ResolveToolMode(agent.ToolMode(o.toolMode), m.Provider, m.Model); mode != agent.ToolModeNative {
+			return mode
+		}
+	}
+	return agent.ToolModeNative
+}
+
+// resolveContextLimit returns the configured context limit, or the smallest context length the model APIs
+// report for the models of the chat.
+func (o *InteractOptions) resolveContextLimit(ctx context.Context, endpoints []*providers.Endpoint) int {
+	if o.contextLimit > 0 {
+		return o.contextLimit
+	}
+	limit := 0
+	for _, e := range endpoints {
+		lister, ok := e.Client.(providers.ModelInfoLister)
+		if !ok {
+			continue
+		}
+		models, err := lister.ListModelInfo(ctx)
+		if err != nil {
+			klog.V(1).Infof("error listing the models of %s to find the context length: %v", e, err)
+		}
+		for _, m := range models {
+			if m.ID == e.Model && m.ContextLength > 0 && (limit == 0 || m.ContextLength < limit) {
+				limit = m.ContextLength
+			}
+		}
+	}
+	if limit == 0 {
+		return agent.DefaultContextLimit
+	}
+	return limit
+}
+
+// describeRoutes describes the chains serving the tasks, marking the models which served the last requests.
+func describeRoutes(routes map[config.Task]*providers.Chain) string {
+	var sb strings.Builder
+	sb.WriteString("\n  Model routes:\n")
+	for _, task := range config.Tasks {
+		if chain, ok := routes[task]; ok {
+			fmt.Fprintf(&sb, "  %s: %s\n", task, chain)
+		}
+	}
+	return sb.String()
+}
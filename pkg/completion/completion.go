@@ -0,0 +1,296 @@
+// Package completion completes the queries entered in the terminal: the commands of the interactive session,
+// and the namespaces, kube contexts and resource names of the cluster, in the manner of kubectl's completion.
+//
+// The word being completed is matched against the word before it: the names of the resources follow their
+// type, e.g. "pod" or "deploy", or prefix them as in "deploy/nginx", the namespaces follow "namespace" or "-n"
+// and the kube contexts follow "context". Other words are matched against the names of the common workloads,
+// the namespaces and the kube contexts.
+package completion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ardaguclu/kubectl-interact/pkg/ui"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+// cacheTTL is how long the names listed from the cluster are reused, so that completing does not list them on
+// every Tab while the resources created meanwhile still show up soon.
+const cacheTTL = 30 * time.Second
+
+// requestTimeout bounds the requests to the cluster, the prompt waits for them.
+const requestTimeout = 3 * time.Second
+
+// maxNames is the number of names listed per resource and namespace.
+const maxNames = 500
+
+// defaultResources are the resources whose names complete the words which do not follow a resource type.
+var defaultResources = []string{"pods", "deployments", "statefulsets", "daemonsets", "services"}
+
+// namespaceWords and contextWords are the words the namespaces and the kube contexts follow.
+var (
+	namespaceWords = []string{"namespace", "namespaces", "ns", "-n", "--namespace"}
+	contextWords   = []string{"context", "contexts", "--context"}
+)
+
+// Options configure the completer.
+type Options struct {
+	// Kubeconfig is the path to the kubeconfig, or a list of paths.
+	Kubeconfig string
+
+	// Context and Namespace are the kube context the names are listed from and its namespace.
+	Context   string
+	Namespace string
+
+	// Commands are the commands of the interactive session, they complete the first word.
+	Commands []string
+}
+
+// Completer completes the words of the queries.
+type Completer struct {
+	options Options
+
+	// clients are created on the first completion needing them, so that an unreachable cluster does not delay the
+	// start of the session
+	clients    *kubeClients
+	clientsErr error
+
+	// unreachableUntil is set once the cluster could not be reached, it is not asked again until then so that
+	// every Tab does not wait for the requests to time out
+	unreachableUntil time.Time
+
+	// cache are the names listed, by resource and namespace
+	cache map[string]cacheEntry
+}
+
+var _ ui.Completer = &Completer{}
+
+type kubeClients struct {
+	dynamic   dynamic.Interface
+	discovery discovery.DiscoveryInterface
+	mapper    meta.RESTMapper
+
+	// discovered is set once the API groups were discovered
+	discovered bool
+}
+
+type cacheEntry struct {
+	names   []string
+	expires time.Time
+}
+
+func New(options Options) *Completer {
+	return &Completer{options: options, cache: map[string]cacheEntry{}}
+}
+
+func (c *Completer) Complete(line string) []string {
+	fields := strings.Fields(line)
+	word := ""
+	if len(fields) > 0 && !strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\n") {
+		word = fields[len(fields)-1]
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 0 {
+		if commands := matching(c.options.Commands, word); len(commands) > 0 {
+			return commands
+		}
+	}
+
+	namespace := c.options.Namespace
+	for i := 0; i+1 < len(fields); i++ {
+		if slices.Contains(namespaceWords, strings.ToLower(fields[i])) {
+			namespace = fields[i+1]
+		}
+	}
+	previous := ""
+	if len(fields) > 0 {
+		previous = strings.ToLower(fields[len(fields)-1])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	switch {
+	case slices.Contains(namespaceWords, previous):
+		return matching(c.names(ctx, "namespaces", namespace), word)
+	case slices.Contains(contextWords, previous):
+		return matching(c.contexts(), word)
+	case strings.Contains(word, "/"):
+		resource, _, _ := strings.Cut(word, "/")
+		var completions []string
+		for _, name := range c.names(ctx, resource, namespace) {
+			completions = append(completions, resource+"/"+name)
+		}
+		return matching(completions, word)
+	case previous != "" && c.isResource(previous):
+		return matching(c.names(ctx, previous, namespace), word)
+	case word == "":
+		// listing every name would not help
+		return nil
+	}
+
+	var completions []string
+	for _, resource := range defaultResources {
+		completions = append(completions, c.names(ctx, resource, namespace)...)
+	}
+	completions = append(completions, c.names(ctx, "namespaces", namespace)...)
+	completions = append(completions, c.contexts()...)
+	return matching(completions, word)
+}
+
+// matching returns the sorted words starting with the prefix, without duplicates.
+func matching(words []string, prefix string) []string {
+	var matches []string
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			matches = append(matches, w)
+		}
+	}
+	slices.Sort(matches)
+	return slices.Compact(matches)
+}
+
+// contexts returns the kube contexts of the kubeconfig.
+func (c *Completer) contexts() []string {
+	config, err := c.loadingRules().Load()
+	if err != nil {
+		klog.V(1).Infof("error loading kubeconfig for completion: %v", err)
+		return nil
+	}
+	var contexts []string
+	for name := range config.Contexts {
+		contexts = append(contexts, name)
+	}
+	return contexts
+}
+
+func (c *Completer) loadingRules() *clientcmd.ClientConfigLoadingRules {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if c.options.Kubeconfig != "" {
+		rules.Precedence = filepath.SplitList(c.options.Kubeconfig)
+	}
+	return rules
+}
+
+func (c *Completer) kubeClients() (*kubeClients, error) {
+	if c.clients != nil || c.clientsErr != nil {
+		return c.clients, c.clientsErr
+	}
+	c.clients, c.clientsErr = c.newKubeClients()
+	if c.clientsErr != nil {
+		klog.V(1).Infof("completion of resource names is disabled: %v", c.clientsErr)
+	}
+	return c.clients, c.clientsErr
+}
+
+func (c *Completer) newKubeClients() (*kubeClients, error) {
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(c.loadingRules(), &clientcmd.ConfigOverrides{CurrentContext: c.options.Context})
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading kubeconfig: %w", err)
+	}
+	// discovery does not take a context, the timeout bounds its requests too
+	config.Timeout = requestTimeout
+
+	clients := &kubeClients{}
+	if clients.dynamic, err = dynamic.NewForConfig(config); err != nil {
+		return nil, fmt.Errorf("creating dynamic client: %w", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating discovery client: %w", err)
+	}
+	clients.discovery = discoveryClient
+	cached := memory.NewMemCacheClient(discoveryClient)
+	clients.mapper = restmapper.NewShortcutExpander(restmapper.NewDeferredDiscoveryRESTMapper(cached), cached, func(warning string) {
+		klog.V(1).Info(warning)
+	})
+	return clients, nil
+}
+
+// mapping resolves a resource, kind or short name such as "deployments", "deployment" or "deploy", optionally
+// qualified by its group as in "deployments.apps".
+func (c *Completer) mapping(resource string) (*meta.RESTMapping, error) {
+	clients, err := c.kubeClients()
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().Before(c.unreachableUntil) {
+		return nil, fmt.Errorf("the cluster is unreachable")
+	}
+	if !clients.discovered {
+		// the cached discovery logs its failures as errors, which would garble the prompt, the cluster is asked
+		// directly first
+		if _, err := clients.discovery.ServerGroups(); err != nil {
+			c.unreachableUntil = time.Now().Add(cacheTTL)
+			return nil, err
+		}
+		clients.discovered = true
+	}
+	gvr, err := clients.mapper.ResourceFor(schema.ParseGroupResource(strings.ToLower(resource)).WithVersion(""))
+	if err != nil {
+		if !meta.IsNoMatchError(err) {
+			c.unreachableUntil = time.Now().Add(cacheTTL)
+		}
+		return nil, err
+	}
+	gvk, err := clients.mapper.KindFor(gvr)
+	if err != nil {
+		return nil, err
+	}
+	return clients.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
+// isResource returns true if the word is a resource of the cluster, rather than any word of the query.
+func (c *Completer) isResource(word string) bool {
+	_, err := c.mapping(word)
+	return err == nil
+}
+
+// names returns the names of the resources, in the namespace if they are namespaced. The names are cached for
+// cacheTTL, failures included, so that a failing cluster is not asked again on every Tab.
+func (c *Completer) names(ctx context.Context, resource, namespace string) []string {
+	mapping, err := c.mapping(resource)
+	if err != nil {
+		klog.V(1).Infof("error resolving resource %q for completion: %v", resource, err)
+		return nil
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		namespace = ""
+	}
+	key := mapping.Resource.String() + "\x00" + namespace
+	if entry, ok := c.cache[key]; ok && time.Now().Before(entry.expires) {
+		return entry.names
+	}
+
+	var names []string
+	list, err := c.clients.dynamic.Resource(mapping.Resource).Namespace(namespace).List(ctx, metav1.ListOptions{Limit: maxNames})
+	if err != nil {
+		klog.V(1).Infof("error listing %s for completion: %v", mapping.Resource.Resource, err)
+		// errors other than the ones of the API server, e.g. timeouts, tell the cluster is unreachable
+		var status apierrors.APIStatus
+		if !errors.As(err, &status) {
+			c.unreachableUntil = time.Now().Add(cacheTTL)
+		}
+	} else {
+		for _, item := range list.Items {
+			names = append(names, item.GetName())
+		}
+	}
+	c.cache[key] = cacheEntry{names: names, expires: time.Now().Add(cacheTTL)}
+	return names
+}
@@ -0,0 +1,180 @@
+// Package config reads the configuration file declaring the model endpoints kubectl interact talks to,
+// and which of them serve each task.
+//
+// Every task is routed to a chain of models, a request falls back to the next model of the chain when
+// the previous one fails or times out:
+//
+//	models:
+//	- name: local
+//	  provider: generic
+//	  url: http://localhost:11434/v1
+//	  model: llama3.1:8b
+//	  timeout: 30s
+//	- name: hosted
+//	  provider: openai
+//	  model: gpt-4o
+//	  apiKeyEnv: OPENAI_API_KEY
+//	- name: claude
+//	  provider: anthropic
+//	  model: claude-sonnet-4-0
+//	  apiKeyEnv: ANTHROPIC_API_KEY
+//	- name: fast
+//	  provider: openai
+//	  model: gpt-4o-mini
+//	routes:
+//	  chat: [local, hosted, claude]
+//	  summarize: [fast, local]
+//
+// The chat task plans, runs the tools and answers, the summarize task summarizes tool outputs to fit the
+// context window. Tasks without a route are served by all the models, in the order they are declared.
+// Commands are classified by parsing them, without asking a model.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/homedir"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultFile is the configuration file used if it exists and none is configured.
+var DefaultFile = filepath.Join(homedir.HomeDir(), ".kubectl-interact", "config.yaml")
+
+// Task is a kind of request sent to the models.
+type Task string
+
+const (
+	// TaskChat plans, calls the tools and answers the user.
+	TaskChat Task = "chat"
+	// TaskSummarize summarizes tool outputs.
+	TaskSummarize Task = "summarize"
+)
+
+// Tasks are the tasks which can be routed.
+var Tasks = []Task{TaskChat, TaskSummarize}
+
+// Model is a model endpoint.
+type Model struct {
+	// Name identifies the model in the routes.
+	Name string `json:"name"`
+
+	// Provider is generic or openai for OpenAI compatible APIs, anthropic for the Anthropic Messages API,
+	// or any other gollm provider. Defaults to generic.
+	Provider string `json:"provider,omitempty"`
+
+	// URL is the base URL of OpenAI compatible APIs, or of a gateway serving the Anthropic API.
+	URL string `json:"url,omitempty"`
+
+	// Model is the ID of the model.
+	Model string `json:"model,omitempty"`
+
+	// APIKey is the API key, APIKeyEnv names the environment variable holding it.
+	APIKey    string `json:"apiKey,omitempty"`
+	APIKeyEnv string `json:"apiKeyEnv,omitempty"`
+
+	CACert     string `json:"caCert,omitempty"`
+	ClientCert string `json:"clientCert,omitempty"`
+	ClientKey  string `json:"clientKey,omitempty"`
+	Proxy      string `json:"proxy,omitempty"`
+
+	// Timeout bounds the time until the model starts answering, before falling back to the next model.
+	// No timeout if zero.
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+}
+
+// Key returns the API key of the model.
+func (m *Model) Key() string {
+	if m.APIKey == "" && m.APIKeyEnv != "" {
+		return os.Getenv(m.APIKeyEnv)
+	}
+	return m.APIKey
+}
+
+// OpenAICompatible returns true if the model is served by an OpenAI compatible API.
+func (m *Model) OpenAICompatible() bool {
+	return m.Provider == "generic" || m.Provider == "openai"
+}
+
+// Config declares the models and routes the tasks to them.
+type Config struct {
+	Models []Model `json:"models,omitempty"`
+
+	// Routes maps tasks to the names of the models serving them, in the order they are tried.
+	Routes map[Task][]string `json:"routes,omitempty"`
+}
+
+// Load reads the configuration from the given YAML file.
+func Load(filename string) (*Config, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, fmt.Errorf("parsing config file %q: %w", filename, err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("config file %q: %w", filename, err)
+	}
+	return c, nil
+}
+
+func (c *Config) validate() error {
+	names := map[string]bool{}
+	for i := range c.Models {
+		m := &c.Models[i]
+		if m.Name == "" {
+			return fmt.Errorf("model %d has no name", i)
+		}
+		if names[m.Name] {
+			return fmt.Errorf("model %q is declared more than once", m.Name)
+		}
+		names[m.Name] = true
+		if m.Provider == "" {
+			m.Provider = "generic"
+		}
+		if m.Timeout.Duration < 0 {
+			return fmt.Errorf("model %q: timeout must not be negative", m.Name)
+		}
+	}
+	for task, route := range c.Routes {
+		if !slices.Contains(Tasks, task) {
+			return fmt.Errorf("unknown task %q, must be one of %v", task, Tasks)
+		}
+		if len(route) == 0 {
+			return fmt.Errorf("the route of task %q is empty", task)
+		}
+		for _, name := range route {
+			if !names[name] {
+				return fmt.Errorf("the route of task %q refers to the undeclared model %q", task, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Route returns the models serving the task, in the order they are tried.
+func (c *Config) Route(task Task) []*Model {
+	route, ok := c.Routes[task]
+	if !ok {
+		// summaries are made by the chat models unless routed elsewhere
+		route, ok = c.Routes[TaskChat]
+	}
+	var models []*Model
+	for i := range c.Models {
+		if !ok || slices.Contains(route, c.Models[i].Name) {
+			models = append(models, &c.Models[i])
+		}
+	}
+	if ok {
+		// follow the order of the route
+		slices.SortStableFunc(models, func(a, b *Model) int {
+			return slices.Index(route, a.Name) - slices.Index(route, b.Name)
+		})
+	}
+	return models
+}
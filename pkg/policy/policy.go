@@ -0,0 +1,276 @@
+// Package policy decides whether a tool call requested by the LLM may run
+// without asking the user.
+//
+// A policy is a list of rules evaluated in order, the first matching rule wins:
+//
+//	rules:
+//	- name: reads
+//	  action: allow
+//	  tools: [kubectl]
+//	  verbs: [get, describe, logs, top, events, explain, api-resources]
+//	  classifications: [read-only]
+//	- name: no-destructive-prod
+//	  action: deny
+//	  verbs: [delete, drain, cordon, scale, patch, replace]
+//	  contexts: ["prod-*"]
+//	default: ask
+//
+// Every field of a rule other than name and action is a list of glob patterns;
+// an empty list matches everything. Classifications match the effect of the
+// command as verified by the tool layer: read-only, mutating or unknown.
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Action is the outcome of evaluating a policy.
+type Action string
+
+const (
+	// ActionAllow runs the tool call without asking.
+	ActionAllow Action = "allow"
+	// ActionDeny refuses to run the tool call.
+	ActionDeny Action = "deny"
+	// ActionAsk asks the user for confirmation.
+	ActionAsk Action = "ask"
+)
+
+// AllNamespaces is the namespace of a request spanning every namespace, e.g. `kubectl get pods -A`.
+const AllNamespaces = "*"
+
+// Rule matches tool calls and assigns them an action.
+type Rule struct {
+	Name            string   `json:"name"`
+	Action          Action   `json:"action"`
+	Tools           []string `json:"tools,omitempty"`
+	Verbs           []string `json:"verbs,omitempty"`
+	Resources       []string `json:"resources,omitempty"`
+	Namespaces      []string `json:"namespaces,omitempty"`
+	Contexts        []string `json:"contexts,omitempty"`
+	Classifications []string `json:"classifications,omitempty"`
+}
+
+// Policy is an ordered list of rules with a fallback action.
+type Policy struct {
+	Rules []Rule `json:"rules,omitempty"`
+
+	// Default is the action used when no rule matches, defaults to ActionAsk.
+	Default Action `json:"default,omitempty"`
+}
+
+// Request describes the tool call being evaluated.
+type Request struct {
+	Tool string
+	// Verb is the kubectl sub command, e.g. "get" or "rollout restart".
+	Verb string
+	// Resources are the resource types targeted by the command, e.g. "pods".
+	Resources []string
+	// Namespace is the targeted namespace, AllNamespaces for requests spanning all namespaces.
+	Namespace string
+	// Context is the kube context the command runs against.
+	Context string
+	// Classification is the verified effect of the command, e.g. "read-only".
+	Classification string
+	// Unresolved is true if the command runs kubectl in a way which can not be resolved, e.g. `$KUBECTL delete ns prod`.
+	// Its verb, resources, namespace, context and effect are unknown, it matches every rule denying or asking for them.
+	Unresolved bool
+}
+
+// Decision is the result of evaluating a request.
+type Decision struct {
+	Action Action
+	// Rule is the matched rule, nil when the default action was applied.
+	Rule *Rule
+}
+
+// RuleName returns the name of the matched rule, or "default" if no rule matched.
+func (d Decision) RuleName() string {
+	if d.Rule == nil {
+		return "default"
+	}
+	if d.Rule.Name == "" {
+		return "unnamed"
+	}
+	return d.Rule.Name
+}
+
+func (d Decision) String() string {
+	return fmt.Sprintf("%s (policy rule %q)", d.Action, d.RuleName())
+}
+
+// Default returns the policy used when no policy file is configured, it asks for every tool call.
+func Default() *Policy {
+	return &Policy{Default: ActionAsk}
+}
+
+// Load reads a policy from the given YAML file.
+func Load(filename string) (*Policy, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy file: %w", err)
+	}
+	p := &Policy{}
+	if err := yaml.UnmarshalStrict(b, p); err != nil {
+		return nil, fmt.Errorf("parsing policy file %q: %w", filename, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("validating policy file %q: %w", filename, err)
+	}
+	return p, nil
+}
+
+// Validate checks the actions and patterns of the policy.
+func (p *Policy) Validate() error {
+	if p.Default == "" {
+		p.Default = ActionAsk
+	}
+	if err := validateAction(p.Default); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for i, r := range p.Rules {
+		if err := validateAction(r.Action); err != nil {
+			return fmt.Errorf("rule %d (%s): %w", i, r.Name, err)
+		}
+		for _, patterns := range [][]string{r.Tools, r.Verbs, r.Resources, r.Namespaces, r.Contexts, r.Classifications} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("rule %d (%s): invalid pattern %q: %w", i, r.Name, pattern, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func validateAction(a Action) error {
+	switch a {
+	case ActionAllow, ActionDeny, ActionAsk:
+		return nil
+	}
+	return fmt.Errorf("invalid action %q, must be one of allow, deny or ask", a)
+}
+
+// Evaluate returns the decision of the first rule matching the request.
+func (p *Policy) Evaluate(req Request) Decision {
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.matches(req) {
+			return Decision{Action: r.Action, Rule: r}
+		}
+	}
+	action := p.Default
+	if action == "" || (action == ActionAllow && req.Unresolved) {
+		action = ActionAsk
+	}
+	return Decision{Action: action}
+}
+
+// EvaluateAll evaluates every request and returns the strictest decision,
+// deny wins over ask which wins over allow.
+func (p *Policy) EvaluateAll(reqs []Request) Decision {
+	var result *Decision
+	for _, req := range reqs {
+		d := p.Evaluate(req)
+		if result == nil || strictness(d.Action) > strictness(result.Action) {
+			result = &d
+		}
+	}
+	if result == nil {
+		return Decision{Action: ActionAsk}
+	}
+	return *result
+}
+
+func strictness(a Action) int {
+	switch a {
+	case ActionAllow:
+		return 0
+	case ActionAsk:
+		return 1
+	}
+	return 2
+}
+
+// matches returns true if the rule matches the request.
+// Rules allowing a request are matched conservatively: every targeted resource
+// has to match and a request spanning all namespaces only matches a rule
+// allowing all namespaces. Rules denying or asking match if any targeted resource matches,
+// or if the targeted resources are unknown, e.g. for `kubectl delete -f prod.yaml`. Unresolved requests only
+// match the rules denying or asking.
+func (r *Rule) matches(req Request) bool {
+	strict := r.Action == ActionAllow
+
+	if req.Unresolved {
+		return !strict && matchAny(r.Tools, req.Tool)
+	}
+
+	if !matchAny(r.Tools, req.Tool) || !matchAny(r.Verbs, req.Verb) || !matchAny(r.Contexts, req.Context) ||
+		!matchAny(r.Classifications, req.Classification) {
+		return false
+	}
+
+	if len(r.Namespaces) > 0 {
+		if req.Namespace == AllNamespaces {
+			if strict && !matchAny(r.Namespaces, AllNamespaces) {
+				return false
+			}
+		} else if !matchAny(r.Namespaces, req.Namespace) {
+			return false
+		}
+	}
+
+	if len(r.Resources) > 0 {
+		if len(req.Resources) == 0 {
+			return !strict
+		}
+		matched := 0
+		for _, resource := range req.Resources {
+			if matchResource(r.Resources, resource) {
+				matched++
+			}
+		}
+		if strict && matched != len(req.Resources) {
+			return false
+		}
+		if matched == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchAny returns true if there are no patterns or value matches one of them.
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchResource matches resource types ignoring case and the plural form, so that
+// a "pods" pattern also matches "pod".
+func matchResource(patterns []string, resource string) bool {
+	resource = strings.ToLower(resource)
+	singular := strings.TrimSuffix(resource, "s")
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		for _, v := range []string{resource, singular, singular + "s"} {
+			if ok, _ := path.Match(pattern, v); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
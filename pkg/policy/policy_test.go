@@ -0,0 +1,111 @@
+package policy
+
+import "testing"
+
+// TestEvaluateUnknownResources checks that commands whose resources are unknown, such as
+// `kubectl delete -f prod.yaml`, do not skip the rules denying or asking for resource types.
+func TestEvaluateUnknownResources(t *testing.T) {
+	p := &Policy{
+		Rules: []Rule{
+			{Name: "no-secret-deletes", Action: ActionDeny, Verbs: []string{"delete"}, Resources: []string{"secrets"}},
+			{Name: "ask-configmap-applies", Action: ActionAsk, Verbs: []string{"apply"}, Resources: []string{"configmaps"}},
+			{Name: "pod-changes", Action: ActionAllow, Resources: []string{"pods"}},
+		},
+		Default: ActionAllow,
+	}
+
+	for _, tc := range []struct {
+		name string
+		req  Request
+		want Action
+		rule string
+	}{
+		{
+			name: "deny with known resources",
+			req:  Request{Tool: "kubectl", Verb: "delete", Resources: []string{"secret"}},
+			want: ActionDeny,
+			rule: "no-secret-deletes",
+		},
+		{
+			name: "deny with unknown resources",
+			req:  Request{Tool: "kubectl", Verb: "delete"},
+			want: ActionDeny,
+			rule: "no-secret-deletes",
+		},
+		{
+			name: "ask with unknown resources",
+			req:  Request{Tool: "kubectl", Verb: "apply"},
+			want: ActionAsk,
+			rule: "ask-configmap-applies",
+		},
+		{
+			name: "allow with unknown resources",
+			req:  Request{Tool: "kubectl", Verb: "patch"},
+			want: ActionAllow,
+			rule: "default",
+		},
+		{
+			name: "other resources",
+			req:  Request{Tool: "kubectl", Verb: "delete", Resources: []string{"pods"}},
+			want: ActionAllow,
+			rule: "pod-changes",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := p.Evaluate(tc.req)
+			if d.Action != tc.want || d.RuleName() != tc.rule {
+				t.Errorf("Evaluate() = %s, want %s (policy rule %q)", d, tc.want, tc.rule)
+			}
+		})
+	}
+}
+
+// TestEvaluateUnresolved checks that commands running kubectl in a way which can not be resolved, e.g. through
+// a variable, match the rules denying or asking whatever their verb and context, and are never allowed.
+func TestEvaluateUnresolved(t *testing.T) {
+	unresolved := Request{Tool: "bash", Context: "dev", Classification: "unknown", Unresolved: true}
+	for _, tc := range []struct {
+		name   string
+		policy *Policy
+		want   Action
+		rule   string
+	}{
+		{
+			name: "deny rule",
+			policy: &Policy{Rules: []Rule{
+				{Name: "no-prod-deletes", Action: ActionDeny, Verbs: []string{"delete"}, Contexts: []string{"prod"}},
+			}, Default: ActionAllow},
+			want: ActionDeny,
+			rule: "no-prod-deletes",
+		},
+		{
+			name: "allow rule",
+			policy: &Policy{Rules: []Rule{
+				{Name: "dev", Action: ActionAllow, Contexts: []string{"dev"}},
+			}, Default: ActionAsk},
+			want: ActionAsk,
+			rule: "default",
+		},
+		{
+			name:   "allow by default",
+			policy: &Policy{Default: ActionAllow},
+			want:   ActionAsk,
+			rule:   "default",
+		},
+		{
+			name: "rule for other tools",
+			policy: &Policy{Rules: []Rule{
+				{Name: "kubectl-deletes", Action: ActionDeny, Tools: []string{"kubectl"}, Verbs: []string{"delete"}},
+			}, Default: ActionAsk},
+			want: ActionAsk,
+			rule: "default",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := tc.policy.Evaluate(unresolved)
+			if d.Action != tc.want || d.RuleName() != tc.rule {
+				t.Errorf("Evaluate() = %s, want %s (policy rule %q)", d, tc.want, tc.rule)
+			}
+		})
+	}
+}
@@ -0,0 +1,737 @@
+package gollm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+
+	"k8s.io/klog/v2"
+
+	"github.com/GoogleCloudPlatform/kubectl-ai/gollm"
+)
+
+// Register the Anthropic provider factory on package initialization.
+func init() {
+	if err := gollm.RegisterProvider("anthropic", newAnthropicClientFactory); err != nil {
+		klog.Fatalf("Failed to register anthropic provider: %v", err)
+	}
+}
+
+const (
+	anthropicBaseURL = "https://api.anthropic.com"
+
+	// anthropicVersion is the version of the Messages API the requests are made against
+	anthropicVersion = "2023-06-01"
+
+	anthropicDefaultModel = "claude-sonnet-4-0"
+
+	// anthropicMaxTokens bounds the length of the answers, the Messages API requires a bound
+	anthropicMaxTokens = 8192
+
+	// statusOverloaded is returned by the Anthropic API when it is temporarily overloaded
+	statusOverloaded = 529
+)
+
+// newAnthropicClientFactory is the factory function for creating Anthropic clients.
+// The endpoint and credentials are read from environment variables, use NewAnthropicClient to configure them.
+func newAnthropicClientFactory(ctx context.Context, _ *url.URL) (gollm.Client, error) {
+	return NewAnthropicClient(ctx, ClientOptions{})
+}
+
+// AnthropicClient implements the gollm.Client interface for the Anthropic Messages API.
+type AnthropicClient struct {
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+}
+
+var _ gollm.Client = &AnthropicClient{}
+
+// NewAnthropicClient creates a new client for the Anthropic Messages API, or a gateway serving it.
+// The API key and endpoint default to the environment variables ANTHROPIC_API_KEY and ANTHROPIC_BASE_URL,
+// the endpoint is the URL the /v1/messages path is appended to.
+func NewAnthropicClient(ctx context.Context, opts ClientOptions) (*AnthropicClient, error) {
+	opts = opts.withAnthropicDefaults()
+	if err := opts.ValidateAnthropic(); err != nil {
+		return nil, err
+	}
+	httpClient, err := opts.httpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := anthropicBaseURL
+	if opts.BaseURL != "" {
+		klog.Infof("Using custom Anthropic endpoint: %s", opts.BaseURL)
+		baseURL = strings.TrimSuffix(strings.TrimSuffix(opts.BaseURL, "/"), "/v1")
+	}
+	return &AnthropicClient{
+		httpClient: httpClient,
+		baseURL:    baseURL,
+		apiKey:     opts.APIKey,
+	}, nil
+}
+
+// withAnthropicDefaults fills in the unset options from the environment.
+func (o ClientOptions) withAnthropicDefaults() ClientOptions {
+	if o.BaseURL == "" {
+		o.BaseURL = os.Getenv("ANTHROPIC_BASE_URL")
+	}
+	if o.APIKey == "" {
+		o.APIKey = os.Getenv("ANTHROPIC_API_KEY")
+	}
+	return o
+}
+
+// ValidateAnthropic checks the options are consistent for the Anthropic API and the files they refer to can be loaded.
+func (o ClientOptions) ValidateAnthropic() error {
+	o = o.withAnthropicDefaults()
+	if o.BaseURL == "" && o.APIKey == "" {
+		return errors.New("an API key is required for the Anthropic API, set --api-key or ANTHROPIC_API_KEY, or --model-url for a gateway")
+	}
+	return o.validateConnection()
+}
+
+// Close cleans up any resources used by the client.
+func (c *AnthropicClient) Close() error {
+	return nil
+}
+
+// StartChat starts a new chat session.
+func (c *AnthropicClient) StartChat(systemPrompt, model string) gollm.Chat {
+	if model == "" {
+		model = anthropicDefaultModel
+		klog.V(1).Infof("No model specified, defaulting to %s", model)
+	}
+	klog.V(1).Infof("Starting new Anthropic chat session with model: %s", model)
+	return &anthropicChatSession{
+		client: c,
+		system: systemPrompt,
+		model:  model,
+	}
+}
+
+// GenerateCompletion sends the prompt as a single user message.
+func (c *AnthropicClient) GenerateCompletion(ctx context.Context, req *gollm.CompletionRequest) (gollm.CompletionResponse, error) {
+	klog.Infof("Anthropic GenerateCompletion called with model: %s", req.Model)
+	klog.V(1).Infof("Prompt:\n%s", req.Prompt)
+
+	model := req.Model
+	if model == "" {
+		model = anthropicDefaultModel
+	}
+	resp, err := c.createMessage(ctx, &anthropicRequest{
+		Model:     model,
+		MaxTokens: anthropicMaxTokens,
+		Messages: []anthropicMessage{
+			{Role: "user", Content: []anthropicBlock{{Type: "text", Text: req.Prompt}}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate Anthropic completion: %w", err)
+	}
+	text := resp.text()
+	if text == "" {
+		return nil, errors.New("received an empty response from Anthropic")
+	}
+	return &anthropicCompletionResponse{content: text, usage: resp.Usage}, nil
+}
+
+type anthropicCompletionResponse struct {
+	content string
+	usage   *anthropicUsage
+}
+
+func (r *anthropicCompletionResponse) Response() string {
+	return r.content
+}
+
+func (r *anthropicCompletionResponse) UsageMetadata() any {
+	if r.usage == nil {
+		return nil
+	}
+	return r.usage
+}
+
+// SetResponseSchema is not implemented yet.
+func (c *AnthropicClient) SetResponseSchema(schema *gollm.Schema) error {
+	klog.Warning("AnthropicClient.SetResponseSchema is not implemented yet")
+	return nil
+}
+
+// ListModels lists the IDs of the models served by the /v1/models endpoint.
+func (c *AnthropicClient) ListModels(ctx context.Context) ([]string, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/v1/models?limit=1000", nil)
+	if err != nil {
+		return nil, fmt.Errorf("listing Anthropic models: %w", err)
+	}
+	defer resp.Body.Close()
+	var page struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("parsing Anthropic models: %w", err)
+	}
+	var names []string
+	for _, m := range page.Data {
+		names = append(names, m.ID)
+	}
+	return names, nil
+}
+
+// do sends a request to the API, converting the error responses to gollm.APIError.
+func (c *AnthropicClient) do(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("marshaling request: %w", err)
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("anthropic-version", anthropicVersion)
+	req.Header.Set("content-type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("x-api-key", c.apiKey)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, anthropicAPIError(resp)
+	}
+	return resp, nil
+}
+
+// anthropicAPIError converts an error response to gollm.APIError, so that it can be classified by IsRetryableError,
+// keeping the delay of the Retry-After header if there is one.
+func anthropicAPIError(resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var body struct {
+		Error anthropicError `json:"error"`
+	}
+	message := strings.TrimSpace(string(b))
+	if err := json.Unmarshal(b, &body); err == nil && body.Error.Message != "" {
+		message = body.Error.Message
+	}
+	e := &gollm.APIError{
+		StatusCode: resp.StatusCode,
+		Message:    message,
+		Err:        fmt.Errorf("%s %q: %s", resp.Request.Method, resp.Request.URL, resp.Status),
+	}
+	if d := retryAfter(resp.Header); d > 0 {
+		return &rateLimitedError{APIError: e, retryAfter: d}
+	}
+	return e
+}
+
+// createMessage sends a non-streaming request to the Messages API.
+func (c *AnthropicClient) createMessage(ctx context.Context, req *anthropicRequest) (*anthropicResponse, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/v1/messages", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	message := &anthropicResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(message); err != nil {
+		return nil, fmt.Errorf("parsing Anthropic response: %w", err)
+	}
+	return message, nil
+}
+
+// --- Messages API types ---
+
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	MaxTokens int                `json:"max_tokens"`
+	System    string             `json:"system,omitempty"`
+	Messages  []anthropicMessage `json:"messages"`
+	Tools     []anthropicTool    `json:"tools,omitempty"`
+	Stream    bool               `json:"stream,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock is a content block of a message: text, tool_use or tool_result.
+type anthropicBlock struct {
+	Type string `json:"type"`
+
+	Text string `json:"text,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Role       string           `json:"role"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      *anthropicUsage  `json:"usage"`
+}
+
+// text returns the text blocks of the response.
+func (r *anthropicResponse) text() string {
+	var sb strings.Builder
+	for _, block := range r.Content {
+		if block.Type == "text" {
+			sb.WriteString(block.Text)
+		}
+	}
+	return sb.String()
+}
+
+// message converts the response to the assistant message of the history. Empty text blocks are
+// dropped as the API rejects them, as well as empty messages.
+func (r *anthropicResponse) message() anthropicMessage {
+	message := anthropicMessage{Role: "assistant"}
+	for _, block := range r.Content {
+		if block.Type == "text" && block.Text == "" {
+			continue
+		}
+		message.Content = append(message.Content, block)
+	}
+	if len(message.Content) == 0 {
+		message.Content = []anthropicBlock{{Type: "text", Text: "(no answer)"}}
+	}
+	return message
+}
+
+// --- Chat Session Implementation ---
+
+type anthropicChatSession struct {
+	client  *AnthropicClient
+	system  string
+	model   string
+	history []anthropicMessage
+	tools   []anthropicTool
+}
+
+var (
+	_ gollm.Chat    = &anthropicChatSession{}
+	_ HistoryEditor = &anthropicChatSession{}
+)
+
+// SetFunctionDefinitions converts the function definitions to Anthropic tools.
+func (cs *anthropicChatSession) SetFunctionDefinitions(defs []*gollm.FunctionDefinition) error {
+	cs.tools = nil
+	for _, def := range defs {
+		schema := json.RawMessage(`{"type":"object"}`)
+		if def.Parameters != nil {
+			b, err := def.Parameters.ToRawSchema()
+			if err != nil {
+				return fmt.Errorf("failed to convert schema for function %s: %w", def.Name, err)
+			}
+			schema = b
+		}
+		cs.tools = append(cs.tools, anthropicTool{Name: def.Name, Description: def.Description, InputSchema: schema})
+	}
+	klog.V(1).Infof("Set %d function definitions for Anthropic chat session", len(cs.tools))
+	return nil
+}
+
+// appendContents converts the user message(s) and function call results to a single user message, as the
+// API expects the roles to alternate, and appends it to a copy of the history.
+func (cs *anthropicChatSession) appendContents(contents []any) ([]anthropicMessage, error) {
+	message := anthropicMessage{Role: "user"}
+	for _, content := range contents {
+		switch c := content.(type) {
+		case string:
+			message.Content = append(message.Content, anthropicBlock{Type: "text", Text: c})
+		case gollm.FunctionCallResult:
+			resultJSON, err := json.Marshal(c.Result)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal function call result %q: %w", c.Name, err)
+			}
+			_, isError := c.Result["error"]
+			message.Content = append(message.Content, anthropicBlock{Type: "tool_result", ToolUseID: c.ID, Content: string(resultJSON), IsError: isError})
+		default:
+			return nil, fmt.Errorf("unhandled content type: %T", content)
+		}
+	}
+	messages := append([]anthropicMessage(nil), cs.history...)
+	return append(messages, message), nil
+}
+
+func (cs *anthropicChatSession) newRequest(messages []anthropicMessage) *anthropicRequest {
+	return &anthropicRequest{
+		Model:     cs.model,
+		MaxTokens: anthropicMaxTokens,
+		System:    cs.system,
+		Messages:  messages,
+		Tools:     cs.tools,
+	}
+}
+
+// Send sends the user message(s), appends to history, and gets the LLM response.
+func (cs *anthropicChatSession) Send(ctx context.Context, contents ...any) (gollm.ChatResponse, error) {
+	klog.V(1).InfoS("anthropicChatSession.Send called", "model", cs.model, "history_len", len(cs.history))
+	messages, err := cs.appendContents(contents)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cs.client.createMessage(ctx, cs.newRequest(messages))
+	if err != nil {
+		klog.Errorf("Anthropic Messages API error: %v", err)
+		return nil, fmt.Errorf("anthropic message failed: %w", err)
+	}
+	logStopReason(resp.StopReason)
+	cs.history = append(messages, resp.message())
+	return &anthropicChatResponse{response: resp}, nil
+}
+
+// SendStreaming sends the user message(s) and returns an iterator for the LLM response stream.
+// Text is yielded as it arrives. The input of tool calls is streamed as partial JSON, so tool calls are
+// accumulated and yielded along with the token usage in a final response once the stream ended.
+func (cs *anthropicChatSession) SendStreaming(ctx context.Context, contents ...any) (gollm.ChatResponseIterator, error) {
+	klog.V(1).InfoS("anthropicChatSession.SendStreaming called", "model", cs.model, "history_len", len(cs.history))
+	messages, err := cs.appendContents(contents)
+	if err != nil {
+		return nil, err
+	}
+	req := cs.newRequest(messages)
+	req.Stream = true
+	// the request is sent right away, report errors such as an unreachable endpoint before streaming
+	resp, err := cs.client.do(ctx, http.MethodPost, "/v1/messages", req)
+	if err != nil {
+		klog.Errorf("Anthropic Messages API error: %v", err)
+		return nil, fmt.Errorf("anthropic message failed: %w", err)
+	}
+
+	return func(yield func(gollm.ChatResponse, error) bool) {
+		defer resp.Body.Close()
+
+		acc := &anthropicResponse{}
+		// partialJSON accumulates the input of the tool_use blocks, by block index
+		partialJSON := map[int]*strings.Builder{}
+		err := readEvents(resp.Body, func(event *anthropicEvent) (bool, error) {
+			switch event.Type {
+			case "message_start":
+				if event.Message != nil {
+					acc.ID, acc.Role, acc.Usage = event.Message.ID, event.Message.Role, event.Message.Usage
+				}
+			case "content_block_start":
+				if event.ContentBlock == nil {
+					return true, nil
+				}
+				for len(acc.Content) <= event.Index {
+					acc.Content = append(acc.Content, anthropicBlock{})
+				}
+				acc.Content[event.Index] = *event.ContentBlock
+				if event.ContentBlock.Type == "tool_use" {
+					partialJSON[event.Index] = &strings.Builder{}
+				}
+			case "content_block_delta":
+				if event.Index >= len(acc.Content) {
+					return false, fmt.Errorf("delta of unknown content block %d", event.Index)
+				}
+				switch event.Delta.Type {
+				case "text_delta":
+					acc.Content[event.Index].Text += event.Delta.Text
+					delta := &anthropicResponse{Content: []anthropicBlock{{Type: "text", Text: event.Delta.Text}}}
+					return yield(&anthropicChatResponse{response: delta}, nil), nil
+				case "input_json_delta":
+					if sb, ok := partialJSON[event.Index]; ok {
+						sb.WriteString(event.Delta.PartialJSON)
+					}
+				}
+			case "content_block_stop":
+				if sb, ok := partialJSON[event.Index]; ok && event.Index < len(acc.Content) {
+					input := sb.String()
+					if strings.TrimSpace(input) == "" {
+						input = "{}"
+					}
+					acc.Content[event.Index].Input = json.RawMessage(input)
+				}
+			case "message_delta":
+				if event.Delta.StopReason != "" {
+					acc.StopReason = event.Delta.StopReason
+				}
+				if event.Usage != nil {
+					if acc.Usage == nil {
+						acc.Usage = &anthropicUsage{}
+					}
+					acc.Usage.OutputTokens = event.Usage.OutputTokens
+					if event.Usage.InputTokens > 0 {
+						acc.Usage.InputTokens = event.Usage.InputTokens
+					}
+				}
+			case "error":
+				if event.Error != nil {
+					return false, &gollm.APIError{StatusCode: anthropicErrorStatus(event.Error.Type), Message: event.Error.Message}
+				}
+			}
+			return true, nil
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			klog.Errorf("Anthropic Messages stream error: %v", err)
+			yield(nil, fmt.Errorf("anthropic message stream failed: %w", err))
+			return
+		}
+		if acc.StopReason == "" {
+			// the consumer stopped reading, or the stream ended early
+			return
+		}
+
+		logStopReason(acc.StopReason)
+		cs.history = append(messages, acc.message())
+		klog.V(1).InfoS("Received streaming response from Anthropic Messages API", "id", acc.ID, "stop_reason", acc.StopReason)
+
+		// the text was already streamed, the final response carries the tool calls and the usage
+		final := &anthropicResponse{ID: acc.ID, StopReason: acc.StopReason, Usage: acc.Usage}
+		for _, block := range acc.Content {
+			if block.Type == "tool_use" {
+				final.Content = append(final.Content, block)
+			}
+		}
+		yield(&anthropicChatResponse{response: final}, nil)
+	}, nil
+}
+
+// anthropicErrorStatus maps the error types reported in streams to the HTTP status they are reported with otherwise.
+func anthropicErrorStatus(errorType string) int {
+	switch errorType {
+	case "overloaded_error":
+		return statusOverloaded
+	case "rate_limit_error":
+		return http.StatusTooManyRequests
+	case "api_error":
+		return http.StatusInternalServerError
+	case "invalid_request_error":
+		return http.StatusBadRequest
+	}
+	return 0
+}
+
+func logStopReason(reason string) {
+	if reason == "max_tokens" {
+		klog.Warningf("the Anthropic answer was cut at the maximum of %d tokens", anthropicMaxTokens)
+	}
+}
+
+// anthropicEvent is a server-sent event of a streamed message.
+type anthropicEvent struct {
+	Type         string             `json:"type"`
+	Index        int                `json:"index"`
+	Message      *anthropicResponse `json:"message"`
+	ContentBlock *anthropicBlock    `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage"`
+	Error *anthropicError `json:"error"`
+}
+
+// readEvents reads the server-sent events of the body until handle returns false or the stream ends.
+func readEvents(body io.Reader, handle func(*anthropicEvent) (bool, error)) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			// event names are repeated in the data, comments and blank lines are ignored
+			continue
+		}
+		event := &anthropicEvent{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), event); err != nil {
+			return fmt.Errorf("parsing event %q: %w", data, err)
+		}
+		more, err := handle(event)
+		if err != nil || !more {
+			return err
+		}
+		if event.Type == "message_stop" {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// IsRetryableError returns true for rate limits, overloads, server errors, timeouts and connections
+// closed by the server or a proxy before the response was complete.
+func (cs *anthropicChatSession) IsRetryableError(err error) bool {
+	if gollm.DefaultIsRetryableError(err) {
+		return true
+	}
+	var apiErr *gollm.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == statusOverloaded {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// History returns the messages sent to and received from the model so far, starting with the system prompt.
+// User messages made only of tool results are reported as tool messages.
+func (cs *anthropicChatSession) History() []Message {
+	messages := []Message{{Role: "system", Content: cs.system}}
+	for _, m := range cs.history {
+		role := m.Role
+		var parts []string
+		for _, block := range m.Content {
+			switch block.Type {
+			case "text":
+				parts = append(parts, block.Text)
+			case "tool_use":
+				parts = append(parts, fmt.Sprintf("%s(%s)", block.Name, block.Input))
+			case "tool_result":
+				role = "tool"
+				parts = append(parts, block.Content)
+			}
+		}
+		messages = append(messages, Message{Role: role, Content: strings.Join(parts, "\n")})
+	}
+	return messages
+}
+
+// ReplaceContent replaces the text of a user message, or the results of the tool calls of a message with content
+// and references to it, keeping the IDs of the tool calls so that the history stays valid.
+func (cs *anthropicChatSession) ReplaceContent(i int, content string) error {
+	// the system prompt is the first message of History
+	if i < 1 || i > len(cs.history) {
+		return fmt.Errorf("message %d is not a user message of the history of %d messages", i, len(cs.history)+1)
+	}
+	m := cs.history[i-1]
+	if m.Role != "user" {
+		return fmt.Errorf("message %d is neither a user message nor a tool call result", i)
+	}
+	var blocks []anthropicBlock
+	replaced := false
+	for _, block := range m.Content {
+		switch block.Type {
+		case "tool_result":
+			block.Content = "See the result of the previous tool call."
+			if !replaced {
+				block.Content = content
+			}
+		case "text":
+			if replaced {
+				continue
+			}
+			block.Text = content
+		}
+		replaced = true
+		blocks = append(blocks, block)
+	}
+	cs.history[i-1] = anthropicMessage{Role: m.Role, Content: blocks}
+	return nil
+}
+
+// --- Helper structs for ChatResponse interface ---
+
+type anthropicChatResponse struct {
+	response *anthropicResponse
+}
+
+var _ gollm.ChatResponse = (*anthropicChatResponse)(nil)
+
+func (r *anthropicChatResponse) UsageMetadata() any {
+	if r.response.Usage == nil {
+		return nil
+	}
+	return r.response.Usage
+}
+
+func (r *anthropicChatResponse) Candidates() []gollm.Candidate {
+	return []gollm.Candidate{&anthropicCandidate{response: r.response}}
+}
+
+type anthropicCandidate struct {
+	response *anthropicResponse
+}
+
+var _ gollm.Candidate = (*anthropicCandidate)(nil)
+
+func (c *anthropicCandidate) Parts() []gollm.Part {
+	var parts []gollm.Part
+	if text := c.response.text(); text != "" {
+		parts = append(parts, &anthropicPart{text: text})
+	}
+	var calls []gollm.FunctionCall
+	for _, block := range c.response.Content {
+		if block.Type != "tool_use" {
+			continue
+		}
+		var args map[string]any
+		if err := json.Unmarshal(block.Input, &args); err != nil {
+			klog.Warningf("error parsing the input of tool call %s: %v", block.ID, err)
+		}
+		calls = append(calls, gollm.FunctionCall{ID: block.ID, Name: block.Name, Arguments: args})
+	}
+	if len(calls) > 0 {
+		parts = append(parts, &anthropicPart{calls: calls})
+	}
+	return parts
+}
+
+// String provides a simple string representation for logging/debugging.
+func (c *anthropicCandidate) String() string {
+	return fmt.Sprintf("Candidate(StopReason: %s, Content: %q)", c.response.StopReason, c.response.text())
+}
+
+type anthropicPart struct {
+	text  string
+	calls []gollm.FunctionCall
+}
+
+var _ gollm.Part = (*anthropicPart)(nil)
+
+func (p *anthropicPart) AsText() (string, bool) {
+	return p.text, p.text != ""
+}
+
+func (p *anthropicPart) AsFunctionCalls() ([]gollm.FunctionCall, bool) {
+	return p.calls, len(p.calls) > 0
+}
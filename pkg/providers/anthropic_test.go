@@ -0,0 +1,538 @@
+package gollm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubectl-ai/gollm"
+)
+
+// newTestAnthropicClient creates a client of a fake Messages API served by handler.
+func newTestAnthropicClient(t *testing.T, handler http.HandlerFunc) *AnthropicClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client, err := NewAnthropicClient(context.Background(), ClientOptions{BaseURL: server.URL + "/v1", APIKey: "test-key"})
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	return client
+}
+
+// decodeRequest reads the request sent to the Messages API, checking its headers.
+func decodeRequest(t *testing.T, r *http.Request) *anthropicRequest {
+	t.Helper()
+	if r.URL.Path != "/v1/messages" {
+		t.Errorf("request sent to %s, want /v1/messages", r.URL.Path)
+	}
+	if got := r.Header.Get("x-api-key"); got != "test-key" {
+		t.Errorf("x-api-key = %q, want test-key", got)
+	}
+	if got := r.Header.Get("anthropic-version"); got != anthropicVersion {
+		t.Errorf("anthropic-version = %q, want %s", got, anthropicVersion)
+	}
+	req := &anthropicRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		t.Errorf("decoding request: %v", err)
+	}
+	return req
+}
+
+// sse writes the events as a stream of server-sent events.
+func sse(w http.ResponseWriter, events ...string) {
+	w.Header().Set("content-type", "text/event-stream")
+	for _, event := range events {
+		var typed struct {
+			Type string `json:"type"`
+		}
+		_ = json.Unmarshal([]byte(event), &typed)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, event)
+	}
+}
+
+// responseParts returns the text and the function calls of the responses.
+func responseParts(responses ...gollm.ChatResponse) (string, []gollm.FunctionCall) {
+	var text string
+	var calls []gollm.FunctionCall
+	for _, resp := range responses {
+		for _, candidate := range resp.Candidates() {
+			for _, part := range candidate.Parts() {
+				if s, ok := part.AsText(); ok {
+					text += s
+				}
+				if c, ok := part.AsFunctionCalls(); ok {
+					calls = append(calls, c...)
+				}
+			}
+		}
+	}
+	return text, calls
+}
+
+func TestAnthropicSend(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		// contents are sent after a first exchange asking for a tool call
+		contents []any
+
+		wantText  string
+		wantCalls []gollm.FunctionCall
+		wantUsage *anthropicUsage
+		// wantLast is the last message of the request, as sent to the API
+		wantLast anthropicMessage
+	}{
+		{
+			name:      "text answer",
+			response:  `{"id":"msg_2","role":"assistant","content":[{"type":"text","text":"3 pods are running."}],"stop_reason":"end_turn","usage":{"input_tokens":120,"output_tokens":8}}`,
+			contents:  []any{"how many pods run?"},
+			wantText:  "3 pods are running.",
+			wantUsage: &anthropicUsage{InputTokens: 120, OutputTokens: 8},
+			wantLast:  anthropicMessage{Role: "user", Content: []anthropicBlock{{Type: "text", Text: "how many pods run?"}}},
+		},
+		{
+			name:     "tool result",
+			response: `{"id":"msg_2","role":"assistant","content":[{"type":"text","text":"Checking the events."},{"type":"tool_use","id":"toolu_2","name":"kubectl","input":{"command":"kubectl get events"}}],"stop_reason":"tool_use","usage":{"input_tokens":150,"output_tokens":20}}`,
+			contents: []any{gollm.FunctionCallResult{ID: "toolu_1", Name: "kubectl", Result: map[string]any{"stdout": "nginx 1/1 Running"}}},
+			wantText: "Checking the events.",
+			wantCalls: []gollm.FunctionCall{
+				{ID: "toolu_2", Name: "kubectl", Arguments: map[string]any{"command": "kubectl get events"}},
+			},
+			wantUsage: &anthropicUsage{InputTokens: 150, OutputTokens: 20},
+			wantLast:  anthropicMessage{Role: "user", Content: []anthropicBlock{{Type: "tool_result", ToolUseID: "toolu_1", Content: `{"stdout":"nginx 1/1 Running"}`}}},
+		},
+		{
+			name:     "failed tool",
+			response: `{"id":"msg_2","role":"assistant","content":[{"type":"text","text":"The command failed."}],"stop_reason":"end_turn"}`,
+			contents: []any{gollm.FunctionCallResult{ID: "toolu_1", Name: "kubectl", Result: map[string]any{"error": "forbidden"}}},
+			wantText: "The command failed.",
+			wantLast: anthropicMessage{Role: "user", Content: []anthropicBlock{{Type: "tool_result", ToolUseID: "toolu_1", Content: `{"error":"forbidden"}`, IsError: true}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []*anthropicRequest
+			client := newTestAnthropicClient(t, func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, decodeRequest(t, r))
+				if len(requests) == 1 {
+					fmt.Fprint(w, `{"id":"msg_1","role":"assistant","content":[{"type":"text","text":""},{"type":"tool_use","id":"toolu_1","name":"kubectl","input":{"command":"kubectl get pods"}}],"stop_reason":"tool_use","usage":{"input_tokens":100,"output_tokens":10}}`)
+					return
+				}
+				fmt.Fprint(w, tt.response)
+			})
+			chat := client.StartChat("You are a Kubernetes assistant.", "claude-test")
+			if err := chat.SetFunctionDefinitions([]*gollm.FunctionDefinition{{Name: "kubectl", Description: "Runs kubectl"}}); err != nil {
+				t.Fatalf("setting function definitions: %v", err)
+			}
+
+			first, err := chat.Send(context.Background(), "list the pods")
+			if err != nil {
+				t.Fatalf("first Send: %v", err)
+			}
+			if _, calls := responseParts(first); len(calls) != 1 || calls[0].ID != "toolu_1" {
+				t.Fatalf("first Send returned the calls %+v, want toolu_1", calls)
+			}
+
+			resp, err := chat.Send(context.Background(), tt.contents...)
+			if err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			text, calls := responseParts(resp)
+			if text != tt.wantText {
+				t.Errorf("text = %q, want %q", text, tt.wantText)
+			}
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("calls = %+v, want %+v", calls, tt.wantCalls)
+			}
+			if usage, _ := resp.UsageMetadata().(*anthropicUsage); !reflect.DeepEqual(usage, tt.wantUsage) {
+				t.Errorf("usage = %+v, want %+v", usage, tt.wantUsage)
+			}
+
+			if len(requests) != 2 {
+				t.Fatalf("%d requests were sent, want 2", len(requests))
+			}
+			req := requests[1]
+			if req.Model != "claude-test" || req.System != "You are a Kubernetes assistant." || req.Stream {
+				t.Errorf("request model %q, system %q, stream %v", req.Model, req.System, req.Stream)
+			}
+			if len(req.Tools) != 1 || req.Tools[0].Name != "kubectl" || string(req.Tools[0].InputSchema) != `{"type":"object"}` {
+				t.Errorf("tools = %+v, want kubectl with an object schema", req.Tools)
+			}
+			// the history carries the tool call, without the empty text block the API rejects
+			if len(req.Messages) != 3 {
+				t.Fatalf("%d messages were sent, want 3", len(req.Messages))
+			}
+			wantCall := anthropicMessage{Role: "assistant", Content: []anthropicBlock{{Type: "tool_use", ID: "toolu_1", Name: "kubectl", Input: json.RawMessage(`{"command":"kubectl get pods"}`)}}}
+			if !reflect.DeepEqual(req.Messages[1], wantCall) {
+				t.Errorf("assistant message = %+v, want %+v", req.Messages[1], wantCall)
+			}
+			if !reflect.DeepEqual(req.Messages[2], tt.wantLast) {
+				t.Errorf("last message = %+v, want %+v", req.Messages[2], tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestAnthropicSendStreaming(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+
+		wantText       string
+		wantCalls      []gollm.FunctionCall
+		wantUsage      *anthropicUsage
+		wantStopReason string
+		wantErr        bool
+		// wantStatus is the status of the API error, and wantRetryable tells if it is retried
+		wantStatus    int
+		wantRetryable bool
+		// wantHistory is the number of messages of the history afterwards
+		wantHistory int
+	}{
+		{
+			name: "text",
+			events: []string{
+				`{"type":"message_start","message":{"id":"msg_1","role":"assistant","content":[],"usage":{"input_tokens":25,"output_tokens":1}}}`,
+				`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+				`{"type":"ping"}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"All pods "}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"are running."}}`,
+				`{"type":"content_block_stop","index":0}`,
+				`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":15}}`,
+				`{"type":"message_stop"}`,
+			},
+			wantText:       "All pods are running.",
+			wantUsage:      &anthropicUsage{InputTokens: 25, OutputTokens: 15},
+			wantStopReason: "end_turn",
+			wantHistory:    3,
+		},
+		{
+			name: "tool calls",
+			events: []string{
+				`{"type":"message_start","message":{"id":"msg_1","role":"assistant","content":[],"usage":{"input_tokens":40,"output_tokens":1}}}`,
+				`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Listing the pods."}}`,
+				`{"type":"content_block_stop","index":0}`,
+				`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"kubectl","input":{}}}`,
+				`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":""}}`,
+				`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"command\": \"kubectl get"}}`,
+				`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":" pods -A\"}"}}`,
+				`{"type":"content_block_stop","index":1}`,
+				`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_2","name":"list_contexts","input":{}}}`,
+				`{"type":"content_block_stop","index":2}`,
+				`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"input_tokens":42,"output_tokens":30}}`,
+				`{"type":"message_stop"}`,
+			},
+			wantText: "Listing the pods.",
+			wantCalls: []gollm.FunctionCall{
+				{ID: "toolu_1", Name: "kubectl", Arguments: map[string]any{"command": "kubectl get pods -A"}},
+				{ID: "toolu_2", Name: "list_contexts", Arguments: map[string]any{}},
+			},
+			wantUsage:      &anthropicUsage{InputTokens: 42, OutputTokens: 30},
+			wantStopReason: "tool_use",
+			wantHistory:    3,
+		},
+		{
+			name: "overloaded",
+			events: []string{
+				`{"type":"message_start","message":{"id":"msg_1","role":"assistant","content":[],"usage":{"input_tokens":25,"output_tokens":1}}}`,
+				`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"All"}}`,
+				`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			},
+			wantText:      "All",
+			wantErr:       true,
+			wantStatus:    statusOverloaded,
+			wantRetryable: true,
+			wantHistory:   1,
+		},
+		{
+			name: "invalid request",
+			events: []string{
+				`{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long"}}`,
+			},
+			wantErr:     true,
+			wantStatus:  http.StatusBadRequest,
+			wantHistory: 1,
+		},
+		{
+			name: "stream cut",
+			events: []string{
+				`{"type":"message_start","message":{"id":"msg_1","role":"assistant","content":[],"usage":{"input_tokens":25,"output_tokens":1}}}`,
+				`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"All"}}`,
+			},
+			wantText:      "All",
+			wantErr:       true,
+			wantRetryable: true,
+			wantHistory:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestAnthropicClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if req := decodeRequest(t, r); !req.Stream {
+					t.Errorf("the request does not ask for a stream")
+				}
+				sse(w, tt.events...)
+			})
+			chat := client.StartChat("You are a Kubernetes assistant.", "claude-test")
+			stream, err := chat.SendStreaming(context.Background(), "list the pods")
+			if err != nil {
+				t.Fatalf("SendStreaming: %v", err)
+			}
+
+			var responses []gollm.ChatResponse
+			var streamErr error
+			for resp, err := range stream {
+				if err != nil {
+					streamErr = err
+					break
+				}
+				responses = append(responses, resp)
+			}
+
+			text, calls := responseParts(responses...)
+			if text != tt.wantText {
+				t.Errorf("text = %q, want %q", text, tt.wantText)
+			}
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("calls = %+v, want %+v", calls, tt.wantCalls)
+			}
+			if got := len(chat.(*anthropicChatSession).history); got+1 != tt.wantHistory {
+				t.Errorf("the history has %d messages, want %d", got+1, tt.wantHistory)
+			}
+
+			if tt.wantErr {
+				if streamErr == nil {
+					t.Fatalf("the stream did not fail")
+				}
+				var apiErr *gollm.APIError
+				status := 0
+				if errors.As(streamErr, &apiErr) {
+					status = apiErr.StatusCode
+				}
+				if status != tt.wantStatus {
+					t.Errorf("error %v has the status %d, want %d", streamErr, status, tt.wantStatus)
+				}
+				if got := chat.IsRetryableError(streamErr); got != tt.wantRetryable {
+					t.Errorf("IsRetryableError(%v) = %v, want %v", streamErr, got, tt.wantRetryable)
+				}
+				return
+			}
+			if streamErr != nil {
+				t.Fatalf("stream error: %v", streamErr)
+			}
+			// the usage and the stop reason come with the last response
+			last := responses[len(responses)-1].(*anthropicChatResponse)
+			if usage, _ := last.UsageMetadata().(*anthropicUsage); !reflect.DeepEqual(usage, tt.wantUsage) {
+				t.Errorf("usage = %+v, want %+v", usage, tt.wantUsage)
+			}
+			if last.response.StopReason != tt.wantStopReason {
+				t.Errorf("stop reason = %q, want %q", last.response.StopReason, tt.wantStopReason)
+			}
+		})
+	}
+}
+
+func TestAnthropicAPIError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		body   string
+
+		wantMessage    string
+		wantRetryable  bool
+		wantRetryAfter time.Duration
+	}{
+		{
+			name:           "rate limited",
+			status:         http.StatusTooManyRequests,
+			header:         http.Header{"Retry-After": {"20"}},
+			body:           `{"type":"error","error":{"type":"rate_limit_error","message":"Number of request tokens has exceeded your per-minute rate limit"}}`,
+			wantMessage:    "Number of request tokens has exceeded your per-minute rate limit",
+			wantRetryable:  true,
+			wantRetryAfter: 20 * time.Second,
+		},
+		{
+			name:           "rate limited in milliseconds",
+			status:         http.StatusTooManyRequests,
+			header:         http.Header{"Retry-After-Ms": {"1500"}, "Retry-After": {"2"}},
+			body:           `{"type":"error","error":{"type":"rate_limit_error","message":"rate limited"}}`,
+			wantMessage:    "rate limited",
+			wantRetryable:  true,
+			wantRetryAfter: 1500 * time.Millisecond,
+		},
+		{
+			name:          "overloaded",
+			status:        statusOverloaded,
+			body:          `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			wantMessage:   "Overloaded",
+			wantRetryable: true,
+		},
+		{
+			name:          "gateway error",
+			status:        http.StatusBadGateway,
+			body:          "upstream connect error\n",
+			wantMessage:   "upstream connect error",
+			wantRetryable: true,
+		},
+		{
+			name:        "invalid request",
+			status:      http.StatusBadRequest,
+			body:        `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens: Field required"}}`,
+			wantMessage: "max_tokens: Field required",
+		},
+		{
+			name:        "unauthorized",
+			status:      http.StatusUnauthorized,
+			header:      http.Header{"Retry-After": {"5"}},
+			body:        `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`,
+			wantMessage: "invalid x-api-key",
+			// the delay is kept, the error is not retried anyway
+			wantRetryAfter: 5 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestAnthropicClient(t, func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.header {
+					w.Header()[k] = v
+				}
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+			chat := client.StartChat("", "claude-test")
+			_, err := chat.Send(context.Background(), "list the pods")
+			if err == nil {
+				t.Fatalf("Send did not fail")
+			}
+
+			var apiErr *gollm.APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error %v is not an APIError", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Message != tt.wantMessage {
+				t.Errorf("error has the status %d and message %q, want %d and %q", apiErr.StatusCode, apiErr.Message, tt.status, tt.wantMessage)
+			}
+			if got := chat.IsRetryableError(err); got != tt.wantRetryable {
+				t.Errorf("IsRetryableError(%v) = %v, want %v", err, got, tt.wantRetryable)
+			}
+			var retryAfter time.Duration
+			var rateLimited interface{ RetryAfter() time.Duration }
+			if errors.As(err, &rateLimited) {
+				retryAfter = rateLimited.RetryAfter()
+			}
+			if retryAfter != tt.wantRetryAfter {
+				t.Errorf("retry after %s, want %s", retryAfter, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestAnthropicIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "unexpected EOF", err: fmt.Errorf("anthropic message stream failed: %w", io.ErrUnexpectedEOF), want: true},
+		{name: "internal error", err: &gollm.APIError{StatusCode: http.StatusInternalServerError}, want: true},
+		{name: "overloaded", err: &gollm.APIError{StatusCode: statusOverloaded}, want: true},
+		{name: "not found", err: &gollm.APIError{StatusCode: http.StatusNotFound}},
+		{name: "canceled", err: context.Canceled},
+	}
+	cs := &anthropicChatSession{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cs.IsRetryableError(tt.err); got != tt.want {
+				t.Errorf("IsRetryableError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnthropicGenerateCompletion(t *testing.T) {
+	client := newTestAnthropicClient(t, func(w http.ResponseWriter, r *http.Request) {
+		req := decodeRequest(t, r)
+		want := []anthropicMessage{{Role: "user", Content: []anthropicBlock{{Type: "text", Text: "Summarize the events."}}}}
+		if req.Model != anthropicDefaultModel || req.MaxTokens != anthropicMaxTokens || !reflect.DeepEqual(req.Messages, want) {
+			t.Errorf("request = %+v", req)
+		}
+		fmt.Fprint(w, `{"id":"msg_1","role":"assistant","content":[{"type":"text","text":"Two pods were evicted."}],"stop_reason":"end_turn","usage":{"input_tokens":300,"output_tokens":6}}`)
+	})
+	resp, err := client.GenerateCompletion(context.Background(), &gollm.CompletionRequest{Prompt: "Summarize the events."})
+	if err != nil {
+		t.Fatalf("GenerateCompletion: %v", err)
+	}
+	if resp.Response() != "Two pods were evicted." {
+		t.Errorf("response = %q", resp.Response())
+	}
+	if usage, _ := resp.UsageMetadata().(*anthropicUsage); !reflect.DeepEqual(usage, &anthropicUsage{InputTokens: 300, OutputTokens: 6}) {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestAnthropicListModels(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+
+		want    []string
+		wantErr string
+	}{
+		{
+			name:   "models",
+			status: http.StatusOK,
+			body:   `{"data":[{"type":"model","id":"claude-sonnet-4-0","display_name":"Claude Sonnet 4"},{"type":"model","id":"claude-3-5-haiku-latest"}],"has_more":false}`,
+			want:   []string{"claude-sonnet-4-0", "claude-3-5-haiku-latest"},
+		},
+		{
+			name:    "not served",
+			status:  http.StatusNotFound,
+			body:    `{"type":"error","error":{"type":"not_found_error","message":"Not found"}}`,
+			wantErr: "Not found",
+		},
+		{
+			name:    "invalid body",
+			status:  http.StatusOK,
+			body:    `<html>`,
+			wantErr: "parsing Anthropic models",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestAnthropicClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet || r.URL.Path != "/v1/models" {
+					t.Errorf("request %s %s, want GET /v1/models", r.Method, r.URL.Path)
+				}
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+			models, err := client.ListModels(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ListModels: %v", err)
+			}
+			if !reflect.DeepEqual(models, tt.want) {
+				t.Errorf("models = %v, want %v", models, tt.want)
+			}
+		})
+	}
+}
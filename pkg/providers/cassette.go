@@ -0,0 +1,584 @@
+package gollm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+
+	"k8s.io/klog/v2"
+
+	"github.com/GoogleCloudPlatform/kubectl-ai/gollm"
+)
+
+// Register the replay provider factory on package initialization.
+func init() {
+	if err := gollm.RegisterProvider("replay", newReplayClientFactory); err != nil {
+		klog.Fatalf("Failed to register replay provider: %v", err)
+	}
+}
+
+// newReplayClientFactory is the factory function for creating replay clients.
+// The cassette is read from the file named by KUBECTL_INTERACT_CASSETTE, use NewReplayClient to set it.
+func newReplayClientFactory(ctx context.Context, _ *url.URL) (gollm.Client, error) {
+	return NewReplayClient(os.Getenv("KUBECTL_INTERACT_CASSETTE"))
+}
+
+// Cassette records the requests sent to a model and its responses, so that they can be replayed without the model,
+// e.g. to reproduce a bug report or to test a conversation end to end.
+type Cassette struct {
+	// Chats are the chats, in the order they were started.
+	Chats []*CassetteChat `json:"chats,omitempty"`
+
+	// Completions are the completions, in the order they were requested.
+	Completions []*CassetteCompletion `json:"completions,omitempty"`
+
+	mu       sync.Mutex
+	filename string
+}
+
+// CassetteChat is a recorded chat.
+type CassetteChat struct {
+	Model        string          `json:"model,omitempty"`
+	SystemPrompt string          `json:"systemPrompt,omitempty"`
+	Exchanges    []*ChatExchange `json:"exchanges,omitempty"`
+}
+
+// ChatExchange is a message sent in a chat and the responses it got, streamed or not.
+type ChatExchange struct {
+	Contents  []RecordedContent          `json:"contents"`
+	Responses []gollm.RecordChatResponse `json:"responses,omitempty"`
+	Error     *RecordedError             `json:"error,omitempty"`
+}
+
+// RecordedContent is a content of a message sent in a chat, either a text or the result of a function call.
+type RecordedContent struct {
+	Text               string                    `json:"text,omitempty"`
+	FunctionCallResult *gollm.FunctionCallResult `json:"functionCallResult,omitempty"`
+}
+
+// RecordedResponse is the Raw content of a recorded chat response, the text, function calls and usage of its
+// first candidate.
+type RecordedResponse struct {
+	Text          string               `json:"text,omitempty"`
+	FunctionCalls []gollm.FunctionCall `json:"functionCalls,omitempty"`
+	Usage         any                  `json:"usage,omitempty"`
+}
+
+// CassetteCompletion is a recorded completion, the usage of the response is recorded as its Raw content.
+type CassetteCompletion struct {
+	Model    string                          `json:"model,omitempty"`
+	Prompt   string                          `json:"prompt"`
+	Response *gollm.RecordCompletionResponse `json:"response,omitempty"`
+	Error    *RecordedError                  `json:"error,omitempty"`
+}
+
+// RecordedError is an error returned by the model, the status code is kept so that it is retried alike.
+type RecordedError struct {
+	StatusCode int    `json:"statusCode,omitempty"`
+	Message    string `json:"message"`
+}
+
+func newRecordedError(err error) *RecordedError {
+	var apiErr *gollm.APIError
+	if errors.As(err, &apiErr) {
+		return &RecordedError{StatusCode: apiErr.StatusCode, Message: apiErr.Message}
+	}
+	return &RecordedError{Message: err.Error()}
+}
+
+func (e *RecordedError) err() error {
+	if e.StatusCode != 0 {
+		return &gollm.APIError{StatusCode: e.StatusCode, Message: e.Message}
+	}
+	return errors.New(e.Message)
+}
+
+// LoadCassette reads a cassette from the given JSON file.
+func LoadCassette(filename string) (*Cassette, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading cassette: %w", err)
+	}
+	c := &Cassette{filename: filename}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("parsing cassette %q: %w", filename, err)
+	}
+	return c, nil
+}
+
+// NewCassette creates an empty cassette saved to the given file.
+func NewCassette(filename string) *Cassette {
+	return &Cassette{filename: filename}
+}
+
+// save writes the cassette to its file, it must be called with the lock held. The cassette is saved after every
+// exchange so that it is complete even if the session is interrupted.
+func (c *Cassette) save() {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		klog.Warningf("error marshaling the cassette: %v", err)
+		return
+	}
+	if err := os.WriteFile(c.filename, b, 0o600); err != nil {
+		klog.Warningf("error saving the cassette: %v", err)
+	}
+}
+
+// Record wraps the client, recording its chats and completions to the cassette.
+func (c *Cassette) Record(client gollm.Client) gollm.Client {
+	return &recordingClient{Client: client, cassette: c}
+}
+
+// recordingClient records the requests and responses of a client.
+type recordingClient struct {
+	gollm.Client
+	cassette *Cassette
+}
+
+func (rc *recordingClient) StartChat(systemPrompt, model string) gollm.Chat {
+	chat := &CassetteChat{Model: model, SystemPrompt: systemPrompt}
+	rc.cassette.mu.Lock()
+	rc.cassette.Chats = append(rc.cassette.Chats, chat)
+	rc.cassette.save()
+	rc.cassette.mu.Unlock()
+	return &recordingChat{Chat: rc.Client.StartChat(systemPrompt, model), cassette: rc.cassette, chat: chat}
+}
+
+func (rc *recordingClient) GenerateCompletion(ctx context.Context, req *gollm.CompletionRequest) (gollm.CompletionResponse, error) {
+	resp, err := rc.Client.GenerateCompletion(ctx, req)
+	completion := &CassetteCompletion{Model: req.Model, Prompt: req.Prompt}
+	if err != nil {
+		completion.Error = newRecordedError(err)
+	} else {
+		completion.Response = &gollm.RecordCompletionResponse{Text: resp.Response(), Raw: resp.UsageMetadata()}
+	}
+	rc.cassette.mu.Lock()
+	defer rc.cassette.mu.Unlock()
+	rc.cassette.Completions = append(rc.cassette.Completions, completion)
+	rc.cassette.save()
+	return resp, err
+}
+
+// recordingChat records the messages of a chat and their responses.
+type recordingChat struct {
+	gollm.Chat
+	cassette *Cassette
+	chat     *CassetteChat
+}
+
+var (
+	_ gollm.Chat    = &recordingChat{}
+	_ HistoryEditor = &recordingChat{}
+	_ FallbackChat  = &recordingChat{}
+	_ ModelReporter = &recordingChat{}
+)
+
+// record appends the exchange to the chat of the cassette.
+func (rc *recordingChat) record(exchange *ChatExchange) {
+	rc.cassette.mu.Lock()
+	defer rc.cassette.mu.Unlock()
+	rc.chat.Exchanges = append(rc.chat.Exchanges, exchange)
+	rc.cassette.save()
+}
+
+func (rc *recordingChat) Send(ctx context.Context, contents ...any) (gollm.ChatResponse, error) {
+	exchange := &ChatExchange{Contents: recordContents(contents)}
+	resp, err := rc.Chat.Send(ctx, contents...)
+	if err != nil {
+		exchange.Error = newRecordedError(err)
+	} else {
+		exchange.Responses = append(exchange.Responses, recordResponse(resp))
+	}
+	rc.record(exchange)
+	return resp, err
+}
+
+// SendStreaming records the chunks of the stream as they are read, the exchange is recorded once the stream ended.
+func (rc *recordingChat) SendStreaming(ctx context.Context, contents ...any) (gollm.ChatResponseIterator, error) {
+	exchange := &ChatExchange{Contents: recordContents(contents)}
+	stream, err := rc.Chat.SendStreaming(ctx, contents...)
+	if err != nil {
+		exchange.Error = newRecordedError(err)
+		rc.record(exchange)
+		return nil, err
+	}
+	return func(yield func(gollm.ChatResponse, error) bool) {
+		defer rc.record(exchange)
+		for resp, err := range stream {
+			if err != nil {
+				exchange.Error = newRecordedError(err)
+			} else if resp != nil {
+				exchange.Responses = append(exchange.Responses, recordResponse(resp))
+			}
+			if !yield(resp, err) {
+				return
+			}
+		}
+	}, nil
+}
+
+func recordContents(contents []any) []RecordedContent {
+	var recorded []RecordedContent
+	for _, content := range contents {
+		switch c := content.(type) {
+		case string:
+			recorded = append(recorded, RecordedContent{Text: c})
+		case gollm.FunctionCallResult:
+			recorded = append(recorded, RecordedContent{FunctionCallResult: &c})
+		default:
+			klog.Warningf("not recording content of type %T", content)
+		}
+	}
+	return recorded
+}
+
+func recordResponse(resp gollm.ChatResponse) gollm.RecordChatResponse {
+	recorded := &RecordedResponse{Usage: resp.UsageMetadata()}
+	if candidates := resp.Candidates(); len(candidates) > 0 {
+		for _, part := range candidates[0].Parts() {
+			if text, ok := part.AsText(); ok {
+				recorded.Text += text
+			}
+			if calls, ok := part.AsFunctionCalls(); ok {
+				recorded.FunctionCalls = append(recorded.FunctionCalls, calls...)
+			}
+		}
+	}
+	return gollm.RecordChatResponse{Raw: recorded}
+}
+
+func (rc *recordingChat) SetFallbackHandler(f func(FallbackEvent)) {
+	if fc, ok := rc.Chat.(FallbackChat); ok {
+		fc.SetFallbackHandler(f)
+	}
+}
+
+// ServedModel returns the model which served the last request of the recorded chat, if it tells it.
+func (rc *recordingChat) ServedModel() string {
+	if mr, ok := rc.Chat.(ModelReporter); ok {
+		return mr.ServedModel()
+	}
+	return ""
+}
+
+// History returns the history of the recorded chat, if it exposes it.
+func (rc *recordingChat) History() []Message {
+	if h, ok := rc.Chat.(HistoryEditor); ok {
+		return h.History()
+	}
+	return nil
+}
+
+// ReplaceContent edits the history of the recorded chat, if it exposes it.
+func (rc *recordingChat) ReplaceContent(i int, content string) error {
+	if h, ok := rc.Chat.(HistoryEditor); ok {
+		return h.ReplaceContent(i, content)
+	}
+	return errors.New("the history of the recorded chat can not be edited")
+}
+
+// ReplayClient serves the chats and completions recorded in a cassette, in the order they were recorded.
+// The messages sent must match the recorded ones, except for the results of the function calls which
+// depend on the cluster.
+type ReplayClient struct {
+	cassette *Cassette
+
+	mu          sync.Mutex
+	chats       int
+	completions int
+}
+
+var _ gollm.Client = &ReplayClient{}
+
+// NewReplayClient creates a client replaying the cassette of the given file.
+func NewReplayClient(filename string) (*ReplayClient, error) {
+	if filename == "" {
+		return nil, errors.New("the replay provider needs a cassette, set --cassette")
+	}
+	cassette, err := LoadCassette(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &ReplayClient{cassette: cassette}, nil
+}
+
+// Model returns the model of the first recorded chat.
+func (c *ReplayClient) Model() string {
+	if len(c.cassette.Chats) == 0 {
+		return ""
+	}
+	return c.cassette.Chats[0].Model
+}
+
+func (c *ReplayClient) Close() error {
+	return nil
+}
+
+// StartChat replays the next recorded chat, chats past the end of the cassette fail on their first message.
+func (c *ReplayClient) StartChat(systemPrompt, model string) gollm.Chat {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	chat := &replayChat{index: c.chats, history: []Message{{Role: "system", Content: systemPrompt}}}
+	if c.chats < len(c.cassette.Chats) {
+		chat.recorded = c.cassette.Chats[c.chats]
+		if chat.recorded.SystemPrompt != systemPrompt {
+			klog.Warningf("the system prompt of chat %d differs from the recorded one", c.chats)
+		}
+	}
+	c.chats++
+	return chat
+}
+
+// GenerateCompletion replays the next recorded completion.
+func (c *ReplayClient) GenerateCompletion(ctx context.Context, req *gollm.CompletionRequest) (gollm.CompletionResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.completions >= len(c.cassette.Completions) {
+		return nil, fmt.Errorf("the cassette has no completion left, %d were recorded", len(c.cassette.Completions))
+	}
+	completion := c.cassette.Completions[c.completions]
+	c.completions++
+	if completion.Prompt != req.Prompt {
+		return nil, fmt.Errorf("the prompt of completion %d differs from the recorded one", c.completions-1)
+	}
+	if completion.Error != nil {
+		return nil, completion.Error.err()
+	}
+	if completion.Response == nil {
+		return nil, fmt.Errorf("completion %d has no recorded response", c.completions-1)
+	}
+	return &replayCompletionResponse{recorded: completion.Response}, nil
+}
+
+type replayCompletionResponse struct {
+	recorded *gollm.RecordCompletionResponse
+}
+
+func (r *replayCompletionResponse) Response() string {
+	return r.recorded.Text
+}
+
+func (r *replayCompletionResponse) UsageMetadata() any {
+	return r.recorded.Raw
+}
+
+func (c *ReplayClient) SetResponseSchema(schema *gollm.Schema) error {
+	return nil
+}
+
+// ListModels lists the models of the recorded chats and completions.
+func (c *ReplayClient) ListModels(ctx context.Context) ([]string, error) {
+	var models []string
+	for _, chat := range c.cassette.Chats {
+		models = append(models, chat.Model)
+	}
+	for _, completion := range c.cassette.Completions {
+		models = append(models, completion.Model)
+	}
+	slices.Sort(models)
+	return slices.Compact(models), nil
+}
+
+// replayChat replays the exchanges of a recorded chat, keeping a history so that it can be compacted alike.
+type replayChat struct {
+	index    int
+	recorded *CassetteChat
+	next     int
+	history  []Message
+}
+
+var (
+	_ gollm.Chat    = &replayChat{}
+	_ HistoryEditor = &replayChat{}
+)
+
+func (rc *replayChat) SetFunctionDefinitions(defs []*gollm.FunctionDefinition) error {
+	return nil
+}
+
+// IsRetryableError classifies the recorded errors as the providers do, so that the retries are replayed.
+func (rc *replayChat) IsRetryableError(err error) bool {
+	return gollm.DefaultIsRetryableError(err)
+}
+
+// nextExchange returns the next exchange of the chat, checking it was recorded for the given contents.
+func (rc *replayChat) nextExchange(contents []any) (*ChatExchange, error) {
+	if rc.recorded == nil || rc.next >= len(rc.recorded.Exchanges) {
+		return nil, fmt.Errorf("the cassette has no message left in chat %d", rc.index)
+	}
+	exchange := rc.recorded.Exchanges[rc.next]
+	rc.next++
+	if err := matchContents(exchange.Contents, recordContents(contents)); err != nil {
+		return nil, fmt.Errorf("message %d of chat %d differs from the recorded one: %w", rc.next-1, rc.index, err)
+	}
+	return exchange, nil
+}
+
+// matchContents compares the texts, and the IDs and names of the function call results.
+func matchContents(recorded, sent []RecordedContent) error {
+	if len(recorded) != len(sent) {
+		return fmt.Errorf("%d contents were recorded, %d are sent", len(recorded), len(sent))
+	}
+	for i := range recorded {
+		r, s := recorded[i], sent[i]
+		if (r.FunctionCallResult == nil) != (s.FunctionCallResult == nil) {
+			return fmt.Errorf("content %d is not of the recorded kind", i)
+		}
+		if r.FunctionCallResult == nil {
+			if r.Text != s.Text {
+				return fmt.Errorf("content %d is not the recorded text", i)
+			}
+			continue
+		}
+		if r.FunctionCallResult.ID != s.FunctionCallResult.ID || r.FunctionCallResult.Name != s.FunctionCallResult.Name {
+			return fmt.Errorf("content %d is the result of %s (%s), %s (%s) was recorded", i,
+				s.FunctionCallResult.Name, s.FunctionCallResult.ID, r.FunctionCallResult.Name, r.FunctionCallResult.ID)
+		}
+	}
+	return nil
+}
+
+// replayResponses converts the recorded responses, appending them to the history along with the contents.
+func (rc *replayChat) replayResponses(contents []any, exchange *ChatExchange) ([]gollm.ChatResponse, error) {
+	var responses []gollm.ChatResponse
+	answer := Message{Role: "assistant"}
+	for i, r := range exchange.Responses {
+		// the raw content is decoded as a map, convert it back
+		b, err := json.Marshal(r.Raw)
+		if err != nil {
+			return nil, err
+		}
+		recorded := &RecordedResponse{}
+		if err := json.Unmarshal(b, recorded); err != nil {
+			return nil, fmt.Errorf("parsing response %d: %w", i, err)
+		}
+		responses = append(responses, &replayResponse{recorded: recorded})
+		answer.Content += recorded.Text
+		for _, call := range recorded.FunctionCalls {
+			args, _ := json.Marshal(call.Arguments)
+			answer.Content += fmt.Sprintf("\n%s(%s)", call.Name, args)
+		}
+	}
+	if exchange.Error == nil {
+		for _, content := range recordContents(contents) {
+			if content.FunctionCallResult == nil {
+				rc.history = append(rc.history, Message{Role: "user", Content: content.Text})
+				continue
+			}
+			b, _ := json.Marshal(content.FunctionCallResult.Result)
+			rc.history = append(rc.history, Message{Role: "tool", Content: string(b)})
+		}
+		rc.history = append(rc.history, answer)
+	}
+	return responses, nil
+}
+
+func (rc *replayChat) Send(ctx context.Context, contents ...any) (gollm.ChatResponse, error) {
+	exchange, err := rc.nextExchange(contents)
+	if err != nil {
+		return nil, err
+	}
+	responses, err := rc.replayResponses(contents, exchange)
+	if err != nil {
+		return nil, err
+	}
+	if exchange.Error != nil {
+		return nil, exchange.Error.err()
+	}
+	if len(responses) == 0 {
+		return nil, fmt.Errorf("message %d of chat %d has no recorded response", rc.next-1, rc.index)
+	}
+	return responses[0], nil
+}
+
+// SendStreaming replays the recorded chunks, an error recorded before the stream started is returned right away.
+func (rc *replayChat) SendStreaming(ctx context.Context, contents ...any) (gollm.ChatResponseIterator, error) {
+	exchange, err := rc.nextExchange(contents)
+	if err != nil {
+		return nil, err
+	}
+	responses, err := rc.replayResponses(contents, exchange)
+	if err != nil {
+		return nil, err
+	}
+	if exchange.Error != nil && len(responses) == 0 {
+		return nil, exchange.Error.err()
+	}
+	return func(yield func(gollm.ChatResponse, error) bool) {
+		for _, resp := range responses {
+			if !yield(resp, nil) {
+				return
+			}
+		}
+		if exchange.Error != nil {
+			yield(nil, exchange.Error.err())
+		}
+	}, nil
+}
+
+func (rc *replayChat) History() []Message {
+	return rc.history
+}
+
+func (rc *replayChat) ReplaceContent(i int, content string) error {
+	if i < 1 || i >= len(rc.history) || rc.history[i].Role == "assistant" {
+		return fmt.Errorf("message %d is neither a user message nor a tool call result", i)
+	}
+	rc.history[i].Content = content
+	return nil
+}
+
+type replayResponse struct {
+	recorded *RecordedResponse
+}
+
+var _ gollm.ChatResponse = (*replayResponse)(nil)
+
+func (r *replayResponse) UsageMetadata() any {
+	return r.recorded.Usage
+}
+
+func (r *replayResponse) Candidates() []gollm.Candidate {
+	return []gollm.Candidate{&replayCandidate{recorded: r.recorded}}
+}
+
+type replayCandidate struct {
+	recorded *RecordedResponse
+}
+
+var _ gollm.Candidate = (*replayCandidate)(nil)
+
+func (c *replayCandidate) Parts() []gollm.Part {
+	var parts []gollm.Part
+	if c.recorded.Text != "" {
+		parts = append(parts, &replayPart{text: c.recorded.Text})
+	}
+	if len(c.recorded.FunctionCalls) > 0 {
+		parts = append(parts, &replayPart{calls: c.recorded.FunctionCalls})
+	}
+	return parts
+}
+
+func (c *replayCandidate) String() string {
+	return fmt.Sprintf("Candidate(Content: %q, FunctionCalls: %d)", c.recorded.Text, len(c.recorded.FunctionCalls))
+}
+
+type replayPart struct {
+	text  string
+	calls []gollm.FunctionCall
+}
+
+var _ gollm.Part = (*replayPart)(nil)
+
+func (p *replayPart) AsText() (string, bool) {
+	return p.text, p.text != ""
+}
+
+func (p *replayPart) AsFunctionCalls() ([]gollm.FunctionCall, bool) {
+	return p.calls, len(p.calls) > 0
+}
@@ -0,0 +1,358 @@
+package gollm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/GoogleCloudPlatform/kubectl-ai/gollm"
+)
+
+// Endpoint is a client serving a model.
+type Endpoint struct {
+	Name   string
+	Client gollm.Client
+
+	// Model is the ID of the model, the model requested by the caller is used if empty.
+	Model string
+
+	// Timeout bounds the time until the model starts answering, no timeout if zero.
+	Timeout time.Duration
+}
+
+func (e *Endpoint) String() string {
+	if e.Model == "" {
+		return e.Name
+	}
+	return fmt.Sprintf("%s (%s)", e.Name, e.Model)
+}
+
+// model returns the model of the endpoint, or the requested model.
+func (e *Endpoint) model(requested string) string {
+	if e.Model != "" {
+		return e.Model
+	}
+	return requested
+}
+
+// FallbackEvent describes a request which failed on an endpoint and is sent to the next one.
+type FallbackEvent struct {
+	From, To string
+	Err      error
+
+	// HistoryLost is true if the history of the chat could not be carried over to the next endpoint.
+	HistoryLost bool
+}
+
+// FallbackChat is implemented by chats falling back to other endpoints.
+type FallbackChat interface {
+	// SetFallbackHandler sets the function called when the chat falls back to the next endpoint.
+	SetFallbackHandler(func(FallbackEvent))
+}
+
+// ModelReporter is implemented by the chats and the completion responses of a chain, whose model depends on the
+// endpoint which served the request.
+type ModelReporter interface {
+	// ServedModel returns the ID of the model which served the last request, empty if unknown.
+	ServedModel() string
+}
+
+// Chain is a client sending the requests to a chain of endpoints, falling back to the next endpoint when
+// a request fails or times out. Chats stay on the endpoint they fell back to.
+type Chain struct {
+	endpoints []*Endpoint
+
+	// active is the endpoint which served the last request of a chat
+	active *Endpoint
+}
+
+var _ gollm.Client = &Chain{}
+
+// NewChain creates a client falling back along the endpoints, in order.
+func NewChain(endpoints ...*Endpoint) (*Chain, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("a chain needs at least one endpoint")
+	}
+	return &Chain{endpoints: endpoints}, nil
+}
+
+// Endpoints returns the endpoints of the chain, in order.
+func (c *Chain) Endpoints() []*Endpoint {
+	return c.endpoints
+}
+
+// String describes the chain, marking the endpoint which served the last chat request.
+func (c *Chain) String() string {
+	var parts []string
+	for _, e := range c.endpoints {
+		s := e.String()
+		if e == c.active {
+			s += " [active]"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " -> ")
+}
+
+// Close closes the clients of all the endpoints.
+func (c *Chain) Close() error {
+	var errs []error
+	for _, e := range c.endpoints {
+		errs = append(errs, e.Client.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// StartChat starts a chat on every endpoint, the requests are sent to the first one until it fails.
+func (c *Chain) StartChat(systemPrompt, model string) gollm.Chat {
+	chat := &chainChat{chain: c, model: model}
+	for _, e := range c.endpoints {
+		chat.chats = append(chat.chats, e.Client.StartChat(systemPrompt, e.model(model)))
+	}
+	return chat
+}
+
+// GenerateCompletion generates the completion with the first endpoint which succeeds.
+func (c *Chain) GenerateCompletion(ctx context.Context, req *gollm.CompletionRequest) (gollm.CompletionResponse, error) {
+	var errs []error
+	for _, e := range c.endpoints {
+		r := *req
+		r.Model = e.model(req.Model)
+		reqCtx, cancel := withTimeout(ctx, e.Timeout)
+		resp, err := e.Client.GenerateCompletion(reqCtx, &r)
+		cancel()
+		if err == nil {
+			return &chainCompletionResponse{CompletionResponse: resp, model: r.Model}, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		err = timeoutError(reqCtx, e, err)
+		klog.Warningf("completion failed on %s: %v", e, err)
+		errs = append(errs, fmt.Errorf("%s: %w", e.Name, err))
+	}
+	return nil, fmt.Errorf("all the models failed: %w", errors.Join(errs...))
+}
+
+// SetResponseSchema sets the schema on all the endpoints.
+func (c *Chain) SetResponseSchema(schema *gollm.Schema) error {
+	for _, e := range c.endpoints {
+		if err := e.Client.SetResponseSchema(schema); err != nil {
+			return fmt.Errorf("%s: %w", e.Name, err)
+		}
+	}
+	return nil
+}
+
+// ListModels lists the models of all the endpoints, prefixed with the name of the endpoint.
+func (c *Chain) ListModels(ctx context.Context) ([]string, error) {
+	var names []string
+	var errs []error
+	for _, e := range c.endpoints {
+		models, err := e.Client.ListModels(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.Name, err))
+			continue
+		}
+		for _, m := range models {
+			names = append(names, e.Name+"/"+m)
+		}
+	}
+	if len(names) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return names, nil
+}
+
+// withTimeout bounds the context if timeout is not zero.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timeoutError reports the requests which failed as the endpoint timed out.
+func timeoutError(reqCtx context.Context, e *Endpoint, err error) error {
+	if errors.Is(reqCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("no answer within %s: %w", e.Timeout, err)
+	}
+	return err
+}
+
+// chainCompletionResponse is a completion response of a chain, telling the model which generated it.
+type chainCompletionResponse struct {
+	gollm.CompletionResponse
+	model string
+}
+
+var _ ModelReporter = &chainCompletionResponse{}
+
+func (r *chainCompletionResponse) ServedModel() string {
+	return r.model
+}
+
+// chainChat is a chat on every endpoint of a chain, of which one is active.
+type chainChat struct {
+	chain *Chain
+	chats []gollm.Chat
+
+	// model is the model requested when the chat started
+	model string
+
+	// active is the index of the chat the requests are sent to
+	active int
+
+	// started is true once the active chat answered, its history must be carried over when falling back
+	started bool
+
+	onFallback func(FallbackEvent)
+}
+
+var (
+	_ gollm.Chat    = &chainChat{}
+	_ HistoryEditor = &chainChat{}
+	_ FallbackChat  = &chainChat{}
+	_ ModelReporter = &chainChat{}
+)
+
+// ServedModel returns the model of the active endpoint, which served the last request.
+func (cc *chainChat) ServedModel() string {
+	return cc.chain.endpoints[cc.active].model(cc.model)
+}
+
+func (cc *chainChat) SetFallbackHandler(f func(FallbackEvent)) {
+	cc.onFallback = f
+}
+
+func (cc *chainChat) Send(ctx context.Context, contents ...any) (gollm.ChatResponse, error) {
+	response, cancel, err := fallback(ctx, cc, func(ctx context.Context, chat gollm.Chat) (gollm.ChatResponse, error) {
+		return chat.Send(ctx, contents...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	cancel()
+	return response, nil
+}
+
+// SendStreaming falls back until a stream started, the timeout of the endpoint only bounds the time until then.
+func (cc *chainChat) SendStreaming(ctx context.Context, contents ...any) (gollm.ChatResponseIterator, error) {
+	stream, cancel, err := fallback(ctx, cc, func(ctx context.Context, chat gollm.Chat) (gollm.ChatResponseIterator, error) {
+		return chat.SendStreaming(ctx, contents...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func(yield func(gollm.ChatResponse, error) bool) {
+		defer cancel()
+		for response, err := range stream {
+			if !yield(response, err) {
+				return
+			}
+		}
+	}, nil
+}
+
+// fallback sends the request to the active chat, then to the next ones until one succeeds. It returns the
+// function releasing the context of the request which succeeded, once its response was read.
+func fallback[T any](ctx context.Context, cc *chainChat, request func(context.Context, gollm.Chat) (T, error)) (T, context.CancelFunc, error) {
+	var zero T
+	var errs []error
+	for i := cc.active; i < len(cc.chats); i++ {
+		e := cc.chain.endpoints[i]
+		reqCtx, cancel := context.WithCancel(ctx)
+		var timer *time.Timer
+		if e.Timeout > 0 {
+			timer = time.AfterFunc(e.Timeout, cancel)
+		}
+		result, err := request(reqCtx, cc.chats[i])
+		timedOut := timer != nil && !timer.Stop()
+		if err == nil && !timedOut {
+			cc.started = true
+			cc.chain.active = e
+			return result, cancel, nil
+		}
+		cancel()
+		if ctx.Err() != nil {
+			return zero, nil, ctx.Err()
+		}
+		if timedOut {
+			err = fmt.Errorf("no answer within %s: %w", e.Timeout, context.DeadlineExceeded)
+		}
+		klog.Warningf("request failed on %s: %v", e, err)
+		errs = append(errs, fmt.Errorf("%s: %w", e.Name, err))
+		if i+1 < len(cc.chats) {
+			cc.switchTo(i+1, err)
+		}
+	}
+	if len(errs) == 1 {
+		return zero, nil, errors.Unwrap(errs[0])
+	}
+	return zero, nil, fmt.Errorf("all the models failed: %w", errors.Join(errs...))
+}
+
+// switchTo makes the i-th chat active, carrying the history over if the chats allow it.
+func (cc *chainChat) switchTo(i int, err error) {
+	from, to := cc.chats[cc.active], cc.chats[i]
+	historyLost := false
+	if cc.started {
+		switch fromSession := from.(type) {
+		case *openAIChatSession:
+			toSession, ok := to.(*openAIChatSession)
+			if ok {
+				toSession.history = slices.Clone(fromSession.history)
+			}
+			historyLost = !ok
+		case *anthropicChatSession:
+			toSession, ok := to.(*anthropicChatSession)
+			if ok {
+				toSession.history = slices.Clone(fromSession.history)
+			}
+			historyLost = !ok
+		default:
+			historyLost = true
+		}
+	}
+	event := FallbackEvent{From: cc.chain.endpoints[cc.active].String(), To: cc.chain.endpoints[i].String(), Err: err, HistoryLost: historyLost}
+	cc.active = i
+	cc.started = cc.started && !historyLost
+	if cc.onFallback != nil {
+		cc.onFallback(event)
+	}
+}
+
+func (cc *chainChat) SetFunctionDefinitions(defs []*gollm.FunctionDefinition) error {
+	for i, chat := range cc.chats {
+		if err := chat.SetFunctionDefinitions(defs); err != nil {
+			return fmt.Errorf("%s: %w", cc.chain.endpoints[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// IsRetryableError classifies the errors as the active chat does, once all the endpoints failed.
+func (cc *chainChat) IsRetryableError(err error) bool {
+	return cc.chats[cc.active].IsRetryableError(err)
+}
+
+// History returns the history of the active chat, if it exposes it.
+func (cc *chainChat) History() []Message {
+	if h, ok := cc.chats[cc.active].(HistoryEditor); ok {
+		return h.History()
+	}
+	return nil
+}
+
+// ReplaceContent edits the history of the active chat, if it exposes it.
+func (cc *chainChat) ReplaceContent(i int, content string) error {
+	if h, ok := cc.chats[cc.active].(HistoryEditor); ok {
+		return h.ReplaceContent(i, content)
+	}
+	return fmt.Errorf("the history of %s can not be edited", cc.chain.endpoints[cc.active])
+}
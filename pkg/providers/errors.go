@@ -0,0 +1,74 @@
+package gollm
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	openai "github.com/openai/openai-go"
+
+	"github.com/GoogleCloudPlatform/kubectl-ai/gollm"
+)
+
+// rateLimitedError is an API error along with the delay the server asked to wait before retrying.
+type rateLimitedError struct {
+	*gollm.APIError
+	retryAfter time.Duration
+}
+
+func (e *rateLimitedError) Unwrap() error {
+	return e.APIError
+}
+
+// RetryAfter returns the delay of the Retry-After header.
+func (e *rateLimitedError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// apiError converts the errors of the OpenAI API to gollm.APIError, so that they can be classified
+// by gollm.DefaultIsRetryableError, keeping the delay of the Retry-After header if there is one.
+func apiError(err error) error {
+	var openaiErr *openai.Error
+	if !errors.As(err, &openaiErr) {
+		return err
+	}
+	e := &gollm.APIError{StatusCode: openaiErr.StatusCode, Message: openaiErr.Message, Err: err}
+	if openaiErr.Response != nil {
+		if d := retryAfter(openaiErr.Response.Header); d > 0 {
+			return &rateLimitedError{APIError: e, retryAfter: d}
+		}
+	}
+	return e
+}
+
+// retryAfter parses the delay of the retry-after-ms header sent by OpenAI, or the standard Retry-After header
+// in seconds or as an HTTP date. It returns zero if there is none.
+func retryAfter(h http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(h.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(v, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// IsRetryableError returns true for rate limits, server errors, timeouts and connections
+// closed by the server or a proxy before the response was complete.
+func (cs *openAIChatSession) IsRetryableError(err error) bool {
+	if gollm.DefaultIsRetryableError(err) {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
@@ -0,0 +1,72 @@
+package gollm
+
+import (
+	"encoding/json"
+	"fmt"
+
+	openai "github.com/openai/openai-go"
+)
+
+// Message is a message of the history of a chat.
+type Message struct {
+	// Role is one of system, user, assistant or tool.
+	Role string
+
+	// Content is the text of the message, along with the JSON of the tool calls of assistant messages.
+	Content string
+}
+
+// HistoryEditor is implemented by chats whose history can be inspected and compacted.
+type HistoryEditor interface {
+	// History returns the messages of the history, oldest first.
+	History() []Message
+
+	// ReplaceContent replaces the text of the i-th message of the history, which must be a user or tool message.
+	ReplaceContent(i int, content string) error
+}
+
+var _ HistoryEditor = &openAIChatSession{}
+
+// History returns the messages sent to and received from the model so far, starting with the system prompt.
+func (cs *openAIChatSession) History() []Message {
+	messages := make([]Message, 0, len(cs.history))
+	for _, m := range cs.history {
+		switch {
+		case m.OfSystem != nil:
+			messages = append(messages, Message{Role: "system", Content: m.OfSystem.Content.OfString.Value})
+		case m.OfUser != nil:
+			messages = append(messages, Message{Role: "user", Content: m.OfUser.Content.OfString.Value})
+		case m.OfTool != nil:
+			messages = append(messages, Message{Role: "tool", Content: m.OfTool.Content.OfString.Value})
+		case m.OfAssistant != nil:
+			content := m.OfAssistant.Content.OfString.Value
+			if len(m.OfAssistant.ToolCalls) > 0 {
+				if b, err := json.Marshal(m.OfAssistant.ToolCalls); err == nil {
+					content += string(b)
+				}
+			}
+			messages = append(messages, Message{Role: "assistant", Content: content})
+		default:
+			messages = append(messages, Message{Role: "unknown"})
+		}
+	}
+	return messages
+}
+
+// ReplaceContent replaces the text of a user message or a tool call result, keeping the ID of the tool call
+// so that the history stays valid.
+func (cs *openAIChatSession) ReplaceContent(i int, content string) error {
+	if i < 0 || i >= len(cs.history) {
+		return fmt.Errorf("message %d is out of the history of %d messages", i, len(cs.history))
+	}
+	m := cs.history[i]
+	switch {
+	case m.OfUser != nil:
+		cs.history[i] = openai.UserMessage(content)
+	case m.OfTool != nil:
+		cs.history[i] = openai.ToolMessage(content, m.OfTool.ToolCallID)
+	default:
+		return fmt.Errorf("message %d is neither a user message nor a tool call result", i)
+	}
+	return nil
+}
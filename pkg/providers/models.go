@@ -0,0 +1,120 @@
+package gollm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// ModelInfo describes a model as reported by the server.
+type ModelInfo struct {
+	ID      string
+	OwnedBy string
+
+	// ContextLength is the maximum number of tokens of the context, zero if not reported.
+	ContextLength int
+
+	// SupportsTools reports whether the model supports function calling, nil if not reported.
+	SupportsTools *bool
+}
+
+func (m ModelInfo) String() string {
+	var details []string
+	if m.ContextLength > 0 {
+		details = append(details, fmt.Sprintf("context length %d", m.ContextLength))
+	}
+	if m.SupportsTools != nil {
+		if *m.SupportsTools {
+			details = append(details, "tools supported")
+		} else {
+			details = append(details, "tools not supported")
+		}
+	}
+	if len(details) == 0 {
+		return m.ID
+	}
+	return fmt.Sprintf("%s (%s)", m.ID, strings.Join(details, ", "))
+}
+
+// ModelInfoLister is implemented by clients reporting the capabilities of their models.
+type ModelInfoLister interface {
+	ListModelInfo(ctx context.Context) ([]ModelInfo, error)
+}
+
+var _ ModelInfoLister = &OpenAIClient{}
+
+// ListModelInfo lists the models of the /models endpoint along with the capabilities the server reports.
+// The OpenAI API only reports the IDs, OpenAI compatible servers such as vLLM, llama.cpp, LM Studio
+// or OpenRouter report more in non-standard fields.
+func (c *OpenAIClient) ListModelInfo(ctx context.Context) ([]ModelInfo, error) {
+	page, err := c.client.Models.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing OpenAI models: %w", err)
+	}
+	var models []ModelInfo
+	for _, m := range page.Data {
+		info := ModelInfo{ID: m.ID, OwnedBy: m.OwnedBy}
+		raw := map[string]any{}
+		if err := json.Unmarshal([]byte(m.RawJSON()), &raw); err != nil {
+			klog.V(1).Infof("error parsing model %q: %v", m.ID, err)
+		} else {
+			info.ContextLength = contextLength(raw)
+			info.SupportsTools = supportsTools(raw)
+		}
+		models = append(models, info)
+	}
+	return models, nil
+}
+
+// contextLengthFields are the fields servers report the context length in, e.g. max_model_len for vLLM.
+var contextLengthFields = []string{"context_length", "max_model_len", "context_window", "max_context_length", "max_input_tokens"}
+
+func contextLength(raw map[string]any) int {
+	for _, field := range contextLengthFields {
+		if n, ok := raw[field].(float64); ok && n > 0 {
+			return int(n)
+		}
+	}
+	// llama.cpp server
+	if meta, ok := raw["meta"].(map[string]any); ok {
+		if n, ok := meta["n_ctx_train"].(float64); ok && n > 0 {
+			return int(n)
+		}
+	}
+	return 0
+}
+
+// toolCapabilities are the capability names servers report function calling support with.
+var toolCapabilities = []string{"tools", "tool_use", "function_calling"}
+
+func supportsTools(raw map[string]any) *bool {
+	supported := func(b bool) *bool { return &b }
+	if b, ok := raw["supports_function_calling"].(bool); ok {
+		return supported(b)
+	}
+	switch capabilities := raw["capabilities"].(type) {
+	case []any:
+		// LM Studio, ollama
+		for _, c := range capabilities {
+			if s, ok := c.(string); ok && slices.Contains(toolCapabilities, s) {
+				return supported(true)
+			}
+		}
+		return supported(false)
+	case map[string]any:
+		for _, name := range toolCapabilities {
+			if b, ok := capabilities[name].(bool); ok {
+				return supported(b)
+			}
+		}
+	}
+	// OpenRouter
+	if params, ok := raw["supported_parameters"].([]any); ok {
+		return supported(slices.Contains(params, any("tools")))
+	}
+	return nil
+}
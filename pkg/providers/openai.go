@@ -20,8 +20,6 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
-	"os"
-	"strings"
 
 	openai "github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
@@ -38,39 +36,47 @@ func init() {
 }
 
 // newOpenAIClientFactory is the factory function for creating OpenAI clients.
+// The endpoint and credentials are read from environment variables, use NewOpenAIClient to configure them.
 func newOpenAIClientFactory(ctx context.Context, _ *url.URL) (gollm.Client, error) {
-	// The URL is not currently used for OpenAI config, relies on env vars.
-	return NewOpenAIClient(ctx)
+	return NewOpenAIClient(ctx, ClientOptions{})
 }
 
 // OpenAIClient implements the gollm.Client interface for OpenAI models.
 type OpenAIClient struct {
 	client openai.Client
+
+	// baseURL is the custom endpoint, empty for the OpenAI API.
+	baseURL string
 }
 
 // Ensure OpenAIClient implements the Client interface.
 var _ gollm.Client = &OpenAIClient{}
 
-// NewOpenAIClient creates a new client for interacting with OpenAI.
-// It reads the API key and optional endpoint from environment variables
-// OPENAI_API_KEY and OPENAI_ENDPOINT.
-func NewOpenAIClient(ctx context.Context) (*OpenAIClient, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		// The NewClient might handle this, but explicit check is safer
-		return nil, errors.New("OPENAI_API_KEY environment variable not set")
+// NewOpenAIClient creates a new client for interacting with OpenAI or an OpenAI compatible endpoint.
+// The API key and endpoint default to the environment variables OPENAI_API_KEY and OPENAI_ENDPOINT.
+func NewOpenAIClient(ctx context.Context, opts ClientOptions) (*OpenAIClient, error) {
+	opts = opts.withDefaults()
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	httpClient, err := opts.httpClient()
+	if err != nil {
+		return nil, err
 	}
 
-	endpoint := os.Getenv("OPENAI_ENDPOINT")
-	if endpoint != "" {
-		klog.Infof("Using custom OpenAI endpoint: %s", endpoint)
-		return &OpenAIClient{
-			client: openai.NewClient(option.WithBaseURL(endpoint)),
-		}, nil
+	// requests are retried by the caller, which reports the attempts, see IsRetryableError
+	requestOptions := []option.RequestOption{option.WithHTTPClient(httpClient), option.WithMaxRetries(0)}
+	if opts.APIKey != "" {
+		requestOptions = append(requestOptions, option.WithAPIKey(opts.APIKey))
+	}
+	if opts.BaseURL != "" {
+		klog.Infof("Using custom OpenAI endpoint: %s", opts.BaseURL)
+		requestOptions = append(requestOptions, option.WithBaseURL(opts.BaseURL))
 	}
 
 	return &OpenAIClient{
-		client: openai.NewClient(),
+		client:  openai.NewClient(requestOptions...),
+		baseURL: opts.BaseURL,
 	}, nil
 }
 
@@ -82,14 +88,13 @@ func (c *OpenAIClient) Close() error {
 
 // StartChat starts a new chat session.
 func (c *OpenAIClient) StartChat(systemPrompt, model string) gollm.Chat {
-	originalModel := model // Keep track of the original for logging
-	// Default to gpt-4o if no model is specified or if it doesn't look like a known OpenAI prefix
-	if model == "" || (!strings.HasPrefix(model, "gpt-") && !strings.HasPrefix(model, "o-")) {
-		model = "gpt-4o"
-		if originalModel == "" {
+	// Model IDs are passed through as is, OpenAI compatible servers serve models of any name
+	if model == "" {
+		if c.baseURL == "" {
+			model = "gpt-4o"
 			klog.V(1).Info("No model specified, defaulting to gpt-4o")
 		} else {
-			klog.V(1).Infof("Model '%s' does not match expected prefix, defaulting to gpt-4o", originalModel)
+			klog.Warningf("No model specified, the default model of %s is used", c.baseURL)
 		}
 	}
 	klog.V(1).Infof("Starting new OpenAI chat session with model: %s", model)
@@ -160,11 +165,17 @@ func (c *OpenAIClient) SetResponseSchema(schema *gollm.Schema) error {
 	return nil
 }
 
-// ListModels is not implemented yet.
+// ListModels lists the IDs of the models served by the /models endpoint.
 func (c *OpenAIClient) ListModels(ctx context.Context) ([]string, error) {
-	// TODO: Implement listing OpenAI models using c.client
-	klog.Warning("OpenAIClient.ListModels is not implemented yet")
-	return []string{}, nil
+	models, err := c.ListModelInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, m := range models {
+		names = append(names, m.ID)
+	}
+	return names, nil
 }
 
 // --- Chat Session Implementation ---
@@ -217,45 +228,21 @@ func (cs *openAIChatSession) SetFunctionDefinitions(defs []*gollm.FunctionDefini
 func (cs *openAIChatSession) Send(ctx context.Context, contents ...any) (gollm.ChatResponse, error) {
 	klog.V(1).InfoS("openAIChatSession.Send called", "model", cs.model, "history_len", len(cs.history))
 
-	// 1. Append user message(s) to history
-	for _, content := range contents {
-		switch c := content.(type) {
-		case string:
-			klog.V(2).Infof("Adding user message to history: %s", c)
-			cs.history = append(cs.history, openai.UserMessage(c))
-		case gollm.FunctionCallResult:
-			klog.V(2).Infof("Adding tool call result to history: Name=%s, ID=%s", c.Name, c.ID)
-			// Marshal the result map into a JSON string for the message content
-			resultJSON, err := json.Marshal(c.Result)
-			if err != nil {
-				klog.Errorf("Failed to marshal function call result: %v", err)
-				return nil, fmt.Errorf("failed to marshal function call result %q: %w", c.Name, err)
-			}
-			cs.history = append(cs.history, openai.ToolMessage(string(resultJSON), c.ID))
-		default:
-			// TODO: Handle other content types if necessary?
-			klog.Warningf("Unhandled content type in Send: %T", content)
-			return nil, fmt.Errorf("unhandled content type: %T", content)
-		}
+	// 1. Build the messages, the history is only updated once the request succeeded
+	messages, err := cs.appendContents(contents)
+	if err != nil {
+		return nil, err
 	}
 
 	// 2. Prepare the API request
-	chatReq := openai.ChatCompletionNewParams{
-		Model:    openai.ChatModel(cs.model),
-		Messages: cs.history,
-	}
-	if len(cs.tools) > 0 {
-		chatReq.Tools = cs.tools
-		// chatReq.ToolChoice = openai.ToolChoiceAuto // Or specify if needed
-	}
+	chatReq := cs.newParams(messages)
 
 	// 3. Call the OpenAI API
 	klog.V(1).InfoS("Sending request to OpenAI Chat API", "model", cs.model, "messages", len(chatReq.Messages), "tools", len(chatReq.Tools))
 	completion, err := cs.client.Chat.Completions.New(ctx, chatReq)
 	if err != nil {
-		// TODO: Check if error is retryable using cs.IsRetryableError
 		klog.Errorf("OpenAI ChatCompletion API error: %v", err)
-		return nil, fmt.Errorf("OpenAI chat completion failed: %w", err)
+		return nil, fmt.Errorf("OpenAI chat completion failed: %w", apiError(err))
 	}
 	klog.V(1).InfoS("Received response from OpenAI Chat API", "id", completion.ID, "choices", len(completion.Choices))
 
@@ -268,7 +255,7 @@ func (cs *openAIChatSession) Send(ctx context.Context, contents ...any) (gollm.C
 	// Add assistant's response (first choice) to history
 	assistantMsg := completion.Choices[0].Message
 	// Convert to param type before appending to history
-	cs.history = append(cs.history, assistantMsg.ToParam())
+	cs.history = append(messages, assistantMsg.ToParam())
 	klog.V(2).InfoS("Added assistant message to history", "content_present", assistantMsg.Content != "", "tool_calls", len(assistantMsg.ToolCalls))
 
 	// Wrap the response
@@ -279,40 +266,118 @@ func (cs *openAIChatSession) Send(ctx context.Context, contents ...any) (gollm.C
 	return resp, nil
 }
 
+// appendContents converts the user message(s) and function call results and appends them to a copy of the history.
+func (cs *openAIChatSession) appendContents(contents []any) ([]openai.ChatCompletionMessageParamUnion, error) {
+	messages := append([]openai.ChatCompletionMessageParamUnion(nil), cs.history...)
+	for _, content := range contents {
+		switch c := content.(type) {
+		case string:
+			klog.V(2).Infof("Adding user message to history: %s", c)
+			messages = append(messages, openai.UserMessage(c))
+		case gollm.FunctionCallResult:
+			klog.V(2).Infof("Adding tool call result to history: Name=%s, ID=%s", c.Name, c.ID)
+			// Marshal the result map into a JSON string for the message content
+			resultJSON, err := json.Marshal(c.Result)
+			if err != nil {
+				klog.Errorf("Failed to marshal function call result: %v", err)
+				return nil, fmt.Errorf("failed to marshal function call result %q: %w", c.Name, err)
+			}
+			messages = append(messages, openai.ToolMessage(string(resultJSON), c.ID))
+		default:
+			// TODO: Handle other content types if necessary?
+			klog.Warningf("Unhandled content type in Send: %T", content)
+			return nil, fmt.Errorf("unhandled content type: %T", content)
+		}
+	}
+	return messages, nil
+}
+
+// newParams builds the chat completion request for the messages.
+func (cs *openAIChatSession) newParams(messages []openai.ChatCompletionMessageParamUnion) openai.ChatCompletionNewParams {
+	chatReq := openai.ChatCompletionNewParams{
+		Model:    openai.ChatModel(cs.model),
+		Messages: messages,
+	}
+	if len(cs.tools) > 0 {
+		chatReq.Tools = cs.tools
+		// chatReq.ToolChoice = openai.ToolChoiceAuto // Or specify if needed
+	}
+	return chatReq
+}
+
 // SendStreaming sends the user message(s) and returns an iterator for the LLM response stream.
-// NOTE: Due to limitations in the openai-go v0.1.0-beta.10 library, this function
-// simulates streaming by making a single non-streaming call and returning an iterator
-// that yields the single response. This satisfies the agent's interface requirement.
+// Text is yielded as it arrives. Tool calls are streamed as partial argument deltas, so they are
+// accumulated and yielded along with the token usage in a final response once the stream ended.
 func (cs *openAIChatSession) SendStreaming(ctx context.Context, contents ...any) (gollm.ChatResponseIterator, error) {
-	klog.V(1).InfoS("openAIChatSession.SendStreaming called (simulated)", "model", cs.model)
+	klog.V(1).InfoS("openAIChatSession.SendStreaming called", "model", cs.model, "history_len", len(cs.history))
 
-	// Call the non-streaming Send method we implemented earlier
-	singleResponse, err := cs.Send(ctx, contents...)
+	messages, err := cs.appendContents(contents)
 	if err != nil {
-		// Send already logs errors, just wrap it
-		return nil, fmt.Errorf("simulated streaming failed during non-streaming call: %w", err)
+		return nil, err
+	}
+	chatReq := cs.newParams(messages)
+	chatReq.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
+
+	klog.V(1).InfoS("Sending streaming request to OpenAI Chat API", "model", cs.model, "messages", len(chatReq.Messages), "tools", len(chatReq.Tools))
+	stream := cs.client.Chat.Completions.NewStreaming(ctx, chatReq)
+	// the request is sent right away, report errors such as an unreachable endpoint before streaming
+	if err := stream.Err(); err != nil {
+		stream.Close()
+		klog.Errorf("OpenAI ChatCompletion API error: %v", err)
+		return nil, fmt.Errorf("OpenAI chat completion failed: %w", apiError(err))
 	}
 
-	// Return an iterator function that yields the single response once.
-	var yielded bool
-	iteratorFunc := func(yield func(gollm.ChatResponse, error) bool) {
-		if !yielded {
-			yielded = true
-			// Yield the single response. If yield returns false, stop early.
-			if !yield(singleResponse, nil) {
+	return func(yield func(gollm.ChatResponse, error) bool) {
+		defer stream.Close()
+
+		acc := openai.ChatCompletionAccumulator{}
+		for stream.Next() {
+			chunk := stream.Current()
+			if !acc.AddChunk(chunk) {
+				yield(nil, fmt.Errorf("accumulating OpenAI chat completion chunk %q", chunk.ID))
+				return
+			}
+			// only the first choice is used, as in Send
+			if len(chunk.Choices) == 0 || chunk.Choices[0].Index != 0 || chunk.Choices[0].Delta.Content == "" {
+				continue
+			}
+			delta := &openai.ChatCompletion{
+				ID: chunk.ID,
+				Choices: []openai.ChatCompletionChoice{
+					{Message: openai.ChatCompletionMessage{Content: chunk.Choices[0].Delta.Content}},
+				},
+			}
+			if !yield(&openAIChatResponse{openaiCompletion: delta}, nil) {
 				return
 			}
 		}
-		// Subsequent calls do nothing, effectively ending the stream.
-	}
-
-	return iteratorFunc, nil
-}
+		if err := stream.Err(); err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			klog.Errorf("OpenAI ChatCompletion stream error: %v", err)
+			yield(nil, fmt.Errorf("OpenAI chat completion stream failed: %w", err))
+			return
+		}
+		if len(acc.Choices) == 0 {
+			yield(nil, errors.New("received empty response from OpenAI (no choices)"))
+			return
+		}
 
-// IsRetryableError returns false for now.
-func (cs *openAIChatSession) IsRetryableError(err error) bool {
-	// TODO: Implement actual retry logic if needed
-	return false
+		assistantMsg := acc.Choices[0].Message
+		cs.history = append(messages, assistantMsg.ToParam())
+		klog.V(1).InfoS("Received streaming response from OpenAI Chat API", "id", acc.ID, "content_present", assistantMsg.Content != "", "tool_calls", len(assistantMsg.ToolCalls))
+
+		// the text was already streamed, the final response carries the tool calls and the usage
+		final := &openai.ChatCompletion{
+			ID: acc.ID,
+			Choices: []openai.ChatCompletionChoice{
+				{FinishReason: acc.Choices[0].FinishReason, Message: openai.ChatCompletionMessage{ToolCalls: assistantMsg.ToolCalls}},
+			},
+			Usage: acc.Usage,
+		}
+		yield(&openAIChatResponse{openaiCompletion: final}, nil)
+	}, nil
 }
 
 // --- Helper structs for ChatResponse interface ---
@@ -0,0 +1,162 @@
+package gollm
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ClientOptions configure the connection to an OpenAI compatible endpoint, or to the Anthropic API.
+type ClientOptions struct {
+	// BaseURL is the URL of the API, e.g. https://granite.example.com/v1. Defaults to OPENAI_ENDPOINT,
+	// or the OpenAI API if not set either. ANTHROPIC_BASE_URL and the Anthropic API for Anthropic clients.
+	BaseURL string
+
+	// APIKey authenticates the requests. Defaults to OPENAI_API_KEY, it is only required for the OpenAI API.
+	// ANTHROPIC_API_KEY for Anthropic clients, required unless BaseURL points to a gateway.
+	APIKey string
+
+	// CACert is the path to a PEM bundle of CAs trusted in addition to the system ones, e.g. a private CA.
+	CACert string
+
+	// ClientCert and ClientKey are the paths to the PEM certificate and key authenticating the client with mTLS.
+	ClientCert string
+	ClientKey  string
+
+	// Proxy is the URL of the HTTP proxy, defaults to HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+	Proxy string
+}
+
+// withDefaults fills in the unset options from the environment.
+func (o ClientOptions) withDefaults() ClientOptions {
+	if o.BaseURL == "" {
+		o.BaseURL = os.Getenv("OPENAI_ENDPOINT")
+	}
+	if o.APIKey == "" {
+		o.APIKey = os.Getenv("OPENAI_API_KEY")
+	}
+	return o
+}
+
+// Validate checks the options are consistent and the files they refer to can be loaded.
+func (o ClientOptions) Validate() error {
+	o = o.withDefaults()
+	if o.BaseURL == "" && o.APIKey == "" {
+		return errors.New("an API key is required for the OpenAI API, set --api-key or OPENAI_API_KEY, or --model-url for a self-hosted endpoint")
+	}
+	return o.validateConnection()
+}
+
+// validateConnection checks the URL, the proxy and the certificates.
+func (o ClientOptions) validateConnection() error {
+	if o.BaseURL != "" {
+		u, err := url.Parse(o.BaseURL)
+		if err != nil {
+			return fmt.Errorf("invalid model URL %q: %w", o.BaseURL, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid model URL %q, it must be an http or https URL", o.BaseURL)
+		}
+	}
+	if o.Proxy != "" {
+		if _, err := url.Parse(o.Proxy); err != nil {
+			return fmt.Errorf("invalid proxy URL %q: %w", o.Proxy, err)
+		}
+	}
+	if (o.ClientCert == "") != (o.ClientKey == "") {
+		return errors.New("the client certificate and key must be set together")
+	}
+	_, err := o.tlsConfig()
+	return err
+}
+
+// tlsConfig returns the TLS configuration trusting the CA bundle and presenting the client certificate,
+// nil if neither is set.
+func (o ClientOptions) tlsConfig() (*tls.Config, error) {
+	if o.CACert == "" && o.ClientCert == "" {
+		return nil, nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.CACert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		b, err := os.ReadFile(o.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA certificate: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no PEM certificates found in CA certificate %q", o.CACert)
+		}
+		config.RootCAs = pool
+	}
+	if o.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(o.ClientCert, o.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// httpClient builds the HTTP client connecting to the endpoint.
+func (o ClientOptions) httpClient() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	config, err := o.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		transport.TLSClientConfig = config
+	}
+	if o.Proxy != "" {
+		proxy, err := url.Parse(o.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %w", o.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// CheckEndpoint fails if the endpoint can not be reached or rejects the API key.
+// It lists the models, endpoints which do not support listing them are considered reachable.
+func CheckEndpoint(ctx context.Context, opts ClientOptions) error {
+	opts = opts.withDefaults()
+	client, err := opts.httpClient()
+	if err != nil {
+		return err
+	}
+	baseURL := opts.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/models", nil)
+	if err != nil {
+		return fmt.Errorf("invalid model URL %q: %w", baseURL, err)
+	}
+	if opts.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.APIKey)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("model endpoint %q is unreachable: %w", baseURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("model endpoint %q rejected the API key: %s", baseURL, resp.Status)
+	}
+	return nil
+}
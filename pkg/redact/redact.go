@@ -0,0 +1,372 @@
+// Package redact masks Secrets and credentials in tool output before it is sent to the LLM.
+//
+// Kubernetes objects found in the output, e.g. of `kubectl get -o yaml`, are redacted field by field:
+// the data of Secrets, the credentials of kubeconfigs and the values of sensitive environment variables.
+// Any other text is scanned for private keys, bearer and service account tokens, credentials in URLs
+// and sensitive key/value pairs such as `DB_PASSWORD: hunter2`. The output of command lines reading Secrets
+// is masked whole by SecretOutput.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Mask replaces the redacted values.
+const Mask = "<redacted>"
+
+// Options configure what is never redacted.
+type Options struct {
+	// AllowKeys are glob patterns of field and variable names whose values are never redacted, e.g. "*_TOKEN_PATH".
+	AllowKeys []string
+
+	// AllowSecrets are glob patterns of the "namespace/name" of Secrets whose data is not redacted.
+	AllowSecrets []string
+}
+
+// defaultAllowKeys are sensitive looking keys which only name or reference credentials.
+var defaultAllowKeys = []string{
+	"*secretName", "*SecretName", "*secretNamespace", "*SecretNamespace", "*SECRET_NAME",
+	"secretRef", "secretKeyRef", "*TokenPath", "*TOKEN_PATH", "*TOKEN_FILE", "*PASSWORD_FILE",
+}
+
+// Redactor masks sensitive values.
+type Redactor struct {
+	allowKeys    []string
+	allowSecrets []string
+}
+
+// New validates the options and returns a redactor.
+func New(opts Options) (*Redactor, error) {
+	for _, patterns := range [][]string{opts.AllowKeys, opts.AllowSecrets} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid allowlist pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return &Redactor{
+		allowKeys:    append(append([]string(nil), defaultAllowKeys...), opts.AllowKeys...),
+		allowSecrets: opts.AllowSecrets,
+	}, nil
+}
+
+// Report counts the redacted values by what they were, e.g. "secret value".
+type Report map[string]int
+
+func (r Report) add(what string) {
+	r[what]++
+}
+
+// String summarizes the report, e.g. "2 secret values, 1 bearer token".
+func (r Report) String() string {
+	var parts []string
+	for what, n := range r {
+		if n > 1 {
+			what += "s"
+		}
+		parts = append(parts, fmt.Sprintf("%d %s", n, what))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// Value redacts a JSON like value, maps and slices are redacted in place.
+func (r *Redactor) Value(v any, report Report) any {
+	switch v := v.(type) {
+	case map[string]any:
+		r.Object(v, report)
+		return v
+	case []any:
+		for i := range v {
+			v[i] = r.Value(v[i], report)
+		}
+		return v
+	case string:
+		return r.Text(v, report)
+	}
+	return v
+}
+
+// Object redacts a map in place, Kubernetes objects are redacted according to their kind.
+func (r *Redactor) Object(obj map[string]any, report Report) {
+	kind, _ := obj["kind"].(string)
+	allowedData := false
+	switch {
+	case kind == "Secret":
+		allowedData = !r.secret(obj, report)
+	case kind == "Config" && obj["users"] != nil:
+		r.kubeconfig(obj, report)
+	}
+
+	// environment variables, e.g. {"name": "DB_PASSWORD", "value": "hunter2"}
+	if name, ok := obj["name"].(string); ok {
+		if value, ok := obj["value"].(string); ok && r.sensitiveKey(name) && sensitiveValue(value) {
+			obj["value"] = Mask
+			report.add("credential")
+		}
+	}
+
+	for k, v := range obj {
+		if allowedData && (k == "data" || k == "stringData") {
+			// the keys of allowlisted Secrets are not matched against the sensitive keys
+			continue
+		}
+		if s, ok := v.(string); ok && r.sensitiveKey(k) && sensitiveValue(s) {
+			obj[k] = Mask
+			report.add("credential")
+			continue
+		}
+		obj[k] = r.Value(v, report)
+	}
+}
+
+// secret masks the data of the Secret, it returns false if the Secret is allowlisted.
+func (r *Redactor) secret(obj map[string]any, report Report) bool {
+	metadata, _ := obj["metadata"].(map[string]any)
+	namespace, _ := metadata["namespace"].(string)
+	name, _ := metadata["name"].(string)
+	if r.allowedSecret(namespace, name) {
+		return false
+	}
+
+	for _, field := range []string{"data", "stringData"} {
+		data, ok := obj[field].(map[string]any)
+		if !ok {
+			continue
+		}
+		for k := range data {
+			data[k] = Mask
+			report.add("secret value")
+		}
+	}
+	// the last applied configuration contains the data as well
+	if annotations, ok := metadata["annotations"].(map[string]any); ok {
+		if _, ok := annotations["kubectl.kubernetes.io/last-applied-configuration"]; ok {
+			annotations["kubectl.kubernetes.io/last-applied-configuration"] = Mask
+			report.add("secret value")
+		}
+	}
+	return true
+}
+
+// allowedSecret returns true if the data of the Secret is not redacted.
+func (r *Redactor) allowedSecret(namespace, name string) bool {
+	for _, pattern := range r.allowSecrets {
+		if ok, _ := path.Match(pattern, namespace+"/"+name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// kubeconfigCredentials are the fields of kubeconfig users holding credentials.
+var kubeconfigCredentials = []string{"client-key-data", "token", "password", "id-token", "refresh-token", "client-secret", "access-token"}
+
+func (r *Redactor) kubeconfig(obj map[string]any, report Report) {
+	users, _ := obj["users"].([]any)
+	for _, u := range users {
+		user, _ := u.(map[string]any)
+		user, _ = user["user"].(map[string]any)
+		if user == nil {
+			continue
+		}
+		credentials := []map[string]any{user}
+		if authProvider, ok := user["auth-provider"].(map[string]any); ok {
+			if config, ok := authProvider["config"].(map[string]any); ok {
+				credentials = append(credentials, config)
+			}
+		}
+		for _, c := range credentials {
+			for _, field := range kubeconfigCredentials {
+				if v, ok := c[field].(string); ok && v != "" && v != "REDACTED" && v != "DATA+OMITTED" {
+					c[field] = Mask
+					report.add("kubeconfig credential")
+				}
+			}
+		}
+	}
+}
+
+var (
+	privateKeyRegexp  = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)
+	bearerRegexp      = regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9\-._~+/]{8,}=*`)
+	jwtRegexp         = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)
+	urlPasswordRegexp = regexp.MustCompile(`(\b[a-zA-Z][a-zA-Z0-9+.-]*://[^\s:/@]+:)[^\s@/]+@`)
+	flagRegexp        = regexp.MustCompile(`(?i)(--?[a-z0-9-]*(?:password|passwd|token|secret|api-key|apikey)[a-z0-9-]*(?:=|\s+))([^\s-][^\s]*)`)
+	// literalRegexp matches the literals of kubectl commands, e.g. `--from-literal=password=hunter2`
+	literalRegexp = regexp.MustCompile(`(--from-literal(?:=|\s+)["']?([A-Za-z0-9_.-]+)=)([^\s"']+)`)
+	// secretCommandRegexp matches the kubectl commands creating secrets, all their literals are secret
+	secretCommandRegexp = regexp.MustCompile(`\bsecret\s+generic\b`)
+	// keyValueRegexp matches `KEY: value` and `KEY=value` lines, e.g. of kubectl describe or env
+	keyValueRegexp = regexp.MustCompile(`(?m)^(\s*(?:-\s+)?["']?([A-Za-z0-9_.-]+)["']?\s*[:=][ \t]*)(\S[^\r\n]*?)[ \t]*$`)
+	// camelRegexp matches the word boundaries of camel case keys, e.g. in "clientSecret"
+	camelRegexp = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+	// wordSeparatorRegexp matches the separators of the words of keys, e.g. in "DB_PASSWORD" or "client-key-data"
+	wordSeparatorRegexp = regexp.MustCompile(`[^A-Za-z0-9]+`)
+)
+
+// Text redacts the text. Kubernetes objects in YAML or JSON are redacted field by field,
+// the remaining text with patterns.
+func (r *Redactor) Text(s string, report Report) string {
+	if objectText, ok := r.objects(s, report); ok {
+		// the string fields were redacted as text already, and the data of allowlisted Secrets is kept
+		return objectText
+	}
+
+	s = privateKeyRegexp.ReplaceAllStringFunc(s, func(string) string {
+		report.add("private key")
+		return Mask
+	})
+	s = jwtRegexp.ReplaceAllStringFunc(s, func(string) string {
+		report.add("service account token")
+		return Mask
+	})
+	s = bearerRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		report.add("bearer token")
+		return bearerRegexp.ReplaceAllString(m, "${1}"+Mask)
+	})
+	s = urlPasswordRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		report.add("password in URL")
+		return urlPasswordRegexp.ReplaceAllString(m, "${1}"+Mask+"@")
+	})
+	s = flagRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		sub := flagRegexp.FindStringSubmatch(m)
+		if sub[2] == Mask {
+			return m
+		}
+		report.add("credential")
+		return sub[1] + Mask
+	})
+	secretCommand := secretCommandRegexp.MatchString(s)
+	s = literalRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		sub := literalRegexp.FindStringSubmatch(m)
+		if sub[3] == Mask || (!secretCommand && !r.sensitiveKey(sub[2])) {
+			return m
+		}
+		report.add("credential")
+		return sub[1] + Mask
+	})
+	s = keyValueRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		sub := keyValueRegexp.FindStringSubmatch(m)
+		value := strings.Trim(sub[3], `"',`)
+		if !r.sensitiveKey(sub[2]) || !sensitiveValue(value) || strings.Contains(value, Mask) {
+			return m
+		}
+		report.add("credential")
+		return sub[1] + Mask
+	})
+	return s
+}
+
+// SecretOutput redacts the output of a command line reading Secrets, e.g. of
+// `kubectl get secret db -o jsonpath='{.data.password}' | base64 -d`. The values can not be told apart from
+// the remaining text, so the output is masked whole unless every named Secret is allowed.
+func (r *Redactor) SecretOutput(s, namespace string, names []string, report Report) string {
+	if strings.TrimSpace(s) == "" {
+		return s
+	}
+	allowed := len(names) > 0
+	for _, name := range names {
+		if !r.allowedSecret(namespace, name) {
+			allowed = false
+		}
+	}
+	if allowed {
+		return r.Text(s, report)
+	}
+	report.add("secret value")
+	return Mask
+}
+
+// objects redacts text consisting of Kubernetes objects, as printed by `kubectl get -o yaml|json`.
+// It returns false if the text is not such output.
+func (r *Redactor) objects(s string, report Report) (string, bool) {
+	trimmed := strings.TrimSpace(s)
+	isJSON := strings.HasPrefix(trimmed, "{")
+	if !isJSON && !strings.HasPrefix(trimmed, "apiVersion:") && !strings.HasPrefix(trimmed, "kind:") && !strings.Contains(s, "\nkind: ") {
+		return "", false
+	}
+
+	var docs []string
+	for _, doc := range strings.Split("\n"+s, "\n---") {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		obj := map[string]any{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil || obj["kind"] == nil {
+			return "", false
+		}
+		r.Object(obj, report)
+
+		var b []byte
+		var err error
+		if isJSON {
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			enc.SetIndent("", "    ")
+			err = enc.Encode(obj)
+			b = buf.Bytes()
+		} else {
+			b, err = yaml.Marshal(obj)
+		}
+		if err != nil {
+			return "", false
+		}
+		docs = append(docs, string(b))
+	}
+	return strings.Join(docs, "---\n"), true
+}
+
+// sensitiveWords are the words of keys naming credentials, sensitivePairs the pairs of words doing so.
+var (
+	sensitiveWords = map[string]bool{
+		"password": true, "passwords": true, "passwd": true, "pwd": true, "secret": true, "secrets": true,
+		"token": true, "tokens": true, "apikey": true, "credential": true, "credentials": true,
+	}
+	sensitivePairs = map[string]bool{"api key": true, "access key": true, "private key": true, "client key": true}
+)
+
+// sensitiveKey returns true if the key names a credential and is not allowlisted. The words of the key are matched
+// whole, so that e.g. "DB_PASSWORD" and "clientSecret" are sensitive but "tokenizer" is not.
+func (r *Redactor) sensitiveKey(key string) bool {
+	words := wordSeparatorRegexp.Split(strings.ToLower(camelRegexp.ReplaceAllString(key, "${1}_${2}")), -1)
+	sensitive := false
+	for i, word := range words {
+		if sensitiveWords[word] || (i > 0 && sensitivePairs[words[i-1]+" "+word]) {
+			sensitive = true
+			break
+		}
+	}
+	if !sensitive {
+		return false
+	}
+	for _, pattern := range r.allowKeys {
+		if ok, _ := path.Match(pattern, key); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// sensitiveValue returns false for values which can not be credentials, such as references
+// printed by kubectl describe, e.g. "<set to the key 'password' in secret 'db'>", booleans and sizes.
+func sensitiveValue(value string) bool {
+	switch {
+	case value == "", value == Mask, strings.HasPrefix(value, "<"):
+		return false
+	case strings.EqualFold(value, "true"), strings.EqualFold(value, "false"), strings.EqualFold(value, "null"):
+		return false
+	case strings.HasSuffix(value, " bytes"):
+		return false
+	}
+	return true
+}
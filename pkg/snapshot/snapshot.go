@@ -0,0 +1,152 @@
+// Package snapshot stores the state of the objects affected by mutating tool calls,
+// so that the changes made during a session can be rolled back.
+//
+// Snapshots are stored per session under ~/.kubectl-interact/snapshots/<session>/<call ID>.yaml.
+package snapshot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/homedir"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultDir is the directory the sessions store their snapshots in.
+var DefaultDir = filepath.Join(homedir.HomeDir(), ".kubectl-interact", "snapshots")
+
+// ObjectRef identifies an object.
+type ObjectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+func (r ObjectRef) String() string {
+	if r.Namespace == "" {
+		return strings.ToLower(r.Kind) + "/" + r.Name
+	}
+	return strings.ToLower(r.Kind) + "/" + r.Name + " -n " + r.Namespace
+}
+
+// RefOf returns the reference of the object.
+func RefOf(u *unstructured.Unstructured) ObjectRef {
+	return ObjectRef{APIVersion: u.GetAPIVersion(), Kind: u.GetKind(), Namespace: u.GetNamespace(), Name: u.GetName()}
+}
+
+// Snapshot is the state of the objects affected by a tool call, taken before it ran.
+type Snapshot struct {
+	// CallID is the ID of the tool call.
+	CallID  string    `json:"callID"`
+	Command string    `json:"command"`
+	Time    time.Time `json:"time"`
+
+	// Context is the kube context the command ran against.
+	Context string `json:"context,omitempty"`
+
+	// Objects are the affected objects which existed before the call, as they were.
+	Objects []map[string]any `json:"objects,omitempty"`
+
+	// Created are the objects which did not exist before the call.
+	Created []ObjectRef `json:"created,omitempty"`
+
+	// RolledBack is set once the snapshot was restored.
+	RolledBack *time.Time `json:"rolledBack,omitempty"`
+}
+
+// Unstructured returns the objects of the snapshot.
+func (s *Snapshot) Unstructured() []*unstructured.Unstructured {
+	objs := make([]*unstructured.Unstructured, 0, len(s.Objects))
+	for _, o := range s.Objects {
+		objs = append(objs, (&unstructured.Unstructured{Object: o}).DeepCopy())
+	}
+	return objs
+}
+
+// Refs returns the references of every object affected by the call.
+func (s *Snapshot) Refs() []ObjectRef {
+	var refs []ObjectRef
+	for _, u := range s.Unstructured() {
+		refs = append(refs, RefOf(u))
+	}
+	return append(refs, s.Created...)
+}
+
+// Store stores the snapshots of a session.
+type Store struct {
+	dir string
+}
+
+// NewStore creates the store of the session in dir.
+func NewStore(dir, session string) (*Store, error) {
+	d := filepath.Join(dir, session)
+	if err := os.MkdirAll(d, 0o700); err != nil {
+		return nil, fmt.Errorf("creating snapshot directory: %w", err)
+	}
+	return &Store{dir: d}, nil
+}
+
+// Dir returns the directory of the session.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Save writes the snapshot, replacing the one with the same call ID.
+func (s *Store) Save(snap *Snapshot) error {
+	b, err := yaml.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("converting snapshot to yaml: %w", err)
+	}
+	// snapshots may contain secrets
+	if err := os.WriteFile(s.path(snap.CallID), b, 0o600); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	return nil
+}
+
+// Get reads the snapshot of the tool call.
+func (s *Store) Get(callID string) (*Snapshot, error) {
+	b, err := os.ReadFile(s.path(callID))
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot: %w", err)
+	}
+	snap := &Snapshot{}
+	if err := yaml.Unmarshal(b, snap); err != nil {
+		return nil, fmt.Errorf("parsing snapshot %q: %w", callID, err)
+	}
+	return snap, nil
+}
+
+// List returns the snapshots of the session, oldest first.
+func (s *Store) List() ([]*Snapshot, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot directory: %w", err)
+	}
+	var snaps []*Snapshot
+	for _, e := range entries {
+		callID, ok := strings.CutSuffix(e.Name(), ".yaml")
+		if e.IsDir() || !ok {
+			continue
+		}
+		snap, err := s.Get(callID)
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, snap)
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].Time.Before(snaps[j].Time)
+	})
+	return snaps, nil
+}
+
+func (s *Store) path(callID string) string {
+	return filepath.Join(s.dir, callID+".yaml")
+}
@@ -84,26 +84,30 @@ Possible values:
 func (t *BashTool) Run(ctx context.Context, args map[string]any) (any, error) {
 	kubeconfig := ctx.Value("kubeconfig").(string)
 	workDir := ctx.Value("work_dir").(string)
-	command := args["command"].(string)
+	kubeContext, _ := ctx.Value("kube_context").(string)
+	command, _ := args["command"].(string)
+	if strings.TrimSpace(command) == "" {
+		return &ExecResult{Error: "the command argument is required, pass the command line to run as a string"}, nil
+	}
 
-	if strings.Contains(command, "kubectl edit") {
-		return &ExecResult{Error: "interactive mode not supported for kubectl, please use non-interactive commands"}, nil
+	parsed, err := ParseCommand(command)
+	if err != nil {
+		return &ExecResult{Error: fmt.Sprintf("invalid command: %v", err)}, nil
 	}
-	if strings.Contains(command, "kubectl port-forward") {
-		return &ExecResult{Error: "port-forwarding is not allowed because assistant is running in an unattended mode, please try some other alternative"}, nil
+	if result := guardCommand(parsed); result != nil {
+		return result, nil
 	}
 
-	cmd := exec.CommandContext(ctx, bashBin, "-c", command)
-	cmd.Dir = workDir
-	cmd.Env = os.Environ()
 	if kubeconfig != "" {
-		kubeconfig, err := expandShellVar(kubeconfig)
+		kubeconfig, err = expandShellVar(kubeconfig)
 		if err != nil {
-			return nil, err
+			return &ExecResult{Error: fmt.Sprintf("expanding kubeconfig: %v", err)}, nil
 		}
-		cmd.Env = append(cmd.Env, "KUBECONFIG="+kubeconfig)
 	}
-
+	cmd, result := bashCommand(ctx, parsed, workDir, kubeconfig, kubeContext)
+	if result != nil {
+		return result, nil
+	}
 	return executeCommand(cmd)
 }
 
@@ -112,6 +116,9 @@ type ExecResult struct {
 	Stdout   string `json:"stdout,omitempty"`
 	Stderr   string `json:"stderr,omitempty"`
 	ExitCode int    `json:"exit_code,omitempty"`
+
+	// Truncated describes the output if it was too large to be sent whole, Stdout and Stderr are excerpts then.
+	Truncated *OutputSummary `json:"truncated,omitempty"`
 }
 
 func executeCommand(cmd *exec.Cmd) (*ExecResult, error) {
@@ -125,7 +132,7 @@ func executeCommand(cmd *exec.Cmd) (*ExecResult, error) {
 		if exitError, ok := err.(*exec.ExitError); ok {
 			results.ExitCode = exitError.ExitCode()
 		} else {
-			return nil, err
+			return &ExecResult{Error: err.Error()}, nil
 		}
 	}
 	results.Stdout = stdout.String()
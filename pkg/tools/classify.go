@@ -0,0 +1,107 @@
+package tools
+
+import (
+	"strings"
+)
+
+// Classification is the effect of a command on the cluster.
+type Classification string
+
+const (
+	// ReadOnly commands do not modify the cluster.
+	ReadOnly Classification = "read-only"
+	// Mutating commands modify the cluster, or run processes in it such as kubectl exec.
+	Mutating Classification = "mutating"
+	// Unknown is used when the effect can not be determined, e.g. for arbitrary programs.
+	Unknown Classification = "unknown"
+)
+
+// severity orders the classifications, the classification of a command line is the most severe of its stages.
+func (c Classification) severity() int {
+	switch c {
+	case ReadOnly:
+		return 0
+	case Unknown:
+		return 1
+	}
+	return 2
+}
+
+// ParseClassification converts the "modifies_resource" argument of the tools into a classification.
+func ParseClassification(modifiesResource string) Classification {
+	switch strings.ToLower(strings.TrimSpace(modifiesResource)) {
+	case "yes", "true":
+		return Mutating
+	case "no", "false":
+		return ReadOnly
+	}
+	return Unknown
+}
+
+// readOnlyVerbs are the kubectl sub commands which never modify the cluster.
+var readOnlyVerbs = map[string]bool{
+	"get": true, "describe": true, "logs": true, "explain": true, "events": true, "diff": true, "wait": true,
+	"api-resources": true, "api-versions": true, "version": true, "cluster-info": true, "cluster-info dump": true,
+	"top": true, "top pod": true, "top node": true, "auth can-i": true, "auth whoami": true, "completion": true,
+	"kustomize": true, "options": true, "plugin": true, "plugin list": true,
+	"rollout history": true, "rollout status": true,
+	"config view": true, "config current-context": true, "config get-contexts": true, "config get-clusters": true, "config get-users": true,
+}
+
+// mutatingVerbs are the kubectl sub commands which modify the cluster, or the kubeconfig,
+// or run processes in the cluster.
+var mutatingVerbs = map[string]bool{
+	"apply": true, "apply edit-last-applied": true, "apply set-last-applied": true, "create": true, "delete": true,
+	"edit": true, "patch": true, "replace": true, "scale": true, "autoscale": true, "expose": true, "run": true,
+	"label": true, "annotate": true, "taint": true, "cordon": true, "uncordon": true, "drain": true,
+	"rollout pause": true, "rollout restart": true, "rollout resume": true, "rollout undo": true,
+	"certificate approve": true, "certificate deny": true, "exec": true, "cp": true, "attach": true, "debug": true,
+	"config set": true, "config unset": true, "config use-context": true, "config set-context": true, "config set-cluster": true,
+	"config set-credentials": true, "config delete-context": true, "config delete-cluster": true, "config delete-user": true, "config rename-context": true,
+}
+
+// Classification returns the effect of the kubectl invocation.
+func (k *KubectlCommand) Classification() Classification {
+	if !k.Known {
+		return Unknown
+	}
+
+	mutating := mutatingVerbs[k.Verb] || strings.HasPrefix(k.Verb, "create ") || strings.HasPrefix(k.Verb, "set ")
+	if mutating {
+		if dryRun, ok := k.Flag("dry-run"); ok && dryRun != "none" && dryRun != "false" {
+			return ReadOnly
+		}
+		return Mutating
+	}
+	if readOnlyVerbs[k.Verb] {
+		return ReadOnly
+	}
+	return Unknown
+}
+
+// Classification returns the effect of the stage, stages not running kubectl are read-only
+// if they only transform text and unknown otherwise. Stages running a parsed script are read-only,
+// the effect of the script is the one of its stages.
+func (s *Stage) Classification() Classification {
+	if s.Kubectl != nil {
+		return s.Kubectl.Classification()
+	}
+	if s.Script != "" {
+		return ReadOnly
+	}
+	if s.IsTextFilter() {
+		return ReadOnly
+	}
+	return Unknown
+}
+
+// Classification returns the most severe effect of the stages of the command line.
+func (c *Command) Classification() Classification {
+	result := ReadOnly
+	for _, s := range c.Stages {
+		if cl := s.Classification(); cl.severity() > result.severity() {
+			result = cl
+		}
+	}
+	return result
+}
@@ -0,0 +1,850 @@
+package tools
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/shlex"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	kubectlcmd "k8s.io/kubectl/pkg/cmd"
+)
+
+// Command is a shell command line, as requested by the LLM, split into the simple commands it runs.
+type Command struct {
+	Raw string
+
+	// Stages are the simple commands in order of appearance,
+	// including the ones executed in command substitutions.
+	Stages []*Stage
+}
+
+// Stage is a simple command of a command line, e.g. one element of a pipeline.
+type Stage struct {
+	Raw string
+
+	// Args is the argument vector, without environment assignments and redirections.
+	Args []string
+
+	// Operator is the shell operator preceding the stage, one of "", "|", "||", "&&", ";" or "&".
+	Operator string
+
+	// Substitution is true if the stage runs in a command or process substitution, e.g. $(...).
+	Substitution bool
+
+	// Expansion is true if the stage contains parameter expansions or substitutions which the shell evaluates.
+	Expansion bool
+
+	// Redirects are the redirection operators of the stage, e.g. ">" or "2>&1".
+	Redirects []string
+
+	// Stdin is the here-document body fed to the stage.
+	Stdin string
+
+	// Kubectl is set if the stage invokes kubectl.
+	Kubectl *KubectlCommand
+
+	// Script is the script the stage runs with a shell or eval, e.g. of `bash -c 'kubectl get pods'`.
+	// It is only set if the script could be parsed, its stages follow the stage in the command line.
+	Script string
+}
+
+// Program returns the base name of the executed program.
+func (s *Stage) Program() string {
+	if len(s.Args) == 0 {
+		return ""
+	}
+	return filepath.Base(s.Args[0])
+}
+
+// textFilters are programs which only transform their input or print text, e.g. to filter the output of kubectl.
+var textFilters = map[string]bool{
+	"grep": true, "egrep": true, "fgrep": true, "awk": true, "sed": true, "jq": true, "yq": true,
+	"head": true, "tail": true, "sort": true, "uniq": true, "wc": true, "cut": true, "tr": true,
+	"column": true, "cat": true, "echo": true, "printf": true, "base64": true, "less": true, "more": true,
+}
+
+// IsTextFilter returns true if the stage only transforms text, e.g. `grep Running`.
+func (s *Stage) IsTextFilter() bool {
+	if !textFilters[s.Program()] || len(s.Redirects) > 0 && s.Redirects[0] != "<<" {
+		return false
+	}
+	if s.Program() == "sed" {
+		for _, arg := range s.Args[1:] {
+			if strings.HasPrefix(arg, "-i") || arg == "--in-place" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// KubectlCommand is a kubectl invocation resolved against the kubectl command tree.
+type KubectlCommand struct {
+	// Verb is the path of the kubectl sub command, e.g. "get" or "rollout restart".
+	Verb string
+
+	// Known is false if the verb does not exist in kubectl, e.g. a plugin.
+	Known bool
+
+	// Args are the positional arguments following the verb.
+	Args []string
+
+	// Resources are the resource types targeted by the command, e.g. "pods".
+	Resources []string
+
+	// Names are the names of the targeted resources.
+	Names []string
+
+	Namespace     string
+	AllNamespaces bool
+	Context       string
+
+	// Flags maps the long name of the given flags to their values.
+	Flags map[string][]string
+}
+
+// Flag returns the last value of the given flag.
+func (k *KubectlCommand) Flag(name string) (string, bool) {
+	values, ok := k.Flags[name]
+	if !ok || len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// ReadsSecrets returns true if the command may print Secrets, e.g. `kubectl get secret db -o yaml` or
+// `kubectl get -f objects.yaml` whose resource types are unknown. The output may be piped to other commands
+// extracting or decoding the values, e.g. `jq -r .data.password | base64 -d`, so it can not be redacted field by field.
+func (k *KubectlCommand) ReadsSecrets() bool {
+	if k.Verb != "get" {
+		return false
+	}
+	if len(k.Resources) == 0 {
+		return true
+	}
+	for _, resource := range k.Resources {
+		resource, _, _ = strings.Cut(strings.ToLower(resource), ".")
+		if resource == "secret" || resource == "secrets" || resource == "all" {
+			return true
+		}
+	}
+	return false
+}
+
+// DeletesNamespaces returns true if the kubectl invocation deletes namespaces, along with every object in them.
+func (k *KubectlCommand) DeletesNamespaces() bool {
+	if k.Verb != "delete" {
+		return false
+	}
+	for _, resource := range k.Resources {
+		resource, _, _ = strings.Cut(strings.ToLower(resource), ".")
+		if resource == "namespace" || resource == "namespaces" || resource == "ns" {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *KubectlCommand) String() string {
+	return fmt.Sprintf("kubectl %s resources=%v names=%v namespace=%q context=%q flags=%v", k.Verb, k.Resources, k.Names, k.Namespace, k.Context, k.Flags)
+}
+
+// Kubectl returns the kubectl invocations of the command line.
+func (c *Command) Kubectl() []*KubectlCommand {
+	var result []*KubectlCommand
+	for _, s := range c.Stages {
+		if s.Kubectl != nil {
+			result = append(result, s.Kubectl)
+		}
+	}
+	return result
+}
+
+// ParseCommand splits the command line into its stages and resolves the kubectl invocations.
+func ParseCommand(command string) (*Command, error) {
+	segments, err := splitCommandLine(command, false)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Command{Raw: command}
+	for _, seg := range segments {
+		stage, err := parseStage(seg)
+		if err != nil {
+			return nil, err
+		}
+		if len(stage.Args) == 0 {
+			continue
+		}
+		c.Stages = append(c.Stages, stage)
+		if script, ok := shellScript(stage.Args); ok {
+			// a script which can not be parsed leaves the stage unknown
+			if nested, err := ParseCommand(script); err == nil {
+				stage.Script = script
+				c.Stages = append(c.Stages, nested.Stages...)
+			}
+		}
+	}
+	return c, nil
+}
+
+// segment is the raw text of a simple command found in a command line.
+type segment struct {
+	text         string
+	operator     string
+	heredoc      string
+	substitution bool
+	expansion    bool
+}
+
+// splitCommandLine splits a command line on shell operators, honoring quotes, escapes,
+// comments and here-documents. Command substitutions are returned as separate segments
+// following the segment they appear in.
+func splitCommandLine(s string, substitution bool) ([]segment, error) {
+	var (
+		segments []segment
+		current  strings.Builder
+		curr     = segment{substitution: substitution}
+		inSingle bool
+		inDouble bool
+		subs     []segment
+
+		// heredocs pending for the current line, and the index of the segment they belong to
+		heredocs      []string
+		heredocStrip  []bool
+		heredocOwners []int
+	)
+
+	flush := func(nextOperator string) {
+		curr.text = strings.TrimSpace(current.String())
+		segments = append(segments, curr)
+		segments = append(segments, subs...)
+		current.Reset()
+		subs = nil
+		curr = segment{operator: nextOperator, substitution: substitution}
+	}
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+
+		switch {
+		case inSingle:
+			current.WriteRune(r)
+			if r == '\'' {
+				inSingle = false
+			}
+			continue
+		case r == '\\':
+			if next == '\n' && !inDouble {
+				// line continuation
+				i++
+				continue
+			}
+			current.WriteRune(r)
+			if next != 0 {
+				current.WriteRune(next)
+				i++
+			}
+			continue
+		case r == '\'' && !inDouble:
+			inSingle = true
+			current.WriteRune(r)
+			continue
+		case r == '"':
+			inDouble = !inDouble
+			current.WriteRune(r)
+			continue
+		case r == '`' || (r == '$' && next == '(') || ((r == '<' || r == '>') && next == '(' && !inDouble):
+			inner, end, err := substitutionBody(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			innerSegments, err := splitCommandLine(inner, true)
+			if err != nil {
+				return nil, err
+			}
+			subs = append(subs, innerSegments...)
+			current.WriteString("$(...)")
+			curr.expansion = true
+			i = end
+			continue
+		case r == '$':
+			curr.expansion = true
+			current.WriteRune(r)
+			continue
+		case inDouble:
+			current.WriteRune(r)
+			continue
+		}
+
+		// outside of quotes
+		switch {
+		case r == '#' && (current.Len() == 0 || isSpace(runes[i-1])):
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+		case r == '|' && next == '|':
+			flush("||")
+			i++
+		case r == '|':
+			flush("|")
+		case r == '&' && next == '&':
+			flush("&&")
+			i++
+		case r == '&' && next != '>' && (i == 0 || (runes[i-1] != '>' && runes[i-1] != '<')):
+			flush("&")
+		case r == ';':
+			flush(";")
+		case r == '<' && next == '<' && (i+2 >= len(runes) || runes[i+2] != '<'):
+			i += 2
+			strip := false
+			if i < len(runes) && runes[i] == '-' {
+				strip = true
+				i++
+			}
+			for i < len(runes) && isSpace(runes[i]) {
+				i++
+			}
+			var delim strings.Builder
+			for i < len(runes) && !isSpace(runes[i]) && runes[i] != '\n' && !strings.ContainsRune(";|&<>", runes[i]) {
+				if runes[i] != '\'' && runes[i] != '"' && runes[i] != '\\' {
+					delim.WriteRune(runes[i])
+				}
+				i++
+			}
+			i--
+			if delim.Len() == 0 {
+				return nil, fmt.Errorf("missing here-document delimiter in %q", s)
+			}
+			heredocs = append(heredocs, delim.String())
+			heredocStrip = append(heredocStrip, strip)
+			heredocOwners = append(heredocOwners, len(segments))
+			current.WriteString(" <<" + delim.String() + " ")
+		case r == '\n':
+			flush(";")
+			for j, delim := range heredocs {
+				var body strings.Builder
+				i++
+				for {
+					if i >= len(runes) {
+						return nil, fmt.Errorf("here-document delimited by %q is not terminated", delim)
+					}
+					end := i
+					for end < len(runes) && runes[end] != '\n' {
+						end++
+					}
+					line := string(runes[i:end])
+					i = end
+					check := line
+					if heredocStrip[j] {
+						check = strings.TrimLeft(line, "\t")
+					}
+					if check == delim {
+						break
+					}
+					body.WriteString(line + "\n")
+					i++
+				}
+				if owner := heredocOwners[j]; owner < len(segments) {
+					segments[owner].heredoc = body.String()
+				}
+			}
+			heredocs, heredocStrip, heredocOwners = nil, nil, nil
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if inSingle || inDouble {
+		return nil, fmt.Errorf("unterminated quote in %q", s)
+	}
+	if len(heredocs) > 0 {
+		return nil, fmt.Errorf("here-document delimited by %q is not terminated", heredocs[0])
+	}
+	flush("")
+
+	var result []segment
+	for _, seg := range segments {
+		if seg.text != "" {
+			result = append(result, seg)
+		}
+	}
+	return result, nil
+}
+
+// substitutionBody returns the body of the command substitution starting at runes[start]
+// and the index of its closing character.
+func substitutionBody(runes []rune, start int) (string, int, error) {
+	if runes[start] == '`' {
+		for i := start + 1; i < len(runes); i++ {
+			if runes[i] == '\\' {
+				i++
+				continue
+			}
+			if runes[i] == '`' {
+				return string(runes[start+1 : i]), i, nil
+			}
+		}
+		return "", 0, fmt.Errorf("unterminated command substitution in %q", string(runes))
+	}
+
+	depth := 0
+	inSingle, inDouble := false, false
+	for i := start + 1; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case inSingle:
+			if r == '\'' {
+				inSingle = false
+			}
+		case r == '\\':
+			i++
+		case r == '\'' && !inDouble:
+			inSingle = true
+		case r == '"':
+			inDouble = !inDouble
+		case inDouble:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+			if depth == 0 {
+				return string(runes[start+2 : i]), i, nil
+			}
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated command substitution in %q", string(runes))
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+var (
+	assignmentRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+	durationRegexp   = regexp.MustCompile(`^\d+(\.\d+)?[smhd]?$`)
+	redirectRegexp   = regexp.MustCompile(`^(\d*|&)(>>|>|<<<|<<|<)(&\d+|&-)?`)
+
+	// wrapperPrograms run the command given in their arguments.
+	wrapperPrograms = map[string]bool{"sudo": true, "env": true, "command": true, "exec": true, "nohup": true, "time": true, "timeout": true, "watch": true, "xargs": true, "nice": true}
+
+	// wrapperValueFlags are the options of the wrapper programs taking a value as a separate argument, e.g. `xargs -I {}`.
+	wrapperValueFlags = map[string]map[string]bool{
+		"xargs": {
+			"-I": true, "-n": true, "-P": true, "-L": true, "-s": true, "-d": true, "-E": true, "-a": true,
+			"--max-args": true, "--max-procs": true, "--max-lines": true, "--max-chars": true, "--delimiter": true, "--arg-file": true,
+		},
+		"sudo": {
+			"-u": true, "-g": true, "-p": true, "-C": true, "-D": true, "-r": true, "-t": true, "-U": true, "-h": true,
+			"--user": true, "--group": true, "--prompt": true, "--close-from": true, "--chdir": true, "--role": true, "--type": true, "--other-user": true, "--host": true,
+		},
+		"env":     {"-u": true, "-C": true, "--unset": true, "--chdir": true},
+		"timeout": {"-s": true, "-k": true, "--signal": true, "--kill-after": true},
+		"nice":    {"-n": true, "--adjustment": true},
+		"watch":   {"-n": true, "--interval": true},
+		"time":    {"-f": true, "-o": true, "--format": true, "--output": true},
+		"exec":    {"-a": true},
+	}
+
+	// shellPrograms run the script given with -c.
+	shellPrograms = map[string]bool{"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true}
+)
+
+func parseStage(seg segment) (*Stage, error) {
+	tokens, err := shlex.Split(seg.text)
+	if err != nil {
+		return nil, fmt.Errorf("tokenizing %q: %w", seg.text, err)
+	}
+
+	stage := &Stage{
+		Raw:          seg.text,
+		Operator:     seg.operator,
+		Substitution: seg.substitution,
+		Expansion:    seg.expansion,
+		Stdin:        seg.heredoc,
+	}
+
+	quoted := quotedWords(seg.text, len(tokens))
+	leading := true
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if leading && assignmentRegexp.MatchString(t) {
+			continue
+		}
+		leading = false
+		if m := redirectRegexp.FindString(t); m != "" && !quoted[i] {
+			stage.Redirects = append(stage.Redirects, m)
+			if m == t && !strings.Contains(m, "&") && i+1 < len(tokens) {
+				// the target is a separate token, e.g. "> out.txt"
+				i++
+			}
+			continue
+		}
+		stage.Args = append(stage.Args, t)
+	}
+
+	if args := kubectlArgs(stage.Args); args != nil {
+		k, err := resolveKubectl(args)
+		if err != nil {
+			return nil, err
+		}
+		stage.Kubectl = k
+	}
+	return stage, nil
+}
+
+// quotedWords returns, for each of the n words of the text, whether it starts with a quote or an escape,
+// e.g. `"<none>"` which is an argument rather than a redirection. The words are split as shlex splits them,
+// if the number of words differs, none is reported as quoted.
+func quotedWords(text string, n int) []bool {
+	var quoted []bool
+	inWord, inSingle, inDouble := false, false, false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case inSingle:
+			inSingle = c != '\''
+			continue
+		case inDouble:
+			if c == '\\' {
+				i++
+			}
+			inDouble = c != '"'
+			continue
+		case c == ' ' || c == '\t' || c == '\n':
+			inWord = false
+			continue
+		case !inWord && c == '#':
+			// a comment ends the words
+			i = len(text)
+			continue
+		}
+		if !inWord {
+			inWord = true
+			quoted = append(quoted, c == '\'' || c == '"' || c == '\\')
+		}
+		switch c {
+		case '\'':
+			inSingle = true
+		case '"':
+			inDouble = true
+		case '\\':
+			i++
+		}
+	}
+	if len(quoted) != n {
+		return make([]bool, n)
+	}
+	return quoted
+}
+
+// kubectlArgs returns the arguments passed to kubectl, looking through wrapper programs
+// such as `xargs kubectl delete pod`. It returns nil if the stage does not run kubectl.
+func kubectlArgs(args []string) []string {
+	command := wrappedCommand(args)
+	if len(command) == 0 || filepath.Base(command[0]) != "kubectl" {
+		return nil
+	}
+	return command[1:]
+}
+
+// wrappedCommand returns the argument vector of the program run by the stage, looking through wrapper programs
+// and their options, e.g. `sudo -u root kubectl delete ns prod`. It returns nil if a wrapper runs no program.
+func wrappedCommand(args []string) []string {
+	for i := 0; i < len(args); i++ {
+		program := filepath.Base(args[i])
+		if !wrapperPrograms[program] {
+			return args[i:]
+		}
+		// skip the options of the wrapper, along with their values
+		for i+1 < len(args) {
+			arg := args[i+1]
+			if arg == "--" {
+				i++
+				break
+			}
+			if wrapperValueFlags[program][arg] {
+				i += 2
+				continue
+			}
+			if !strings.HasPrefix(arg, "-") && !assignmentRegexp.MatchString(arg) && (program != "timeout" || !isDuration(arg)) {
+				break
+			}
+			i++
+		}
+	}
+	return nil
+}
+
+// shellScript returns the script the stage runs with a shell or eval, e.g. of `bash -c 'kubectl get pods'`.
+func shellScript(args []string) (string, bool) {
+	command := wrappedCommand(args)
+	if len(command) < 2 {
+		return "", false
+	}
+	program := filepath.Base(command[0])
+	if program == "eval" {
+		return strings.Join(command[1:], " "), true
+	}
+	if !shellPrograms[program] {
+		return "", false
+	}
+	for i := 1; i < len(command); i++ {
+		arg := command[i]
+		switch {
+		case arg == "-o" || arg == "+o" || arg == "-O" || arg == "+O":
+			// the shell options take a name, e.g. `-o pipefail`
+			i++
+		case strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.Contains(arg[1:], "c"):
+			if i+1 < len(command) {
+				return command[i+1], true
+			}
+			return "", false
+		case !strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "+"):
+			// a script file, or the script read from the input
+			return "", false
+		}
+	}
+	return "", false
+}
+
+func isDuration(s string) bool {
+	return durationRegexp.MatchString(s)
+}
+
+var (
+	kubectlTreeOnce sync.Once
+	kubectlTree     *cobra.Command
+	// kubectlTreeMutex guards the command tree, cobra caches inherited flags lazily
+	kubectlTreeMutex sync.Mutex
+)
+
+// kubectlCommandTree returns the kubectl command tree used to resolve verbs and flags.
+// The commands are never executed.
+func kubectlCommandTree() *cobra.Command {
+	kubectlTreeOnce.Do(func() {
+		kubectlTree = kubectlcmd.NewKubectlCommand(kubectlcmd.KubectlOptions{
+			IOStreams: genericiooptions.NewTestIOStreamsDiscard(),
+		})
+	})
+	return kubectlTree
+}
+
+// impliedResources are the resource types of verbs which do not take a resource type argument.
+var impliedResources = map[string]string{
+	"logs":         "pods",
+	"exec":         "pods",
+	"attach":       "pods",
+	"port-forward": "pods",
+	"run":          "pods",
+	"cp":           "pods",
+	"cordon":       "nodes",
+	"uncordon":     "nodes",
+	"drain":        "nodes",
+	"debug":        "pods",
+	"top pod":      "pods",
+	"top node":     "nodes",
+	"taint":        "nodes",
+}
+
+// typedVerbs are the verbs taking TYPE[/NAME] or TYPE NAME arguments.
+var typedVerbs = map[string]bool{
+	"get": true, "describe": true, "delete": true, "edit": true, "label": true, "annotate": true,
+	"patch": true, "scale": true, "autoscale": true, "expose": true, "wait": true, "explain": true,
+	"rollout history": true, "rollout pause": true, "rollout restart": true, "rollout resume": true,
+	"rollout status": true, "rollout undo": true, "set env": true, "set image": true, "set resources": true,
+	"set selector": true, "set serviceaccount": true, "set subject": true,
+}
+
+// resolveKubectl resolves the kubectl arguments against the kubectl command tree.
+func resolveKubectl(args []string) (*KubectlCommand, error) {
+	kubectlTreeMutex.Lock()
+	defer kubectlTreeMutex.Unlock()
+
+	root := kubectlCommandTree()
+	k := &KubectlCommand{Flags: map[string][]string{}}
+
+	sub, rest, err := root.Find(args)
+	if err != nil || sub == root {
+		sub = root
+		rest = args
+	} else {
+		k.Known = true
+		k.Verb = strings.TrimPrefix(sub.CommandPath(), root.Name()+" ")
+	}
+
+	flags := pflag.NewFlagSet(sub.Name(), pflag.ContinueOnError)
+	flags.AddFlagSet(sub.Flags())
+	flags.AddFlagSet(sub.InheritedFlags())
+
+	var positional []string
+	for i := 0; i < len(rest); i++ {
+		a := rest[i]
+		switch {
+		case a == "--":
+			positional = append(positional, rest[i+1:]...)
+			i = len(rest)
+		case strings.HasPrefix(a, "--"):
+			name, value, hasValue := strings.Cut(a[2:], "=")
+			f := flags.Lookup(name)
+			switch {
+			case f == nil:
+			case hasValue:
+				name = f.Name
+			case f.NoOptDefVal != "":
+				name, value = f.Name, f.NoOptDefVal
+			case i+1 < len(rest):
+				name, value = f.Name, rest[i+1]
+				i++
+			}
+			k.Flags[name] = append(k.Flags[name], value)
+		case strings.HasPrefix(a, "-") && len(a) > 1:
+			shorthands := a[1:]
+			for j := 0; j < len(shorthands); j++ {
+				c := shorthands[j : j+1]
+				f := flags.ShorthandLookup(c)
+				if f == nil {
+					k.Flags[c] = append(k.Flags[c], "")
+					continue
+				}
+				if f.NoOptDefVal != "" {
+					k.Flags[f.Name] = append(k.Flags[f.Name], f.NoOptDefVal)
+					continue
+				}
+				value := strings.TrimPrefix(shorthands[j+1:], "=")
+				if value == "" && i+1 < len(rest) {
+					value = rest[i+1]
+					i++
+				}
+				k.Flags[f.Name] = append(k.Flags[f.Name], value)
+				break
+			}
+		default:
+			positional = append(positional, a)
+		}
+	}
+
+	if !k.Known && len(positional) > 0 {
+		// unknown verbs, e.g. plugins
+		k.Verb = positional[0]
+		positional = positional[1:]
+	}
+	k.Args = positional
+	k.Namespace, _ = k.Flag("namespace")
+	k.Context, _ = k.Flag("context")
+	if v, ok := k.Flag("all-namespaces"); ok && v != "false" {
+		k.AllNamespaces = true
+	}
+
+	switch {
+	case impliedResources[k.Verb] != "":
+		k.resolveImplied(positional)
+	case strings.HasPrefix(k.Verb, "create "):
+		// e.g. "create deployment NAME" or "create secret generic NAME"
+		k.Resources = []string{plural(strings.Fields(k.Verb)[1])}
+		if len(positional) > 0 {
+			k.Names = []string{positional[0]}
+		}
+	case typedVerbs[k.Verb]:
+		k.resolveTyped(positional)
+	}
+	return k, nil
+}
+
+// resolveImplied sets the resources and names of verbs which do not take a resource type argument.
+func (k *KubectlCommand) resolveImplied(positional []string) {
+	k.Resources = []string{impliedResources[k.Verb]}
+	switch k.Verb {
+	case "cp":
+		// kubectl cp [namespace/]pod:path local-path
+		for _, arg := range positional {
+			if pod, _, found := strings.Cut(arg, ":"); found {
+				k.Names = append(k.Names, pod[strings.LastIndex(pod, "/")+1:])
+			}
+		}
+	case "cordon", "uncordon", "drain", "taint":
+		for _, arg := range positional {
+			if arg == "node" || arg == "nodes" || strings.ContainsAny(arg, "=:") {
+				continue
+			}
+			_, name, found := strings.Cut(arg, "/")
+			if !found {
+				name = arg
+			}
+			k.Names = append(k.Names, name)
+		}
+	default:
+		// the first argument is the target, the remaining ones are e.g. the command run by exec
+		if len(positional) == 0 {
+			return
+		}
+		if resource, name, found := strings.Cut(positional[0], "/"); found {
+			k.Resources = []string{resource}
+			k.Names = []string{name}
+		} else {
+			k.Names = []string{positional[0]}
+		}
+	}
+}
+
+// resolveTyped sets the resources and names of verbs taking TYPE[/NAME] or TYPE NAME arguments.
+func (k *KubectlCommand) resolveTyped(positional []string) {
+	for _, arg := range positional {
+		if strings.Contains(arg, "=") {
+			// label, annotate and set env take KEY=VALUE arguments
+			continue
+		}
+		if resource, name, found := strings.Cut(arg, "/"); found {
+			k.Resources = append(k.Resources, resource)
+			k.Names = append(k.Names, name)
+			continue
+		}
+		if len(k.Resources) == 0 {
+			k.Resources = strings.Split(arg, ",")
+			continue
+		}
+		if len(k.Names) > 0 && (k.Verb == "set image" || k.Verb == "scale" || k.Verb == "patch") {
+			// only the first argument after the type is a name
+			continue
+		}
+		k.Names = append(k.Names, arg)
+	}
+}
+
+// plural returns the plural form of a resource type as used by the kubectl create sub commands.
+func plural(kind string) string {
+	switch {
+	case strings.HasSuffix(kind, "s"):
+		return kind + "es"
+	case strings.HasSuffix(kind, "y"):
+		return strings.TrimSuffix(kind, "y") + "ies"
+	}
+	return kind + "s"
+}
+
+// guardCommand rejects commands which can not run unattended.
+// It returns nil if the command can run.
+func guardCommand(cmd *Command) *ExecResult {
+	for _, k := range cmd.Kubectl() {
+		switch k.Verb {
+		case "edit":
+			return &ExecResult{Error: "interactive mode not supported for kubectl, please use non-interactive commands"}
+		case "port-forward":
+			return &ExecResult{Error: "port-forwarding is not allowed because assistant is running in an unattended mode, please try some other alternative"}
+		case "exec", "attach", "run", "debug":
+			if tty, ok := k.Flag("tty"); ok && tty != "false" {
+				return &ExecResult{Error: "interactive mode not supported for kubectl, please use non-interactive commands"}
+			}
+		}
+	}
+	return nil
+}
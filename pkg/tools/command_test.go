@@ -0,0 +1,181 @@
+package tools
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+
+		// wantKubectl are the verb, resources and names of the kubectl invocations, in order
+		wantKubectl   []KubectlCommand
+		wantRedirects []string
+		wantClass     Classification
+	}{
+		{
+			name:        "get",
+			command:     "kubectl get pods -n kube-system",
+			wantKubectl: []KubectlCommand{{Verb: "get", Resources: []string{"pods"}, Namespace: "kube-system"}},
+			wantClass:   ReadOnly,
+		},
+		{
+			name:        "pipeline to a text filter",
+			command:     `kubectl get pods -A | grep -v Running`,
+			wantKubectl: []KubectlCommand{{Verb: "get", Resources: []string{"pods"}, AllNamespaces: true}},
+			wantClass:   ReadOnly,
+		},
+		{
+			name:        "quoted redirection characters",
+			command:     `kubectl get pods -o wide | grep "<none>"`,
+			wantKubectl: []KubectlCommand{{Verb: "get", Resources: []string{"pods"}}},
+			wantClass:   ReadOnly,
+		},
+		{
+			name:          "redirection",
+			command:       `kubectl get pods -o yaml > pods.yaml`,
+			wantKubectl:   []KubectlCommand{{Verb: "get", Resources: []string{"pods"}}},
+			wantRedirects: []string{">"},
+			wantClass:     ReadOnly,
+		},
+		{
+			name:        "xargs",
+			command:     "kubectl get pods -o name | xargs kubectl delete",
+			wantKubectl: []KubectlCommand{{Verb: "get", Resources: []string{"pods"}}, {Verb: "delete"}},
+			wantClass:   Mutating,
+		},
+		{
+			name:        "xargs with a replacement string",
+			command:     "kubectl get pods -o name | xargs -I {} kubectl delete pod {}",
+			wantKubectl: []KubectlCommand{{Verb: "get", Resources: []string{"pods"}}, {Verb: "delete", Resources: []string{"pod"}, Names: []string{"{}"}}},
+			wantClass:   Mutating,
+		},
+		{
+			name:        "xargs with options",
+			command:     "kubectl get ns -o name | xargs -n 1 -P 4 kubectl delete",
+			wantKubectl: []KubectlCommand{{Verb: "get", Resources: []string{"ns"}}, {Verb: "delete"}},
+			wantClass:   Mutating,
+		},
+		{
+			name:        "sudo with a user",
+			command:     "sudo -u root kubectl delete ns prod",
+			wantKubectl: []KubectlCommand{{Verb: "delete", Resources: []string{"ns"}, Names: []string{"prod"}}},
+			wantClass:   Mutating,
+		},
+		{
+			name:        "timeout with a signal",
+			command:     "timeout -s KILL 30s kubectl get pods",
+			wantKubectl: []KubectlCommand{{Verb: "get", Resources: []string{"pods"}}},
+			wantClass:   ReadOnly,
+		},
+		{
+			name:        "env unsetting a variable",
+			command:     "env -u KUBECONFIG FOO=bar kubectl get nodes",
+			wantKubectl: []KubectlCommand{{Verb: "get", Resources: []string{"nodes"}}},
+			wantClass:   ReadOnly,
+		},
+		{
+			name:        "nice",
+			command:     "nice -n 10 /usr/local/bin/kubectl get pods",
+			wantKubectl: []KubectlCommand{{Verb: "get", Resources: []string{"pods"}}},
+			wantClass:   ReadOnly,
+		},
+		{
+			name:        "bash script",
+			command:     "bash -c 'kubectl delete ns prod'",
+			wantKubectl: []KubectlCommand{{Verb: "delete", Resources: []string{"ns"}, Names: []string{"prod"}}},
+			wantClass:   Mutating,
+		},
+		{
+			name:        "read-only sh script with options",
+			command:     `sh -ec "kubectl get pods | wc -l"`,
+			wantKubectl: []KubectlCommand{{Verb: "get", Resources: []string{"pods"}}},
+			wantClass:   ReadOnly,
+		},
+		{
+			name:        "script run by xargs",
+			command:     `kubectl get pods -o name | xargs -I {} sh -c 'kubectl delete {}'`,
+			wantKubectl: []KubectlCommand{{Verb: "get", Resources: []string{"pods"}}, {Verb: "delete", Resources: []string{"{}"}}},
+			wantClass:   Mutating,
+		},
+		{
+			name:        "eval",
+			command:     `eval "kubectl scale deploy web --replicas=0"`,
+			wantKubectl: []KubectlCommand{{Verb: "scale", Resources: []string{"deploy"}, Names: []string{"web"}}},
+			wantClass:   Mutating,
+		},
+		{
+			name:        "script file",
+			command:     "bash cleanup.sh",
+			wantKubectl: nil,
+			wantClass:   Unknown,
+		},
+		{
+			name:        "command substitution",
+			command:     "kubectl delete pod $(kubectl get pods -o name | head -1)",
+			wantKubectl: []KubectlCommand{{Verb: "delete", Resources: []string{"pod"}, Names: []string{"$(...)"}}, {Verb: "get", Resources: []string{"pods"}}},
+			wantClass:   Mutating,
+		},
+		{
+			name:        "server-side dry-run",
+			command:     "kubectl apply -f deploy.yaml --dry-run=server",
+			wantKubectl: []KubectlCommand{{Verb: "apply"}},
+			wantClass:   ReadOnly,
+		},
+		{
+			name:        "plugin",
+			command:     "kubectl neat get pod web",
+			wantKubectl: []KubectlCommand{{Verb: "neat"}},
+			wantClass:   Unknown,
+		},
+		{
+			name:      "other program",
+			command:   "curl -k https://10.0.0.1:6443/healthz",
+			wantClass: Unknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCommand(tt.command)
+			if err != nil {
+				t.Fatalf("ParseCommand(%q): %v", tt.command, err)
+			}
+			var got []KubectlCommand
+			var redirects []string
+			for _, stage := range c.Stages {
+				redirects = append(redirects, stage.Redirects...)
+				if k := stage.Kubectl; k != nil {
+					got = append(got, KubectlCommand{Verb: k.Verb, Resources: k.Resources, Names: k.Names, Namespace: k.Namespace, AllNamespaces: k.AllNamespaces})
+				}
+			}
+			if !reflect.DeepEqual(got, tt.wantKubectl) {
+				t.Errorf("kubectl invocations = %+v, want %+v", got, tt.wantKubectl)
+			}
+			if !reflect.DeepEqual(redirects, tt.wantRedirects) {
+				t.Errorf("redirects = %q, want %q", redirects, tt.wantRedirects)
+			}
+			if got := c.Classification(); got != tt.wantClass {
+				t.Errorf("Classification() = %s, want %s", got, tt.wantClass)
+			}
+		})
+	}
+}
+
+func TestQuotedWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want []bool
+	}{
+		{text: `grep "<none>"`, want: []bool{false, true}},
+		{text: `grep '<none>' > out`, want: []bool{false, true, false, false}},
+		{text: `echo \<none\> a"b c"`, want: []bool{false, true, false}},
+		{text: `echo a # comment`, want: []bool{false, false}},
+	}
+	for _, tt := range tests {
+		if got := quotedWords(tt.text, len(tt.want)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("quotedWords(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
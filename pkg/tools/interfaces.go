@@ -36,3 +36,12 @@ type Tool interface {
 	// Run invokes the tool, the agent calls this when the LLM requests tool invocation.
 	Run(ctx context.Context, args map[string]any) (any, error)
 }
+
+// ReadOnlyTool is implemented by tools which can not modify the cluster, such as get_resources.
+// Their calls are classified as read-only.
+type ReadOnlyTool interface {
+	Tool
+
+	// ReadOnly returns true if the tool never modifies the cluster.
+	ReadOnly() bool
+}
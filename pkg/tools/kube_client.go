@@ -0,0 +1,251 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+// JSONResult is the result of the structured tools, it is rendered as compact JSON.
+type JSONResult map[string]any
+
+func (r JSONResult) String() string {
+	// kubectl output often contains <none> and <redacted>, which should not be escaped
+	var sb strings.Builder
+	enc := json.NewEncoder(&sb)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(r); err != nil {
+		return fmt.Sprintf("error converting result to json: %v", err)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// errorResult reports an error to the LLM, e.g. a resource which was not found.
+func errorResult(format string, a ...any) JSONResult {
+	return JSONResult{"error": fmt.Sprintf(format, a...)}
+}
+
+// kubeClients are the clients of a kube context, shared by the structured tools.
+type kubeClients struct {
+	// namespace is the namespace of the kube context
+	namespace string
+
+	config    *rest.Config
+	dynamic   dynamic.Interface
+	clientset kubernetes.Interface
+	mapper    meta.RESTMapper
+}
+
+var (
+	kubeClientsMutex sync.Mutex
+	// kubeClientsCache caches the clients, and with them the discovery information, per kubeconfig and context
+	kubeClientsCache = map[string]*kubeClients{}
+)
+
+// kubeClientsFromContext returns the clients for the kubeconfig and kube context of the tool call.
+func kubeClientsFromContext(ctx context.Context) (*kubeClients, error) {
+	kubeconfig, _ := ctx.Value("kubeconfig").(string)
+	kubeContext, _ := ctx.Value("kube_context").(string)
+
+	kubeClientsMutex.Lock()
+	defer kubeClientsMutex.Unlock()
+
+	key := kubeconfig + "\x00" + kubeContext
+	if c, ok := kubeClientsCache[key]; ok {
+		return c, nil
+	}
+
+	if kubeconfig != "" {
+		expanded, err := expandShellVar(kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		kubeconfig = expanded
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig != "" {
+		rules.Precedence = filepath.SplitList(kubeconfig)
+	}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: kubeContext})
+
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading kubeconfig: %w", err)
+	}
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, fmt.Errorf("reading namespace from kubeconfig: %w", err)
+	}
+
+	c := &kubeClients{namespace: namespace, config: config}
+	if c.dynamic, err = dynamic.NewForConfig(config); err != nil {
+		return nil, fmt.Errorf("creating dynamic client: %w", err)
+	}
+	if c.clientset, err = kubernetes.NewForConfig(config); err != nil {
+		return nil, fmt.Errorf("creating clientset: %w", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating discovery client: %w", err)
+	}
+	cached := memory.NewMemCacheClient(discoveryClient)
+	c.mapper = restmapper.NewShortcutExpander(restmapper.NewDeferredDiscoveryRESTMapper(cached), cached, func(warning string) {
+		klog.Warning(warning)
+	})
+
+	kubeClientsCache[key] = c
+	return c, nil
+}
+
+// mapping resolves a kind, resource or short name such as "Deployment", "deployments" or "deploy"
+// in the optional group and version.
+func (c *kubeClients) mapping(group, version, kind string) (*meta.RESTMapping, error) {
+	gvr := schema.GroupVersionResource{Group: group, Version: version, Resource: strings.ToLower(kind)}
+	if resource, err := c.mapper.ResourceFor(gvr); err == nil {
+		gvk, err := c.mapper.KindFor(resource)
+		if err != nil {
+			return nil, err
+		}
+		return c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+
+	var versions []string
+	if version != "" {
+		versions = append(versions, version)
+	}
+	return c.mapper.RESTMapping(schema.GroupKind{Group: group, Kind: kind}, versions...)
+}
+
+// resource returns the client for the mapped resource, in the namespace if it is namespaced.
+func (c *kubeClients) resource(mapping *meta.RESTMapping, namespace string) dynamic.ResourceInterface {
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return c.dynamic.Resource(mapping.Resource).Namespace(namespace)
+	}
+	return c.dynamic.Resource(mapping.Resource)
+}
+
+// compactObject removes the fields which are noise for the LLM. The values of Secrets are left to the redactor
+// of the conversation, which honors the allowlisted Secrets.
+func compactObject(obj *unstructured.Unstructured) map[string]any {
+	obj = obj.DeepCopy()
+	obj.SetManagedFields(nil)
+	if annotations := obj.GetAnnotations(); annotations != nil {
+		delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+		obj.SetAnnotations(annotations)
+	}
+	return obj.Object
+}
+
+// summarizeObject returns the name, age and the scalar status fields of the object.
+func summarizeObject(obj *unstructured.Unstructured) map[string]any {
+	summary := map[string]any{"name": obj.GetName()}
+	if ns := obj.GetNamespace(); ns != "" {
+		summary["namespace"] = ns
+	}
+	if created := obj.GetCreationTimestamp(); !created.IsZero() {
+		summary["age"] = time.Since(created.Time).Round(time.Second).String()
+	}
+
+	status, ok := obj.Object["status"].(map[string]any)
+	if !ok {
+		return summary
+	}
+	compact := map[string]any{}
+	for k, v := range status {
+		switch v.(type) {
+		case string, bool, int64, float64:
+			compact[k] = v
+		}
+	}
+	if conditions, ok := status["conditions"].([]any); ok {
+		var s []string
+		for _, c := range conditions {
+			if c, ok := c.(map[string]any); ok {
+				s = append(s, fmt.Sprintf("%v=%v", c["type"], c["status"]))
+			}
+		}
+		compact["conditions"] = s
+	}
+	if containers, ok := status["containerStatuses"].([]any); ok {
+		ready, restarts := 0, int64(0)
+		for _, c := range containers {
+			if c, ok := c.(map[string]any); ok {
+				if r, _ := c["ready"].(bool); r {
+					ready++
+				}
+				if r, ok := c["restartCount"].(int64); ok {
+					restarts += r
+				}
+			}
+		}
+		compact["ready"] = fmt.Sprintf("%d/%d", ready, len(containers))
+		compact["restarts"] = restarts
+	}
+	if len(compact) > 0 {
+		summary["status"] = compact
+	}
+	return summary
+}
+
+// stringArg returns the string argument, or the empty string if it is not set.
+func stringArg(args map[string]any, name string) string {
+	switch v := args[name].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// intArg returns the integer argument, LLMs may pass numbers as strings.
+func intArg(args map[string]any, name string, defaultValue int64) (int64, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return defaultValue, nil
+	case float64:
+		return int64(v), nil
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case string:
+		if v == "" {
+			return defaultValue, nil
+		}
+		var i int64
+		if _, err := fmt.Sscan(v, &i); err != nil {
+			return 0, fmt.Errorf("argument %q must be a number, got %q", name, v)
+		}
+		return i, nil
+	}
+	return 0, fmt.Errorf("argument %q must be a number, got %v", name, args[name])
+}
+
+// boolArg returns the boolean argument, LLMs may pass booleans as strings.
+func boolArg(args map[string]any, name string) bool {
+	switch v := args[name].(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true") || strings.EqualFold(v, "yes")
+	}
+	return false
+}
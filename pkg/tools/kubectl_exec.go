@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/client-go/rest"
+	kubectlcmd "k8s.io/kubectl/pkg/cmd"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+)
+
+// longRunningVerbs are the kubectl sub commands which do not return by themselves,
+// they are run by bash so that they are killed on timeout.
+var longRunningVerbs = map[string]bool{
+	"proxy": true, "attach": true, "port-forward": true, "rollout status": true,
+}
+
+// inProcessStage returns the stage to run in-process, or nil if the command line
+// has to be run by bash, e.g. pipelines or commands relying on shell expansions.
+func inProcessStage(cmd *Command, kubeconfig string) *Stage {
+	if len(cmd.Stages) != 1 || strings.Contains(kubeconfig, string(filepath.ListSeparator)) {
+		return nil
+	}
+	stage := cmd.Stages[0]
+	k := stage.Kubectl
+	if k == nil || !k.Known || stage.Program() != "kubectl" || stage.Expansion || stage.Substitution {
+		return nil
+	}
+	if strings.ContainsAny(stage.Stdin, "$`") {
+		// unquoted here-documents are expanded by the shell
+		return nil
+	}
+	for _, r := range stage.Redirects {
+		if r != "<<" && r != "2>&1" {
+			return nil
+		}
+	}
+	if longRunningVerbs[k.Verb] {
+		return nil
+	}
+	for _, flag := range []string{"watch", "watch-only", "follow"} {
+		if v, ok := k.Flag(flag); ok && v != "false" {
+			return nil
+		}
+	}
+	return stage
+}
+
+// fatalError is raised by kubectl commands instead of exiting the process.
+type fatalError struct {
+	msg  string
+	code int
+}
+
+var (
+	// inProcessMutex guards the global kubectl state overridden while commands run in-process
+	inProcessMutex   sync.Mutex
+	inProcessRunning int
+)
+
+// beginInProcess makes kubectl panic instead of exiting the process on fatal errors.
+// Commands still running after their timeout keep the override until they return.
+func beginInProcess() {
+	inProcessMutex.Lock()
+	defer inProcessMutex.Unlock()
+
+	if inProcessRunning == 0 {
+		cmdutil.BehaviorOnFatal(func(msg string, code int) {
+			panic(fatalError{msg: msg, code: code})
+		})
+	}
+	inProcessRunning++
+}
+
+func endInProcess() {
+	inProcessMutex.Lock()
+	defer inProcessMutex.Unlock()
+
+	inProcessRunning--
+	if inProcessRunning == 0 {
+		cmdutil.DefaultBehaviorOnFatal()
+		rest.SetDefaultWarningHandler(rest.WarningLogger{})
+	}
+}
+
+// runKubectlInProcess runs a single kubectl invocation with the vendored kubectl,
+// against the given kubeconfig and context, capturing its output.
+func runKubectlInProcess(ctx context.Context, stage *Stage, kubeconfig, kubeContext string, timeout time.Duration) *ExecResult {
+	var stdout, stderr bytes.Buffer
+	streams := genericiooptions.IOStreams{
+		In:     strings.NewReader(stage.Stdin),
+		Out:    &stdout,
+		ErrOut: &stderr,
+	}
+	for _, r := range stage.Redirects {
+		if r == "2>&1" {
+			streams.ErrOut = &stdout
+		}
+	}
+
+	configFlags := genericclioptions.NewConfigFlags(true).WithDeprecatedPasswordFlag().WithDiscoveryBurst(300).WithDiscoveryQPS(50.0).WithWarningPrinter(streams)
+	if kubeconfig != "" {
+		configFlags.KubeConfig = &kubeconfig
+	}
+	if kubeContext != "" {
+		configFlags.Context = &kubeContext
+	}
+	if timeout > 0 {
+		requestTimeout := timeout.String()
+		configFlags.Timeout = &requestTimeout
+	}
+
+	root := kubectlcmd.NewKubectlCommand(kubectlcmd.KubectlOptions{
+		ConfigFlags: configFlags,
+		IOStreams:   streams,
+	})
+	root.SetArgs(stage.Args[1:])
+	root.SetIn(streams.In)
+	root.SetOut(streams.Out)
+	root.SetErr(streams.ErrOut)
+
+	// kubectl writes to the buffers until it returns, they are only read once it is done
+	done := make(chan int, 1)
+	beginInProcess()
+	go func() {
+		defer endInProcess()
+
+		exitCode := 0
+		defer func() {
+			if r := recover(); r != nil {
+				fatal, ok := r.(fatalError)
+				if !ok {
+					fmt.Fprintf(streams.ErrOut, "error: kubectl panicked: %v\n", r)
+					done <- 1
+					return
+				}
+				if fatal.msg != "" {
+					fmt.Fprintln(streams.ErrOut, strings.TrimSuffix(fatal.msg, "\n"))
+				}
+				exitCode = fatal.code
+			}
+			done <- exitCode
+		}()
+
+		if err := root.ExecuteContext(ctx); err != nil {
+			fmt.Fprintf(streams.ErrOut, "error: %v\n", err)
+			exitCode = 1
+		}
+	}()
+
+	select {
+	case exitCode := <-done:
+		return &ExecResult{
+			Stdout:   stdout.String(),
+			Stderr:   stderr.String(),
+			ExitCode: exitCode,
+		}
+	case <-ctx.Done():
+		return &ExecResult{Error: fmt.Sprintf("kubectl did not complete: %v", ctx.Err())}
+	}
+}
@@ -16,11 +16,18 @@ package tools
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/GoogleCloudPlatform/kubectl-ai/gollm"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog/v2"
 )
 
 func init() {
@@ -72,29 +79,112 @@ Possible values:
 func (t *Kubectl) Run(ctx context.Context, args map[string]any) (any, error) {
 	kubeconfig := ctx.Value("kubeconfig").(string)
 	workDir := ctx.Value("work_dir").(string)
-	command := args["command"].(string)
+	kubeContext, _ := ctx.Value("kube_context").(string)
+	timeout, _ := ctx.Value("timeout").(time.Duration)
+	command, _ := args["command"].(string)
+	if strings.TrimSpace(command) == "" {
+		return &ExecResult{Error: "the command argument is required, pass the command line to run as a string"}, nil
+	}
 
-	return runKubectlCommand(ctx, command, workDir, kubeconfig)
+	return runKubectlCommand(ctx, command, workDir, kubeconfig, kubeContext, timeout)
 }
 
-func runKubectlCommand(ctx context.Context, command, workDir, kubeconfig string) (*ExecResult, error) {
-	if strings.Contains(command, "kubectl edit") {
-		return &ExecResult{Error: "interactive mode not supported for kubectl, please use non-interactive commands"}, nil
+// runKubectlCommand runs single kubectl invocations in-process and falls back to bash
+// for command lines needing a shell, such as pipelines.
+func runKubectlCommand(ctx context.Context, command, workDir, kubeconfig, kubeContext string, timeout time.Duration) (*ExecResult, error) {
+	parsed, err := ParseCommand(command)
+	if err != nil {
+		return &ExecResult{Error: fmt.Sprintf("invalid command: %v", err)}, nil
 	}
-	if strings.Contains(command, "kubectl port-forward") {
-		return &ExecResult{Error: "port-forwarding is not allowed because assistant is running in an unattended mode, please try some other alternative"}, nil
+	if result := guardCommand(parsed); result != nil {
+		return result, nil
 	}
 
-	cmd := exec.CommandContext(ctx, bashBin, "-c", command)
-	cmd.Env = os.Environ()
-	cmd.Dir = workDir
 	if kubeconfig != "" {
-		kubeconfig, err := expandShellVar(kubeconfig)
+		kubeconfig, err = expandShellVar(kubeconfig)
 		if err != nil {
-			return nil, err
+			return &ExecResult{Error: fmt.Sprintf("expanding kubeconfig: %v", err)}, nil
 		}
-		cmd.Env = append(cmd.Env, "KUBECONFIG="+kubeconfig)
 	}
 
+	if stage := inProcessStage(parsed, kubeconfig); stage != nil {
+		klog.V(1).Infof("running %q in-process", command)
+		return runKubectlInProcess(ctx, stage, kubeconfig, kubeContext, timeout), nil
+	}
+
+	klog.V(1).Infof("running %q with %s", command, bashBin)
+	cmd, result := bashCommand(ctx, parsed, workDir, kubeconfig, kubeContext)
+	if result != nil {
+		return result, nil
+	}
 	return executeCommand(cmd)
 }
+
+// contextKubeconfigFile is the kubeconfig written in the working directory to select the kube context of bashCommand.
+const contextKubeconfigFile = "context.kubeconfig"
+
+// bashCommand returns the command running the command line with bash, against the kubeconfig and kube context.
+// kubectl reads no environment variable for the context, so a kubeconfig setting only the current context is
+// listed first in KUBECONFIG: kubectl merges the files and the first current context wins. Every kubectl the
+// command line starts, e.g. through xargs, by path or in a script, runs against the context unless it is given
+// --context. The command lines running kubectl through programs clearing the environment, such as sudo, are refused
+// rather than run against the current context of another kubeconfig.
+func bashCommand(ctx context.Context, parsed *Command, workDir, kubeconfig, kubeContext string) (*exec.Cmd, *ExecResult) {
+	env := os.Environ()
+	if kubeContext != "" {
+		for _, stage := range parsed.Stages {
+			if strings.Contains(stage.Raw, "kubectl") && clearsEnvironment(stage.Args) {
+				return nil, &ExecResult{Error: fmt.Sprintf("%q can not be run against the kube context %q as it clears the environment, rewrite the command without sudo nor env -i", stage.Raw, kubeContext)}
+			}
+		}
+		var err error
+		kubeconfig, err = contextKubeconfig(workDir, kubeconfig, kubeContext)
+		if err != nil {
+			return nil, &ExecResult{Error: fmt.Sprintf("selecting the kube context %q: %v", kubeContext, err)}
+		}
+	}
+	if kubeconfig != "" {
+		env = append(env, "KUBECONFIG="+kubeconfig)
+	}
+	cmd := exec.CommandContext(ctx, bashBin, "-c", parsed.Raw)
+	cmd.Env = env
+	cmd.Dir = workDir
+	return cmd, nil
+}
+
+// contextKubeconfig writes the kubeconfig selecting the kube context to the working directory, and returns
+// the KUBECONFIG listing it ahead of the kubeconfig files, the default ones if kubeconfig is empty.
+func contextKubeconfig(workDir, kubeconfig, kubeContext string) (string, error) {
+	files := filepath.SplitList(kubeconfig)
+	if len(files) == 0 {
+		files = clientcmd.NewDefaultClientConfigLoadingRules().Precedence
+	}
+	filename := filepath.Join(workDir, contextKubeconfigFile)
+	if err := clientcmd.WriteToFile(clientcmdapi.Config{CurrentContext: kubeContext}, filename); err != nil {
+		return "", err
+	}
+	return strings.Join(append([]string{filename}, files...), string(filepath.ListSeparator)), nil
+}
+
+// clearsEnvironment returns true if a wrapper program of the stage runs the command without KUBECONFIG,
+// e.g. `sudo kubectl` or `env -i kubectl`.
+func clearsEnvironment(args []string) bool {
+	wrappers := args[:len(args)-len(wrappedCommand(args))]
+	program := ""
+	for i, arg := range wrappers {
+		switch {
+		case wrapperPrograms[filepath.Base(arg)] && (i == 0 || !strings.HasPrefix(arg, "-")):
+			program = filepath.Base(arg)
+			if program == "sudo" && !slices.ContainsFunc(wrappers[i+1:], func(a string) bool {
+				return a == "-E" || strings.HasPrefix(a, "--preserve-env")
+			}) {
+				return true
+			}
+		case program == "env" && (arg == "-i" || arg == "-" || arg == "--ignore-environment" || arg == "--unset=KUBECONFIG"):
+			return true
+		case program == "env" && (arg == "-u" || arg == "--unset") && i+1 < len(wrappers) && wrappers[i+1] == "KUBECONFIG":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const twoContextsKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:1
+- name: prod
+  cluster:
+    server: https://127.0.0.1:2
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+- name: prod
+  context:
+    cluster: prod
+    user: test
+current-context: prod
+users:
+- name: test
+  user:
+    token: not-a-token
+`
+
+// TestBashCommandContext checks that every kubectl started by a command line, e.g. through xargs or a script,
+// runs against the kube context of the session rather than the current context of the kubeconfig.
+func TestBashCommandContext(t *testing.T) {
+	dir := t.TempDir()
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	if err := os.WriteFile(kubeconfig, []byte(twoContextsKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// the fake kubectl prints the kubeconfig files it would load
+	bin := filepath.Join(dir, "bin")
+	if err := os.Mkdir(bin, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(bin, "kubectl"), []byte("#!/bin/sh\necho \"$KUBECONFIG\"\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(filepath.ListSeparator)+os.Getenv("PATH"))
+
+	tests := []struct {
+		name    string
+		command string
+		wantErr string
+	}{
+		{name: "pipeline", command: "kubectl get pods | cat"},
+		{name: "xargs", command: "echo pod/web | xargs kubectl delete"},
+		{name: "xargs with a replacement string", command: "echo web | xargs -I {} kubectl delete pod {}"},
+		{name: "path", command: bin + "/kubectl get pods | cat"},
+		{name: "sh script", command: "sh -c 'kubectl delete ns prod'"},
+		{name: "command substitution", command: "echo $(kubectl get pods -o name)"},
+		{name: "sudo", command: "echo web | sudo -u root kubectl delete pod", wantErr: "clears the environment"},
+		{name: "env -i", command: "env -i kubectl get pods | cat", wantErr: "clears the environment"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseCommand(tt.command)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd, result := bashCommand(context.Background(), parsed, t.TempDir(), kubeconfig, "test")
+			if tt.wantErr != "" {
+				if result == nil || !strings.Contains(result.Error, tt.wantErr) {
+					t.Fatalf("bashCommand() = %v, want an error containing %q", result, tt.wantErr)
+				}
+				return
+			}
+			if result != nil {
+				t.Fatalf("bashCommand(): %s", result.Error)
+			}
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("running %q: %v", tt.command, err)
+			}
+			rules := clientcmd.NewDefaultClientConfigLoadingRules()
+			rules.Precedence = filepath.SplitList(strings.TrimSpace(string(out)))
+			config, err := rules.Load()
+			if err != nil {
+				t.Fatalf("loading kubeconfig %q: %v", out, err)
+			}
+			if config.CurrentContext != "test" {
+				t.Errorf("current context = %q, want %q", config.CurrentContext, "test")
+			}
+			if _, ok := config.Contexts["prod"]; !ok {
+				t.Errorf("contexts of the kubeconfig are missing: %v", config.Contexts)
+			}
+		})
+	}
+}
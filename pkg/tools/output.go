@@ -0,0 +1,345 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/kubectl-ai/gollm"
+	"sigs.k8s.io/yaml"
+)
+
+func init() {
+	RegisterTool(&ReadOutput{})
+}
+
+const (
+	// DefaultMaxOutputBytes is the size above which the output of commands is truncated before it is sent to the LLM.
+	DefaultMaxOutputBytes = 16 * 1024
+
+	// outputsDir is the directory of the working directory the truncated outputs are stored in
+	outputsDir = "outputs"
+
+	defaultReadLines = 200
+	// maxReadBytes bounds the output returned by read_output
+	maxReadBytes = 16 * 1024
+
+	maxErrorLines    = 20
+	maxErrorLineSize = 200
+)
+
+// OutputSummary describes the structure of a command output which was too large to be sent whole.
+type OutputSummary struct {
+	// OutputID identifies the full output for the read_output tool, empty if it could not be stored.
+	OutputID string `json:"output_id,omitempty"`
+
+	Bytes int `json:"bytes"`
+	Lines int `json:"lines"`
+
+	// Rows is the number of rows of a table, such as the output of kubectl get.
+	Rows int `json:"rows,omitempty"`
+
+	// Items is the number of items of a YAML or JSON list.
+	Items int `json:"items,omitempty"`
+
+	// Statuses counts the distinct values of the STATUS column of a table, or of the status.phase of the items of a list.
+	Statuses map[string]int `json:"statuses,omitempty"`
+
+	// ErrorLines are the first distinct lines mentioning errors or failures.
+	ErrorLines []string `json:"error_lines,omitempty"`
+}
+
+// sortedStatuses formats the counts of the statuses, most frequent first.
+func (s *OutputSummary) sortedStatuses() string {
+	statuses := make([]string, 0, len(s.Statuses))
+	for status := range s.Statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if s.Statuses[statuses[i]] != s.Statuses[statuses[j]] {
+			return s.Statuses[statuses[i]] > s.Statuses[statuses[j]]
+		}
+		return statuses[i] < statuses[j]
+	})
+	var parts []string
+	for _, status := range statuses {
+		parts = append(parts, fmt.Sprintf("%d %s", s.Statuses[status], status))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// String describes the output for the user.
+func (s *OutputSummary) String() string {
+	text := fmt.Sprintf("%d lines, %d bytes", s.Lines, s.Bytes)
+	switch {
+	case s.Rows > 0:
+		text += fmt.Sprintf(", %d rows", s.Rows)
+	case s.Items > 0:
+		text += fmt.Sprintf(", %d items", s.Items)
+	}
+	if len(s.Statuses) > 0 {
+		text += " (" + s.sortedStatuses() + ")"
+	}
+	if len(s.ErrorLines) > 0 {
+		text += fmt.Sprintf(", %d error lines", len(s.ErrorLines))
+	}
+	return text
+}
+
+// errorLine matches the lines reporting errors in logs, events and kubectl get output.
+var errorLine = regexp.MustCompile(`(?i)\b(error|errors|fail|failed|failure|fatal|panic|exception|denied|forbidden|refused|timeout|timed out|crashloopbackoff|imagepullbackoff|errimagepull|oomkilled|backoff|evicted|unhealthy)\b`)
+
+// tableHeader matches the header line of kubectl get output, e.g. "NAMESPACE   NAME   READY   STATUS".
+var tableHeader = regexp.MustCompile(`^[A-Z][A-Z0-9-]*( +[A-Z][A-Z0-9()-]*( [A-Z][A-Z0-9()-]*)?)+$`)
+
+// SummarizeOutput describes the structure of a command output: its size, the rows of a table or the items
+// of a list along with their statuses, and the lines reporting errors.
+func SummarizeOutput(output string) *OutputSummary {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	summary := &OutputSummary{
+		Bytes: len(output),
+		Lines: len(lines),
+	}
+
+	if len(lines) > 1 && tableHeader.MatchString(strings.TrimSpace(lines[0])) {
+		summarizeTable(summary, lines)
+	} else {
+		summarizeList(summary, output)
+	}
+
+	seen := map[string]bool{}
+	for _, line := range lines {
+		if len(summary.ErrorLines) == maxErrorLines {
+			break
+		}
+		line = strings.TrimSpace(line)
+		if seen[line] || !errorLine.MatchString(line) {
+			continue
+		}
+		seen[line] = true
+		if len(line) > maxErrorLineSize {
+			line = strings.ToValidUTF8(line[:maxErrorLineSize], "") + "..."
+		}
+		summary.ErrorLines = append(summary.ErrorLines, line)
+	}
+	return summary
+}
+
+// summarizeTable counts the rows of a table and the values of its STATUS column, which is located by
+// its offset in the header as values may contain spaces, e.g. "2 (5m ago)" restarts.
+func summarizeTable(summary *OutputSummary, lines []string) {
+	header := lines[0]
+	start := strings.Index(header, "STATUS")
+	end := -1
+	if start >= 0 {
+		if next := strings.IndexFunc(header[start+len("STATUS"):], func(r rune) bool { return r != ' ' }); next >= 0 {
+			end = start + len("STATUS") + next
+		}
+	}
+	for _, line := range lines[1:] {
+		if strings.TrimSpace(line) == "" || line == header {
+			continue
+		}
+		summary.Rows++
+		if start < 0 || len(line) <= start {
+			continue
+		}
+		// tolerate misaligned rows by starting at the beginning of the value
+		from := start
+		for from > 0 && line[from-1] != ' ' {
+			from--
+		}
+		value := line[from:]
+		if end >= 0 && len(line) > end {
+			value = line[from:end]
+		}
+		if fields := strings.Fields(value); len(fields) > 0 {
+			if summary.Statuses == nil {
+				summary.Statuses = map[string]int{}
+			}
+			summary.Statuses[fields[0]]++
+		}
+	}
+}
+
+// summarizeList counts the items of a YAML or JSON list of objects and their phases.
+func summarizeList(summary *OutputSummary, output string) {
+	var list struct {
+		Items []struct {
+			Status struct {
+				Phase string `json:"phase"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := yaml.Unmarshal([]byte(output), &list); err != nil {
+		return
+	}
+	summary.Items = len(list.Items)
+	for _, item := range list.Items {
+		if item.Status.Phase == "" {
+			continue
+		}
+		if summary.Statuses == nil {
+			summary.Statuses = map[string]int{}
+		}
+		summary.Statuses[item.Status.Phase]++
+	}
+}
+
+// Excerpt keeps the first and the last lines of a text longer than max bytes, at most max bytes of them.
+func Excerpt(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	head := s[:max/2]
+	if i := strings.LastIndexByte(head, '\n'); i > 0 {
+		head = head[:i+1]
+	}
+	tail := s[len(s)-max/2:]
+	if i := strings.IndexByte(tail, '\n'); i >= 0 && i < len(tail)-1 {
+		tail = tail[i+1:]
+	}
+	omitted := s[len(head) : len(s)-len(tail)]
+	return fmt.Sprintf("%s... (%d lines, %d bytes omitted) ...\n%s", strings.ToValidUTF8(head, ""), strings.Count(omitted, "\n"), len(omitted), strings.ToValidUTF8(tail, ""))
+}
+
+// StoreOutput stores the full output of a tool call in the working directory, for the read_output tool.
+func StoreOutput(workDir, id, output string) error {
+	dir := filepath.Join(workDir, outputsDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, id+".txt"), []byte(output), 0600); err != nil {
+		return fmt.Errorf("storing output: %w", err)
+	}
+	return nil
+}
+
+// ReadOutput pages through or searches the full output of an earlier command which was truncated.
+type ReadOutput struct{}
+
+func (t *ReadOutput) Name() string {
+	return "read_output"
+}
+
+func (t *ReadOutput) Description() string {
+	return "Reads the full output of an earlier command whose output was truncated, by its output_id. Returns a range of lines, or the lines matching a regular expression. It can not modify the cluster."
+}
+
+func (t *ReadOutput) ReadOnly() bool {
+	return true
+}
+
+func (t *ReadOutput) FunctionDefinition() *gollm.FunctionDefinition {
+	return &gollm.FunctionDefinition{
+		Name:        t.Name(),
+		Description: t.Description(),
+		Parameters: &gollm.Schema{
+			Type: gollm.TypeObject,
+			Properties: map[string]*gollm.Schema{
+				"output_id": {
+					Type:        gollm.TypeString,
+					Description: "The output_id of the truncated output.",
+				},
+				"offset": {
+					Type:        gollm.TypeInteger,
+					Description: "The number of the first line to return, starting at 1. Defaults to 1.",
+				},
+				"limit": {
+					Type:        gollm.TypeInteger,
+					Description: fmt.Sprintf("The maximum number of lines to return, defaults to %d.", defaultReadLines),
+				},
+				"pattern": {
+					Type:        gollm.TypeString,
+					Description: `A regular expression, e.g. "CrashLoopBackOff|Error". Only the lines matching it are returned, prefixed with their line number.`,
+				},
+			},
+			Required: []string{"output_id"},
+		},
+	}
+}
+
+func (t *ReadOutput) Run(ctx context.Context, args map[string]any) (any, error) {
+	workDir, _ := ctx.Value("work_dir").(string)
+	id := stringArg(args, "output_id")
+	if id == "" || filepath.Base(id) != id || strings.HasPrefix(id, ".") {
+		return errorResult("invalid output_id %q", id), nil
+	}
+	offset, err := intArg(args, "offset", 1)
+	if err != nil {
+		return errorResult("%v", err), nil
+	}
+	limit, err := intArg(args, "limit", defaultReadLines)
+	if err != nil {
+		return errorResult("%v", err), nil
+	}
+	if offset < 1 || limit < 1 {
+		return errorResult("offset and limit must be positive"), nil
+	}
+	var pattern *regexp.Regexp
+	if p := stringArg(args, "pattern"); p != "" {
+		pattern, err = regexp.Compile(p)
+		if err != nil {
+			return errorResult("invalid pattern %q: %v", p, err), nil
+		}
+	}
+
+	f, err := os.Open(filepath.Join(workDir, outputsDir, id+".txt"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errorResult("no output with output_id %q", id), nil
+		}
+		return errorResult("%v", err), nil
+	}
+	defer f.Close()
+
+	var sb strings.Builder
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNumber, returned, matches := int64(0), int64(0), int64(0)
+	truncated := false
+	for scanner.Scan() {
+		lineNumber++
+		if lineNumber < offset {
+			continue
+		}
+		line := scanner.Text()
+		if pattern != nil {
+			if !pattern.MatchString(line) {
+				continue
+			}
+			matches++
+			line = fmt.Sprintf("%d: %s", lineNumber, line)
+		}
+		if returned == limit || sb.Len()+len(line) > maxReadBytes {
+			truncated = true
+			continue
+		}
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+		returned++
+	}
+	if err := scanner.Err(); err != nil {
+		return errorResult("reading output: %v", err), nil
+	}
+
+	result := JSONResult{
+		"output_id":   id,
+		"total_lines": lineNumber,
+		"content":     sb.String(),
+	}
+	if pattern != nil {
+		result["matches"] = matches
+	} else if returned > 0 {
+		result["lines"] = fmt.Sprintf("%d-%d", offset, offset+returned-1)
+	}
+	if truncated {
+		result["truncated"] = "more lines are available, read them with a larger offset or a narrower pattern"
+	}
+	return result, nil
+}
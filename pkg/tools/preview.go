@@ -0,0 +1,331 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+	"k8s.io/kubectl/pkg/cmd/diff"
+	"sigs.k8s.io/yaml"
+)
+
+// Preview is the expected effect of a mutating command, computed with a server-side dry-run.
+type Preview struct {
+	// Diff is the unified diff from the live objects to the objects resulting from the command,
+	// empty if nothing changes.
+	Diff string
+
+	// Error is set if the dry-run failed, e.g. because the server rejected the change.
+	Error string
+}
+
+// previewVerbs are the kubectl sub commands which support --dry-run=server and target objects `kubectl get` can read.
+var previewVerbs = map[string]bool{
+	"apply": true, "patch": true, "scale": true, "delete": true, "label": true, "annotate": true,
+	"set image": true, "set env": true, "set resources": true,
+}
+
+// Preview runs the tool call with --dry-run=server and diffs the result against the live objects.
+// It returns nil if the call can not be previewed, e.g. it is not a single mutating kubectl command.
+func (t *ToolCall) Preview(ctx context.Context, opt InvokeToolOptions) *Preview {
+	stage, run, cancel := t.inProcessKubectl(ctx, opt, previewVerbs)
+	if stage == nil {
+		return nil
+	}
+	defer cancel()
+
+	if stage.Kubectl.Verb == "apply" {
+		if preview := kubectlDiff(stage, run); preview != nil {
+			return preview
+		}
+	}
+	return dryRunDiff(stage, run)
+}
+
+// kubectlRunner runs kubectl in-process with the given arguments and stdin.
+type kubectlRunner func(args []string, stdin string) *ExecResult
+
+// newKubectlRunner returns a runner for the kubeconfig and context of the options, bounded by their timeout.
+// The returned cancel function releases the timeout.
+func newKubectlRunner(ctx context.Context, opt InvokeToolOptions) (kubectlRunner, context.CancelFunc, error) {
+	kubeconfig := opt.Kubeconfig
+	if kubeconfig != "" {
+		expanded, err := expandShellVar(kubeconfig)
+		if err != nil {
+			return nil, nil, fmt.Errorf("expanding kubeconfig %q: %w", kubeconfig, err)
+		}
+		kubeconfig = expanded
+	}
+	if strings.Contains(kubeconfig, string(filepath.ListSeparator)) {
+		return nil, nil, fmt.Errorf("kubeconfig %q lists more than one file", kubeconfig)
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if opt.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opt.Timeout)
+	}
+	run := func(args []string, stdin string) *ExecResult {
+		s := &Stage{Args: append([]string{"kubectl"}, args...), Stdin: stdin}
+		return runKubectlInProcess(ctx, s, kubeconfig, opt.KubeContext, opt.Timeout)
+	}
+	return run, cancel, nil
+}
+
+// inProcessKubectl returns the stage of tool calls running a single mutating kubectl command with one of the given verbs,
+// and a runner for other kubectl commands against the same cluster. It returns a nil stage otherwise.
+func (t *ToolCall) inProcessKubectl(ctx context.Context, opt InvokeToolOptions, verbs map[string]bool) (*Stage, kubectlRunner, context.CancelFunc) {
+	if t.command == nil || t.command.Classification() != Mutating {
+		return nil, nil, nil
+	}
+	stage := inProcessStage(t.command, "")
+	if stage == nil || !verbs[stage.Kubectl.Verb] {
+		return nil, nil, nil
+	}
+	run, cancel, err := newKubectlRunner(ctx, opt)
+	if err != nil {
+		klog.Warningf("can not run %q in-process: %v", t.PrettyPrint(), err)
+		return nil, nil, nil
+	}
+	return stage, run, cancel
+}
+
+// kubectlDiff previews `kubectl apply` with `kubectl diff`, which needs the diff program.
+// It returns nil if kubectl diff can not be used.
+func kubectlDiff(stage *Stage, run kubectlRunner) *Preview {
+	if _, err := exec.LookPath("diff"); err != nil {
+		return nil
+	}
+	args := append([]string(nil), stage.Args[1:]...)
+	for i, arg := range args {
+		if arg == "apply" {
+			args[i] = "diff"
+			break
+		}
+	}
+
+	// kubectl diff exits with 1 if there are differences and greater than 1 on errors
+	result := run(args, stage.Stdin)
+	switch {
+	case result.Error != "":
+		return &Preview{Error: result.Error}
+	case result.ExitCode == 0:
+		return &Preview{}
+	case result.ExitCode == 1:
+		return &Preview{Diff: result.Stdout}
+	}
+	klog.V(1).Infof("kubectl diff failed, falling back to a dry-run: %s", result.Stderr)
+	return nil
+}
+
+// dryRunDiff runs the command with --dry-run=server and diffs its output against the live objects.
+func dryRunDiff(stage *Stage, run kubectlRunner) *Preview {
+	k := stage.Kubectl
+	targets := liveTargets(k)
+	if targets == nil {
+		return nil
+	}
+
+	args := append(append([]string(nil), stage.Args[1:]...), "--dry-run=server")
+	if k.Verb != "delete" {
+		args = append(args, "-o", "yaml")
+	}
+	result := run(args, stage.Stdin)
+	if result.Error != "" || result.ExitCode != 0 {
+		return &Preview{Error: strings.TrimSpace(result.Error + result.Stderr)}
+	}
+	var after []*unstructured.Unstructured
+	if k.Verb != "delete" {
+		objs, err := parseObjects(result.Stdout)
+		if err != nil {
+			return &Preview{Error: fmt.Sprintf("parsing dry-run output: %v", err)}
+		}
+		after = objs
+	}
+
+	live := run(append(append([]string{"get"}, targets...), "-o", "yaml", "--ignore-not-found"), stage.Stdin)
+	if live.Error != "" || live.ExitCode != 0 {
+		return &Preview{Error: fmt.Sprintf("reading live objects: %s", strings.TrimSpace(live.Error+live.Stderr))}
+	}
+	before, err := parseObjects(live.Stdout)
+	if err != nil {
+		return &Preview{Error: fmt.Sprintf("parsing live objects: %v", err)}
+	}
+
+	return &Preview{Diff: diffObjects(before, after, k.Verb == "delete")}
+}
+
+// liveTargets returns the `kubectl get` arguments reading the objects targeted by the command,
+// or nil if they can not be determined.
+func liveTargets(k *KubectlCommand) []string {
+	var args []string
+	switch {
+	case len(k.Flags["filename"]) > 0:
+		for _, f := range k.Flags["filename"] {
+			args = append(args, "-f", f)
+		}
+		if v, ok := k.Flag("recursive"); ok && v != "false" {
+			args = append(args, "-R")
+		}
+	case len(k.Flags["kustomize"]) > 0:
+		dir, _ := k.Flag("kustomize")
+		args = append(args, "-k", dir)
+	case len(k.Resources) == 0:
+		return nil
+	default:
+		if len(k.Names) == len(k.Resources) {
+			for i := range k.Names {
+				args = append(args, k.Resources[i]+"/"+k.Names[i])
+			}
+		} else {
+			args = append(args, strings.Join(k.Resources, ","))
+			args = append(args, k.Names...)
+		}
+		selector, hasSelector := k.Flag("selector")
+		if hasSelector {
+			args = append(args, "-l", selector)
+		}
+		fieldSelector, hasFieldSelector := k.Flag("field-selector")
+		if hasFieldSelector {
+			args = append(args, "--field-selector", fieldSelector)
+		}
+		all, hasAll := k.Flag("all")
+		if len(k.Names) == 0 && !hasSelector && !hasFieldSelector && (!hasAll || all == "false") {
+			return nil
+		}
+	}
+
+	if k.AllNamespaces {
+		args = append(args, "-A")
+	} else if k.Namespace != "" {
+		args = append(args, "-n", k.Namespace)
+	}
+	if k.Context != "" {
+		args = append(args, "--context", k.Context)
+	}
+	return args
+}
+
+// parseObjects parses the YAML output of kubectl, a stream of documents which may be lists.
+func parseObjects(s string) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+	for _, doc := range strings.Split("\n"+s, "\n---") {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		obj := map[string]any{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			return nil, err
+		}
+		if len(obj) == 0 {
+			continue
+		}
+		u := &unstructured.Unstructured{Object: obj}
+		if u.IsList() {
+			list, err := u.ToList()
+			if err != nil {
+				return nil, err
+			}
+			for i := range list.Items {
+				objs = append(objs, &list.Items[i])
+			}
+			continue
+		}
+		objs = append(objs, u)
+	}
+	return objs, nil
+}
+
+// diffObjects diffs the objects by kind, namespace and name, masking the values of secrets.
+// Live objects missing from after are only shown as removed if the command deletes them.
+func diffObjects(before, after []*unstructured.Unstructured, deleted bool) string {
+	key := func(u *unstructured.Unstructured) string {
+		if u.GetNamespace() == "" {
+			return u.GetKind() + "/" + u.GetName()
+		}
+		return u.GetKind() + "/" + u.GetNamespace() + "/" + u.GetName()
+	}
+
+	live := map[string]*unstructured.Unstructured{}
+	var keys []string
+	for _, u := range before {
+		live[key(u)] = u
+		keys = append(keys, key(u))
+	}
+	changed := map[string]*unstructured.Unstructured{}
+	for _, u := range after {
+		if _, ok := live[key(u)]; !ok {
+			keys = append(keys, key(u))
+		}
+		changed[key(u)] = u
+	}
+
+	var sb strings.Builder
+	for _, k := range keys {
+		from, to := live[k], changed[k]
+		if to == nil && !deleted {
+			continue
+		}
+		fromYAML, toYAML, err := maskedYAML(from, to)
+		if err != nil {
+			fmt.Fprintf(&sb, "# %s: %v\n", k, err)
+			continue
+		}
+		sb.WriteString(unifiedDiff("live/"+k, "dry-run/"+k, fromYAML, toYAML))
+	}
+	return sb.String()
+}
+
+// maskedYAML renders the objects without server managed fields, masking secret data the same way as kubectl diff.
+func maskedYAML(from, to *unstructured.Unstructured) (string, string, error) {
+	from, to = normalizeObject(from), normalizeObject(to)
+	var fromObj, toObj runtime.Object
+	if from != nil {
+		fromObj = from
+	}
+	if to != nil {
+		toObj = to
+	}
+	if (from != nil && from.GetKind() == "Secret") || (to != nil && to.GetKind() == "Secret") {
+		masker, err := diff.NewMasker(fromObj, toObj)
+		if err != nil {
+			return "", "", err
+		}
+		fromObj, toObj = masker.From(), masker.To()
+	}
+
+	render := func(obj runtime.Object) (string, error) {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok || u == nil {
+			return "", nil
+		}
+		b, err := yaml.Marshal(u.Object)
+		return string(b), err
+	}
+	fromYAML, err := render(fromObj)
+	if err != nil {
+		return "", "", err
+	}
+	toYAML, err := render(toObj)
+	return fromYAML, toYAML, err
+}
+
+// normalizeObject removes the fields changing on every write, which would only add noise to the diff.
+func normalizeObject(u *unstructured.Unstructured) *unstructured.Unstructured {
+	if u == nil {
+		return nil
+	}
+	u = u.DeepCopy()
+	for _, field := range []string{"managedFields", "resourceVersion", "generation", "uid", "creationTimestamp"} {
+		unstructured.RemoveNestedField(u.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(u.Object, "metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration")
+	if annotations, found, _ := unstructured.NestedMap(u.Object, "metadata", "annotations"); found && len(annotations) == 0 {
+		unstructured.RemoveNestedField(u.Object, "metadata", "annotations")
+	}
+	return u
+}
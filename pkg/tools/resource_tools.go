@@ -0,0 +1,451 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubectl-ai/gollm"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/kubectl/pkg/describe"
+)
+
+func init() {
+	RegisterTool(&GetResources{})
+	RegisterTool(&DescribeResource{})
+	RegisterTool(&GetEvents{})
+	RegisterTool(&GetLogs{})
+}
+
+const (
+	defaultListLimit = 100
+	defaultTailLines = 100
+	// maxLogBytes bounds the logs returned to the LLM
+	maxLogBytes = 256 * 1024
+)
+
+// typeParameters are the parameters selecting a resource type, shared by the structured tools.
+func typeParameters() map[string]*gollm.Schema {
+	return map[string]*gollm.Schema{
+		"kind": {
+			Type:        gollm.TypeString,
+			Description: `The kind, resource or short name of the resource type, e.g. "Deployment", "pods" or "svc".`,
+		},
+		"group": {
+			Type:        gollm.TypeString,
+			Description: `The API group of the resource type, e.g. "apps". Optional, only needed to disambiguate kinds.`,
+		},
+		"version": {
+			Type:        gollm.TypeString,
+			Description: `The API version of the resource type, e.g. "v1". Optional.`,
+		},
+		"namespace": {
+			Type:        gollm.TypeString,
+			Description: `The namespace of the resources, defaults to the namespace of the current context. Ignored for cluster scoped resources.`,
+		},
+	}
+}
+
+// GetResources lists or gets resources of any type with the dynamic client.
+type GetResources struct{}
+
+func (t *GetResources) Name() string {
+	return "get_resources"
+}
+
+func (t *GetResources) Description() string {
+	return "Lists resources of a given type, or gets a single resource by name, from the user's Kubernetes cluster. Lists return a summary of each resource, a single resource is returned in full. It can not modify the cluster."
+}
+
+func (t *GetResources) ReadOnly() bool {
+	return true
+}
+
+func (t *GetResources) FunctionDefinition() *gollm.FunctionDefinition {
+	properties := typeParameters()
+	properties["name"] = &gollm.Schema{
+		Type:        gollm.TypeString,
+		Description: "The name of the resource to get. If empty, the resources are listed.",
+	}
+	properties["all_namespaces"] = &gollm.Schema{
+		Type:        gollm.TypeBoolean,
+		Description: "List the resources across all namespaces.",
+	}
+	properties["label_selector"] = &gollm.Schema{
+		Type:        gollm.TypeString,
+		Description: `Only list the resources matching the label selector, e.g. "app=nginx,tier!=frontend".`,
+	}
+	properties["field_selector"] = &gollm.Schema{
+		Type:        gollm.TypeString,
+		Description: `Only list the resources matching the field selector, e.g. "status.phase=Running".`,
+	}
+	properties["limit"] = &gollm.Schema{
+		Type:        gollm.TypeInteger,
+		Description: fmt.Sprintf("The maximum number of resources to list, defaults to %d.", defaultListLimit),
+	}
+	return &gollm.FunctionDefinition{
+		Name:        t.Name(),
+		Description: t.Description(),
+		Parameters: &gollm.Schema{
+			Type:       gollm.TypeObject,
+			Properties: properties,
+			Required:   []string{"kind"},
+		},
+	}
+}
+
+func (t *GetResources) Run(ctx context.Context, args map[string]any) (any, error) {
+	clients, err := kubeClientsFromContext(ctx)
+	if err != nil {
+		return errorResult("%v", err), nil
+	}
+	mapping, err := clients.mapping(stringArg(args, "group"), stringArg(args, "version"), stringArg(args, "kind"))
+	if err != nil {
+		return errorResult("resolving resource type: %v", err), nil
+	}
+	namespace := stringArg(args, "namespace")
+	if namespace == "" {
+		namespace = clients.namespace
+	}
+	if boolArg(args, "all_namespaces") {
+		namespace = metav1.NamespaceAll
+	}
+
+	if name := stringArg(args, "name"); name != "" {
+		obj, err := clients.resource(mapping, namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return errorResult("%v", err), nil
+		}
+		return JSONResult{"object": compactObject(obj)}, nil
+	}
+
+	limit, err := intArg(args, "limit", defaultListLimit)
+	if err != nil {
+		return errorResult("%v", err), nil
+	}
+	if limit < 1 {
+		return errorResult("limit must be positive"), nil
+	}
+	list, err := clients.resource(mapping, namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: stringArg(args, "label_selector"),
+		FieldSelector: stringArg(args, "field_selector"),
+		Limit:         limit,
+	})
+	if err != nil {
+		return errorResult("%v", err), nil
+	}
+
+	items := make([]map[string]any, 0, len(list.Items))
+	for i := range list.Items {
+		items = append(items, summarizeObject(&list.Items[i]))
+	}
+	result := JSONResult{
+		"kind":  mapping.GroupVersionKind.Kind,
+		"items": items,
+	}
+	if list.GetContinue() != "" {
+		result["truncated"] = fmt.Sprintf("only the first %d resources are listed, use a selector or a higher limit", limit)
+	}
+	return result, nil
+}
+
+// DescribeResource describes a resource the same way as `kubectl describe`, including its events.
+type DescribeResource struct{}
+
+func (t *DescribeResource) Name() string {
+	return "describe_resource"
+}
+
+func (t *DescribeResource) Description() string {
+	return "Describes a single resource of the user's Kubernetes cluster like `kubectl describe`, including its related resources and recent events. It can not modify the cluster."
+}
+
+func (t *DescribeResource) ReadOnly() bool {
+	return true
+}
+
+func (t *DescribeResource) FunctionDefinition() *gollm.FunctionDefinition {
+	properties := typeParameters()
+	properties["name"] = &gollm.Schema{
+		Type:        gollm.TypeString,
+		Description: "The name of the resource to describe.",
+	}
+	return &gollm.FunctionDefinition{
+		Name:        t.Name(),
+		Description: t.Description(),
+		Parameters: &gollm.Schema{
+			Type:       gollm.TypeObject,
+			Properties: properties,
+			Required:   []string{"kind", "name"},
+		},
+	}
+}
+
+func (t *DescribeResource) Run(ctx context.Context, args map[string]any) (any, error) {
+	clients, err := kubeClientsFromContext(ctx)
+	if err != nil {
+		return errorResult("%v", err), nil
+	}
+	mapping, err := clients.mapping(stringArg(args, "group"), stringArg(args, "version"), stringArg(args, "kind"))
+	if err != nil {
+		return errorResult("resolving resource type: %v", err), nil
+	}
+	name := stringArg(args, "name")
+	if name == "" {
+		return errorResult("name is required"), nil
+	}
+	namespace := stringArg(args, "namespace")
+	if namespace == "" {
+		namespace = clients.namespace
+	}
+
+	describer, ok := describe.DescriberFor(mapping.GroupVersionKind.GroupKind(), clients.config)
+	if !ok {
+		describer, ok = describe.GenericDescriberFor(mapping, clients.config)
+		if !ok {
+			return errorResult("no describer for %s", mapping.GroupVersionKind.Kind), nil
+		}
+	}
+	description, err := describer.Describe(namespace, name, describe.DescriberSettings{ShowEvents: true, ChunkSize: 500})
+	if err != nil {
+		return errorResult("%v", err), nil
+	}
+	return JSONResult{"description": description}, nil
+}
+
+// GetEvents lists events, most recent last.
+type GetEvents struct{}
+
+func (t *GetEvents) Name() string {
+	return "get_events"
+}
+
+func (t *GetEvents) Description() string {
+	return "Lists the most recent events of the user's Kubernetes cluster, optionally only the ones of a given resource or of type Warning. It can not modify the cluster."
+}
+
+func (t *GetEvents) ReadOnly() bool {
+	return true
+}
+
+func (t *GetEvents) FunctionDefinition() *gollm.FunctionDefinition {
+	return &gollm.FunctionDefinition{
+		Name:        t.Name(),
+		Description: t.Description(),
+		Parameters: &gollm.Schema{
+			Type: gollm.TypeObject,
+			Properties: map[string]*gollm.Schema{
+				"namespace": {
+					Type:        gollm.TypeString,
+					Description: "The namespace of the events, defaults to the namespace of the current context.",
+				},
+				"all_namespaces": {
+					Type:        gollm.TypeBoolean,
+					Description: "List the events across all namespaces.",
+				},
+				"kind": {
+					Type:        gollm.TypeString,
+					Description: `Only list the events of resources of this kind, e.g. "Pod".`,
+				},
+				"name": {
+					Type:        gollm.TypeString,
+					Description: "Only list the events of the resource with this name.",
+				},
+				"type": {
+					Type:        gollm.TypeString,
+					Description: `Only list the events of this type, "Normal" or "Warning".`,
+				},
+				"field_selector": {
+					Type:        gollm.TypeString,
+					Description: `Only list the events matching the field selector, e.g. "reason=BackOff".`,
+				},
+				"limit": {
+					Type:        gollm.TypeInteger,
+					Description: fmt.Sprintf("The maximum number of events to return, defaults to %d.", defaultListLimit),
+				},
+			},
+		},
+	}
+}
+
+func (t *GetEvents) Run(ctx context.Context, args map[string]any) (any, error) {
+	clients, err := kubeClientsFromContext(ctx)
+	if err != nil {
+		return errorResult("%v", err), nil
+	}
+	namespace := stringArg(args, "namespace")
+	if namespace == "" {
+		namespace = clients.namespace
+	}
+	if boolArg(args, "all_namespaces") {
+		namespace = metav1.NamespaceAll
+	}
+	limit, err := intArg(args, "limit", defaultListLimit)
+	if err != nil {
+		return errorResult("%v", err), nil
+	}
+	if limit < 1 {
+		return errorResult("limit must be positive"), nil
+	}
+
+	selectors := map[string]string{}
+	if kind := stringArg(args, "kind"); kind != "" {
+		// the field selector is case-sensitive and matches the kind, e.g. "Pod" rather than "pods" or "po"
+		mapping, err := clients.mapping("", "", kind)
+		if err != nil {
+			return errorResult("resolving resource type: %v", err), nil
+		}
+		selectors["involvedObject.kind"] = mapping.GroupVersionKind.Kind
+	}
+	if name := stringArg(args, "name"); name != "" {
+		selectors["involvedObject.name"] = name
+	}
+	if eventType := stringArg(args, "type"); eventType != "" {
+		selectors["type"] = eventType
+	}
+	fieldSelector := fields.SelectorFromSet(selectors).String()
+	if s := stringArg(args, "field_selector"); s != "" {
+		fieldSelector = strings.Trim(fieldSelector+","+s, ",")
+	}
+
+	list, err := clients.clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{FieldSelector: fieldSelector})
+	if err != nil {
+		return errorResult("%v", err), nil
+	}
+	events := list.Items
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventTime(&events[i]).Before(eventTime(&events[j]))
+	})
+	if int64(len(events)) > limit {
+		events = events[int64(len(events))-limit:]
+	}
+
+	items := make([]map[string]any, 0, len(events))
+	for i := range events {
+		e := &events[i]
+		item := map[string]any{
+			"type":      e.Type,
+			"reason":    e.Reason,
+			"object":    strings.ToLower(e.InvolvedObject.Kind) + "/" + e.InvolvedObject.Name,
+			"message":   strings.TrimSpace(e.Message),
+			"last_seen": time.Since(eventTime(e)).Round(time.Second).String() + " ago",
+		}
+		if namespace == metav1.NamespaceAll {
+			item["namespace"] = e.Namespace
+		}
+		if e.Count > 1 {
+			item["count"] = e.Count
+		}
+		items = append(items, item)
+	}
+	return JSONResult{"events": items}, nil
+}
+
+// eventTime returns the time the event was last observed.
+func eventTime(e *corev1.Event) time.Time {
+	switch {
+	case e.Series != nil && !e.Series.LastObservedTime.IsZero():
+		return e.Series.LastObservedTime.Time
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	}
+	return e.CreationTimestamp.Time
+}
+
+// GetLogs returns the logs of a container.
+type GetLogs struct{}
+
+func (t *GetLogs) Name() string {
+	return "get_logs"
+}
+
+func (t *GetLogs) Description() string {
+	return "Returns the logs of a container of a pod in the user's Kubernetes cluster. It can not modify the cluster."
+}
+
+func (t *GetLogs) ReadOnly() bool {
+	return true
+}
+
+func (t *GetLogs) FunctionDefinition() *gollm.FunctionDefinition {
+	return &gollm.FunctionDefinition{
+		Name:        t.Name(),
+		Description: t.Description(),
+		Parameters: &gollm.Schema{
+			Type: gollm.TypeObject,
+			Properties: map[string]*gollm.Schema{
+				"name": {
+					Type:        gollm.TypeString,
+					Description: "The name of the pod.",
+				},
+				"namespace": {
+					Type:        gollm.TypeString,
+					Description: "The namespace of the pod, defaults to the namespace of the current context.",
+				},
+				"container": {
+					Type:        gollm.TypeString,
+					Description: "The name of the container, only needed if the pod has more than one container.",
+				},
+				"tail_lines": {
+					Type:        gollm.TypeInteger,
+					Description: fmt.Sprintf("The number of lines to return from the end of the logs, defaults to %d.", defaultTailLines),
+				},
+				"since": {
+					Type:        gollm.TypeString,
+					Description: `Only return the logs newer than this duration, e.g. "10m" or "1h".`,
+				},
+				"previous": {
+					Type:        gollm.TypeBoolean,
+					Description: "Return the logs of the previous, terminated, instance of the container, e.g. after a crash.",
+				},
+			},
+			Required: []string{"name"},
+		},
+	}
+}
+
+func (t *GetLogs) Run(ctx context.Context, args map[string]any) (any, error) {
+	clients, err := kubeClientsFromContext(ctx)
+	if err != nil {
+		return errorResult("%v", err), nil
+	}
+	name := stringArg(args, "name")
+	if name == "" {
+		return errorResult("name is required"), nil
+	}
+	namespace := stringArg(args, "namespace")
+	if namespace == "" {
+		namespace = clients.namespace
+	}
+	tailLines, err := intArg(args, "tail_lines", defaultTailLines)
+	if err != nil {
+		return errorResult("%v", err), nil
+	}
+	limitBytes := int64(maxLogBytes)
+	options := &corev1.PodLogOptions{
+		Container:  stringArg(args, "container"),
+		TailLines:  &tailLines,
+		Previous:   boolArg(args, "previous"),
+		LimitBytes: &limitBytes,
+	}
+	if since := stringArg(args, "since"); since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil {
+			return errorResult("invalid since %q: %v", since, err), nil
+		}
+		seconds := int64(d.Seconds())
+		options.SinceSeconds = &seconds
+	}
+
+	logs, err := clients.clientset.CoreV1().Pods(namespace).GetLogs(name, options).DoRaw(ctx)
+	if err != nil {
+		return errorResult("%v", err), nil
+	}
+	return JSONResult{"pod": name, "container": options.Container, "logs": string(logs)}, nil
+}
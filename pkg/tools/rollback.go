@@ -0,0 +1,288 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"github.com/ardaguclu/kubectl-interact/pkg/snapshot"
+)
+
+// snapshotVerbs are the kubectl sub commands whose targets are snapshotted before they run.
+var snapshotVerbs = map[string]bool{
+	"apply": true, "create": true, "replace": true, "patch": true, "scale": true, "delete": true,
+	"label": true, "annotate": true, "rollout restart": true, "rollout undo": true, "rollout pause": true, "rollout resume": true,
+	"set image": true, "set env": true, "set resources": true, "set selector": true, "set serviceaccount": true, "set subject": true,
+	"create deployment": true, "create configmap": true, "create secret generic": true, "create secret tls": true,
+	"create secret docker-registry": true, "create service clusterip": true, "create service nodeport": true,
+	"create service loadbalancer": true, "create namespace": true, "create serviceaccount": true, "create job": true,
+	"create cronjob": true, "create role": true, "create rolebinding": true, "create clusterrole": true, "create clusterrolebinding": true,
+	"create ingress": true, "create poddisruptionbudget": true, "create priorityclass": true, "create quota": true,
+}
+
+// Snapshottable returns true if the objects affected by the tool call can be determined, so that Snapshot can
+// capture them. It does not ask the cluster, the snapshot may still fail.
+func (t *ToolCall) Snapshottable() bool {
+	if t.command == nil || t.command.Classification() != Mutating {
+		return false
+	}
+	stage := inProcessStage(t.command, "")
+	return stage != nil && snapshotVerbs[stage.Kubectl.Verb] && !stage.Kubectl.DeletesNamespaces() && liveTargets(stage.Kubectl) != nil
+}
+
+// DeletesNamespaces returns true if the tool call deletes namespaces. It can not be rolled back, the snapshot
+// would capture the Namespace objects but not the objects deleted along with them.
+func (t *ToolCall) DeletesNamespaces() bool {
+	if t.command == nil {
+		return false
+	}
+	for _, k := range t.command.Kubectl() {
+		if k.DeletesNamespaces() {
+			return true
+		}
+	}
+	return false
+}
+
+// Snapshot captures the objects affected by the tool call before it runs, and the objects it would create.
+// It returns nil if the affected objects can not be determined, e.g. the call is not a single mutating kubectl command.
+func (t *ToolCall) Snapshot(ctx context.Context, opt InvokeToolOptions) (*snapshot.Snapshot, error) {
+	stage, run, cancel := t.inProcessKubectl(ctx, opt, snapshotVerbs)
+	if stage == nil {
+		return nil, nil
+	}
+	defer cancel()
+
+	k := stage.Kubectl
+	targets := liveTargets(k)
+	if targets == nil || k.DeletesNamespaces() {
+		return nil, nil
+	}
+	live := run(append(append([]string{"get"}, targets...), "-o", "yaml", "--ignore-not-found"), stage.Stdin)
+	if live.Error != "" || live.ExitCode != 0 {
+		return nil, fmt.Errorf("reading objects: %s", strings.TrimSpace(live.Error+live.Stderr))
+	}
+	before, err := parseObjects(live.Stdout)
+	if err != nil {
+		return nil, fmt.Errorf("parsing objects: %w", err)
+	}
+
+	snap := &snapshot.Snapshot{
+		CallID:  t.id,
+		Command: t.PrettyPrint(),
+		Time:    time.Now(),
+		Context: opt.KubeContext,
+	}
+	if k.Context != "" {
+		snap.Context = k.Context
+	}
+	existing := map[snapshot.ObjectRef]bool{}
+	for _, u := range before {
+		if k.Verb == "delete" && u.GetKind() == "Namespace" {
+			// e.g. `kubectl delete -f ns.yaml`, the objects in the namespace are not captured
+			return nil, fmt.Errorf("deleting namespace %s deletes the objects in it as well", u.GetName())
+		}
+		existing[objectKey(u)] = true
+		snap.Objects = append(snap.Objects, restorableObject(u).Object)
+	}
+
+	if k.Verb == "apply" || strings.HasPrefix(k.Verb, "create") {
+		// the objects which do not exist yet are deleted on rollback
+		result := run(append(append([]string(nil), stage.Args[1:]...), "--dry-run=server", "-o", "yaml"), stage.Stdin)
+		if result.Error != "" || result.ExitCode != 0 {
+			return nil, fmt.Errorf("finding the objects created by the command: %s", strings.TrimSpace(result.Error+result.Stderr))
+		}
+		planned, err := parseObjects(result.Stdout)
+		if err != nil {
+			return nil, fmt.Errorf("parsing dry-run output: %w", err)
+		}
+		for _, u := range planned {
+			if !existing[objectKey(u)] {
+				snap.Created = append(snap.Created, snapshot.RefOf(u))
+			}
+		}
+	}
+	return snap, nil
+}
+
+// objectKey identifies the object regardless of its API version.
+func objectKey(u *unstructured.Unstructured) snapshot.ObjectRef {
+	ref := snapshot.RefOf(u)
+	ref.APIVersion = u.GroupVersionKind().Group
+	return ref
+}
+
+// restorableObject removes the fields set by the server, so that the object can be replaced or created again.
+func restorableObject(u *unstructured.Unstructured) *unstructured.Unstructured {
+	u = u.DeepCopy()
+	for _, field := range []string{"managedFields", "resourceVersion", "generation", "uid", "creationTimestamp", "selfLink", "deletionTimestamp", "deletionGracePeriodSeconds"} {
+		unstructured.RemoveNestedField(u.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(u.Object, "status")
+	return u
+}
+
+// rollbackPlan are the operations restoring a snapshot.
+type rollbackPlan struct {
+	// current are the objects of the snapshot as they are now
+	current []*unstructured.Unstructured
+	// replace are the objects which still exist, create the ones which were deleted
+	replace, create []*unstructured.Unstructured
+	// delete are the objects created by the tool call
+	delete []*unstructured.Unstructured
+}
+
+func planRollback(snap *snapshot.Snapshot, run kubectlRunner) (*rollbackPlan, error) {
+	var refs []*unstructured.Unstructured
+	for _, ref := range snap.Refs() {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion(ref.APIVersion)
+		u.SetKind(ref.Kind)
+		u.SetNamespace(ref.Namespace)
+		u.SetName(ref.Name)
+		refs = append(refs, u)
+	}
+	if len(refs) == 0 {
+		return &rollbackPlan{}, nil
+	}
+	stdin, err := objectsYAML(refs)
+	if err != nil {
+		return nil, err
+	}
+	result := run([]string{"get", "-f", "-", "-o", "yaml", "--ignore-not-found"}, stdin)
+	if result.Error != "" || result.ExitCode != 0 {
+		return nil, fmt.Errorf("reading objects: %s", strings.TrimSpace(result.Error+result.Stderr))
+	}
+	current, err := parseObjects(result.Stdout)
+	if err != nil {
+		return nil, fmt.Errorf("parsing objects: %w", err)
+	}
+
+	plan := &rollbackPlan{current: current}
+	exists := map[snapshot.ObjectRef]bool{}
+	for _, u := range current {
+		exists[objectKey(u)] = true
+	}
+	for _, u := range snap.Unstructured() {
+		if exists[objectKey(u)] {
+			plan.replace = append(plan.replace, u)
+		} else {
+			plan.create = append(plan.create, u)
+		}
+	}
+	created := map[snapshot.ObjectRef]bool{}
+	for _, ref := range snap.Created {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion(ref.APIVersion)
+		u.SetKind(ref.Kind)
+		u.SetNamespace(ref.Namespace)
+		u.SetName(ref.Name)
+		created[objectKey(u)] = true
+	}
+	for _, u := range current {
+		if created[objectKey(u)] {
+			plan.delete = append(plan.delete, u)
+		}
+	}
+	return plan, nil
+}
+
+// RollbackPreview diffs the current objects of the snapshot against the result of restoring it, with a server-side dry-run.
+func RollbackPreview(ctx context.Context, opt InvokeToolOptions, snap *snapshot.Snapshot) *Preview {
+	if snap.Context != "" {
+		opt.KubeContext = snap.Context
+	}
+	run, cancel, err := newKubectlRunner(ctx, opt)
+	if err != nil {
+		return &Preview{Error: err.Error()}
+	}
+	defer cancel()
+
+	plan, err := planRollback(snap, run)
+	if err != nil {
+		return &Preview{Error: err.Error()}
+	}
+	var after []*unstructured.Unstructured
+	for _, op := range []struct {
+		verb string
+		objs []*unstructured.Unstructured
+	}{{"replace", plan.replace}, {"create", plan.create}} {
+		if len(op.objs) == 0 {
+			continue
+		}
+		stdin, err := objectsYAML(op.objs)
+		if err != nil {
+			return &Preview{Error: err.Error()}
+		}
+		result := run([]string{op.verb, "-f", "-", "--dry-run=server", "-o", "yaml"}, stdin)
+		if result.Error != "" || result.ExitCode != 0 {
+			return &Preview{Error: strings.TrimSpace(result.Error + result.Stderr)}
+		}
+		objs, err := parseObjects(result.Stdout)
+		if err != nil {
+			return &Preview{Error: fmt.Sprintf("parsing dry-run output: %v", err)}
+		}
+		after = append(after, objs...)
+	}
+	// the objects created by the tool call are missing from after, they are shown as deleted
+	return &Preview{Diff: diffObjects(plan.current, after, true)}
+}
+
+// Rollback restores the objects of the snapshot and deletes the objects created by the tool call.
+func Rollback(ctx context.Context, opt InvokeToolOptions, snap *snapshot.Snapshot) (*ExecResult, error) {
+	if snap.Context != "" {
+		opt.KubeContext = snap.Context
+	}
+	run, cancel, err := newKubectlRunner(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	plan, err := planRollback(snap, run)
+	if err != nil {
+		return nil, err
+	}
+	results := &ExecResult{}
+	for _, op := range []struct {
+		args []string
+		objs []*unstructured.Unstructured
+	}{
+		{[]string{"replace", "-f", "-"}, plan.replace},
+		{[]string{"create", "-f", "-"}, plan.create},
+		{[]string{"delete", "-f", "-", "--ignore-not-found"}, plan.delete},
+	} {
+		if len(op.objs) == 0 {
+			continue
+		}
+		stdin, err := objectsYAML(op.objs)
+		if err != nil {
+			return nil, err
+		}
+		result := run(op.args, stdin)
+		results.Stdout += result.Stdout
+		results.Stderr += result.Stderr
+		if result.Error != "" {
+			results.Error = result.Error
+		}
+		results.ExitCode = max(results.ExitCode, result.ExitCode)
+	}
+	return results, nil
+}
+
+// objectsYAML renders the objects as a YAML stream.
+func objectsYAML(objs []*unstructured.Unstructured) (string, error) {
+	var docs []string
+	for _, u := range objs {
+		b, err := yaml.Marshal(u.Object)
+		if err != nil {
+			return "", fmt.Errorf("converting %s to yaml: %w", u.GetName(), err)
+		}
+		docs = append(docs, string(b))
+	}
+	return strings.Join(docs, "---\n"), nil
+}
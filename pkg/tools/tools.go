@@ -22,8 +22,10 @@ import (
 	"slices"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"k8s.io/klog/v2"
 )
 
 func Lookup(name string) Tool {
@@ -74,11 +76,80 @@ type ToolCall struct {
 	tool      Tool
 	name      string
 	arguments map[string]any
+
+	// id identifies the tool call, e.g. in snapshots
+	id string
+
+	// command is the parsed "command" argument, nil if the tool has no command argument
+	command *Command
+}
+
+// ID returns the unique ID of the tool call.
+func (t *ToolCall) ID() string {
+	return t.id
+}
+
+// Name returns the name of the tool being called.
+func (t *ToolCall) Name() string {
+	return t.name
+}
+
+// Command returns the parsed command line of tools taking a "command" argument, such as kubectl and bash.
+// It returns nil if the tool has no command argument.
+func (t *ToolCall) Command() *Command {
+	return t.command
+}
+
+// Arguments returns the arguments the LLM passed to the tool.
+func (t *ToolCall) Arguments() map[string]any {
+	return t.arguments
+}
+
+// StringArgument returns the string argument as the tools read it, or the empty string if it is not set.
+func (t *ToolCall) StringArgument(name string) string {
+	return stringArg(t.arguments, name)
+}
+
+// BoolArgument returns the boolean argument as the tools read it, LLMs may pass booleans as strings.
+func (t *ToolCall) BoolArgument(name string) bool {
+	return boolArg(t.arguments, name)
+}
+
+// Classification returns the effect of the tool call on the cluster, as verified from the command line.
+// Tools without a command are read-only if they implement ReadOnlyTool, otherwise
+// they are Unknown, as are commands which could not be parsed.
+func (t *ToolCall) Classification() Classification {
+	if t.command == nil {
+		if tool, ok := t.tool.(ReadOnlyTool); ok && tool.ReadOnly() {
+			return ReadOnly
+		}
+		return Unknown
+	}
+	return t.command.Classification()
+}
+
+// ClaimedClassification returns the effect the LLM claimed in the "modifies_resource" argument.
+func (t *ToolCall) ClaimedClassification() Classification {
+	claim, _ := t.arguments["modifies_resource"].(string)
+	return ParseClassification(claim)
+}
+
+// ClassificationMismatch describes the disagreement between the verified classification
+// and the LLM's claim, it returns an empty string if they agree or the LLM did not claim anything.
+func (t *ToolCall) ClassificationMismatch() string {
+	claimed, verified := t.ClaimedClassification(), t.Classification()
+	switch {
+	case claimed == ReadOnly && verified != ReadOnly:
+		return fmt.Sprintf("the LLM claims the command does not modify resources, but it is %s", verified)
+	case claimed == Mutating && verified == ReadOnly:
+		return "the LLM claims the command modifies resources, but it is read-only"
+	}
+	return ""
 }
 
 func (t *ToolCall) PrettyPrint() string {
-	if command, ok := t.arguments["command"]; ok {
-		return command.(string)
+	if command, ok := t.arguments["command"].(string); ok && command != "" {
+		return command
 	}
 	var args []string
 	for k, v := range t.arguments {
@@ -95,17 +166,46 @@ func (t *Tools) ParseToolInvocation(ctx context.Context, name string, arguments
 		return nil, fmt.Errorf("tool %q not recognized", name)
 	}
 
-	return &ToolCall{
+	toolCall := &ToolCall{
 		tool:      tool,
 		name:      name,
 		arguments: arguments,
-	}, nil
+		id:        uuid.NewString(),
+	}
+
+	if command, ok := arguments["command"].(string); ok && command != "" {
+		parsed, err := ParseCommand(command)
+		if err != nil {
+			// the tool reports the error when it is run
+			klog.Warningf("error parsing command %q: %v", command, err)
+			return toolCall, nil
+		}
+		for _, stage := range parsed.Stages {
+			if stage.Kubectl != nil {
+				klog.V(1).Infof("tool %q runs %s", name, stage.Kubectl)
+			} else {
+				klog.V(1).Infof("tool %q runs %q", name, stage.Raw)
+			}
+		}
+		toolCall.command = parsed
+	}
+
+	return toolCall, nil
 }
 
 type InvokeToolOptions struct {
 	WorkDir string
 
 	Kubeconfig string
+
+	// KubeContext is the kube context commands run against unless they set --context.
+	KubeContext string
+
+	// Timeout bounds the execution of the tool, no timeout if zero.
+	Timeout time.Duration
+
+	// OnResponse is called with the response of the tool, e.g. to write it to the audit log.
+	OnResponse func(ToolResponseEvent)
 }
 
 type ToolRequestEvent struct {
@@ -118,25 +218,45 @@ type ToolResponseEvent struct {
 	CallID   string `json:"id,omitempty"`
 	Response any    `json:"response,omitempty"`
 	Error    string `json:"error,omitempty"`
+
+	// Duration is how long the tool ran.
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// RequestEvent describes the tool call.
+func (t *ToolCall) RequestEvent() ToolRequestEvent {
+	return ToolRequestEvent{
+		CallID:    t.id,
+		Name:      t.name,
+		Arguments: t.arguments,
+	}
 }
 
 // InvokeTool handles the execution of a single action
 func (t *ToolCall) InvokeTool(ctx context.Context, opt InvokeToolOptions) (any, error) {
-	callID := uuid.NewString()
-
 	ctx = context.WithValue(ctx, "kubeconfig", opt.Kubeconfig)
 	ctx = context.WithValue(ctx, "work_dir", opt.WorkDir)
+	ctx = context.WithValue(ctx, "kube_context", opt.KubeContext)
+	ctx = context.WithValue(ctx, "timeout", opt.Timeout)
+	if opt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opt.Timeout)
+		defer cancel()
+	}
 
+	start := time.Now()
 	response, err := t.tool.Run(ctx, t.arguments)
 
-	{
+	if opt.OnResponse != nil {
 		ev := ToolResponseEvent{
-			CallID:   callID,
+			CallID:   t.id,
 			Response: response,
+			Duration: time.Since(start),
 		}
 		if err != nil {
 			ev.Error = err.Error()
 		}
+		opt.OnResponse(ev)
 	}
 
 	return response, nil
@@ -0,0 +1,58 @@
+package tools
+
+import (
+	"context"
+	"testing"
+)
+
+// TestRunWithoutCommand checks that a call missing its command, e.g. malformed output of the model,
+// is reported to the model rather than crashing.
+func TestRunWithoutCommand(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "kubeconfig", "")
+	ctx = context.WithValue(ctx, "work_dir", t.TempDir())
+	for _, tool := range []Tool{&Kubectl{}, &BashTool{}} {
+		for _, args := range []map[string]any{
+			{"modifies_resource": "no"},
+			{"command": "", "modifies_resource": "no"},
+			{"command": 42},
+		} {
+			output, err := tool.Run(ctx, args)
+			if err != nil {
+				t.Fatalf("%s.Run(%v): %v", tool.Name(), args, err)
+			}
+			if r, ok := output.(*ExecResult); !ok || r == nil || r.Error == "" {
+				t.Errorf("%s.Run(%v) = %#v, want an error result", tool.Name(), args, output)
+			}
+		}
+	}
+}
+
+// TestSnapshottableNamespaceDeletes checks that deleting a namespace is not snapshotted, as the snapshot would
+// capture the Namespace object but not the objects deleted along with it.
+func TestSnapshottableNamespaceDeletes(t *testing.T) {
+	for _, tc := range []struct {
+		command          string
+		snapshottable    bool
+		deletesNamespace bool
+	}{
+		{command: "kubectl delete namespace prod", deletesNamespace: true},
+		{command: "kubectl delete ns/prod", deletesNamespace: true},
+		{command: "kubectl delete namespaces.v1 prod staging", deletesNamespace: true},
+		{command: "kubectl delete pod web -n prod", snapshottable: true},
+		{command: "kubectl create namespace prod", snapshottable: true},
+	} {
+		t.Run(tc.command, func(t *testing.T) {
+			toolset := Default()
+			call, err := toolset.ParseToolInvocation(context.Background(), "kubectl", map[string]any{"command": tc.command, "modifies_resource": "yes"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := call.Snapshottable(); got != tc.snapshottable {
+				t.Errorf("Snapshottable() = %v, want %v", got, tc.snapshottable)
+			}
+			if got := call.DeletesNamespaces(); got != tc.deletesNamespace {
+				t.Errorf("DeletesNamespaces() = %v, want %v", got, tc.deletesNamespace)
+			}
+		})
+	}
+}
@@ -80,6 +80,21 @@ type FunctionCallRequestBlock struct {
 
 	// text is populated if this is agent text output
 	text string
+
+	// warning is shown along with the request, e.g. when the LLM misreports the effect of a command
+	warning string
+
+	// call describes the requested call as structured data
+	call *ToolCall
+}
+
+// ToolCall describes a tool call requested by the LLM.
+type ToolCall struct {
+	ID             string         `json:"id,omitempty"`
+	Name           string         `json:"name"`
+	Arguments      map[string]any `json:"arguments,omitempty"`
+	Command        string         `json:"command,omitempty"`
+	Classification string         `json:"classification,omitempty"`
 }
 
 func NewFunctionCallRequestBlock() *FunctionCallRequestBlock {
@@ -104,6 +119,80 @@ func (b *FunctionCallRequestBlock) SetText(agentText string, streams genericioop
 	return b
 }
 
+func (b *FunctionCallRequestBlock) Warning() string {
+	return b.warning
+}
+
+func (b *FunctionCallRequestBlock) SetWarning(warning string, streams genericiooptions.IOStreams) *FunctionCallRequestBlock {
+	b.warning = warning
+	b.doc.blockChanged(b, streams)
+	return b
+}
+
+func (b *FunctionCallRequestBlock) Call() *ToolCall {
+	return b.call
+}
+
+func (b *FunctionCallRequestBlock) SetCall(call *ToolCall, streams genericiooptions.IOStreams) *FunctionCallRequestBlock {
+	b.call = call
+	b.doc.blockChanged(b, streams)
+	return b
+}
+
+// FunctionCallResultBlock is used to report the outcome of a function call, along with how it was approved.
+// The terminal does not render it, the notable parts of the outcome are rendered by the other blocks.
+type FunctionCallResultBlock struct {
+	doc *Document
+
+	call *ToolCall
+
+	// decision is how the call was decided: allowed, approved, denied or declined
+	decision string
+
+	// approval describes the decision, e.g. the policy rule which allowed the call
+	approval string
+
+	// result is the result of the call as sent to the LLM
+	result map[string]any
+}
+
+func NewFunctionCallResultBlock() *FunctionCallResultBlock {
+	return &FunctionCallResultBlock{}
+}
+
+func (b *FunctionCallResultBlock) attached(doc *Document) {
+	b.doc = doc
+}
+
+func (b *FunctionCallResultBlock) Document() *Document {
+	return b.doc
+}
+
+func (b *FunctionCallResultBlock) Call() *ToolCall {
+	return b.call
+}
+
+func (b *FunctionCallResultBlock) Decision() string {
+	return b.decision
+}
+
+func (b *FunctionCallResultBlock) Approval() string {
+	return b.approval
+}
+
+func (b *FunctionCallResultBlock) Result() map[string]any {
+	return b.result
+}
+
+func (b *FunctionCallResultBlock) SetResult(call *ToolCall, decision, approval string, result map[string]any, streams genericiooptions.IOStreams) *FunctionCallResultBlock {
+	b.call = call
+	b.decision = decision
+	b.approval = approval
+	b.result = result
+	b.doc.blockChanged(b, streams)
+	return b
+}
+
 // ErrorBlock is used to render an error condition
 type ErrorBlock struct {
 	doc *Document
@@ -134,6 +223,104 @@ func (b *ErrorBlock) SetText(agentText string, streams genericiooptions.IOStream
 	return b
 }
 
+// NoticeBlock is used to render a note about the conversation, e.g. what was redacted from tool output
+type NoticeBlock struct {
+	doc *Document
+
+	// text is the note
+	text string
+}
+
+func NewNoticeBlock() *NoticeBlock {
+	return &NoticeBlock{}
+}
+
+func (b *NoticeBlock) attached(doc *Document) {
+	b.doc = doc
+}
+
+func (b *NoticeBlock) Document() *Document {
+	return b.doc
+}
+
+func (b *NoticeBlock) Text() string {
+	return b.text
+}
+
+func (b *NoticeBlock) SetText(text string, streams genericiooptions.IOStreams) *NoticeBlock {
+	b.text = text
+	b.doc.blockChanged(b, streams)
+	return b
+}
+
+// StatusBlock is used to render a transient status, e.g. while waiting to retry a request; it is cleared by setting an empty text
+type StatusBlock struct {
+	doc *Document
+
+	// text is the status, empty once it no longer applies
+	text string
+}
+
+func NewStatusBlock() *StatusBlock {
+	return &StatusBlock{}
+}
+
+func (b *StatusBlock) attached(doc *Document) {
+	b.doc = doc
+}
+
+func (b *StatusBlock) Document() *Document {
+	return b.doc
+}
+
+func (b *StatusBlock) Text() string {
+	return b.text
+}
+
+func (b *StatusBlock) SetText(text string, streams genericiooptions.IOStreams) *StatusBlock {
+	b.text = text
+	b.doc.blockChanged(b, streams)
+	return b
+}
+
+// DiffBlock is used to render a unified diff, e.g. the expected effect of a command
+type DiffBlock struct {
+	doc *Document
+
+	// title describes what is being diffed
+	title string
+
+	// diff is the unified diff
+	diff string
+}
+
+func NewDiffBlock() *DiffBlock {
+	return &DiffBlock{}
+}
+
+func (b *DiffBlock) attached(doc *Document) {
+	b.doc = doc
+}
+
+func (b *DiffBlock) Document() *Document {
+	return b.doc
+}
+
+func (b *DiffBlock) Title() string {
+	return b.title
+}
+
+func (b *DiffBlock) Diff() string {
+	return b.diff
+}
+
+func (b *DiffBlock) SetDiff(title, diff string, streams genericiooptions.IOStreams) *DiffBlock {
+	b.title = title
+	b.diff = diff
+	b.doc.blockChanged(b, streams)
+	return b
+}
+
 // InputTextBlock is used to prompt for user input
 type InputTextBlock struct {
 	doc *Document
@@ -0,0 +1,118 @@
+package ui
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/client-go/util/homedir"
+)
+
+// DefaultHistoryFile is the history of the queries used unless configured otherwise.
+var DefaultHistoryFile = filepath.Join(homedir.HomeDir(), ".kubectl-interact", "history")
+
+// historySize is the number of entries kept in the history.
+const historySize = 1000
+
+// History is the list of the queries entered, oldest first. It is persisted to a file with an entry per line,
+// every entry is written as a JSON string so that multi-line queries fit on a line.
+type History struct {
+	// file is where the entries are persisted, they are only kept in memory if empty
+	file    string
+	entries []string
+}
+
+// LoadHistory reads the history from the file, which does not need to exist. Lines which can not be read are
+// skipped, and the file is compacted once it holds more than historySize entries.
+func LoadHistory(file string) (*History, error) {
+	h := &History{file: file}
+	if file == "" {
+		return h, nil
+	}
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return h, fmt.Errorf("reading history: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var entry string
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry == "" {
+			continue
+		}
+		h.entries = append(h.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return h, fmt.Errorf("reading history: %w", err)
+	}
+	if len(h.entries) > historySize {
+		h.entries = h.entries[len(h.entries)-historySize:]
+		if err := h.rewrite(); err != nil {
+			return h, err
+		}
+	}
+	return h, nil
+}
+
+// Entries returns the entries, oldest first.
+func (h *History) Entries() []string {
+	return h.entries
+}
+
+// Add appends the entry to the history, unless it is blank or repeats the last entry.
+func (h *History) Add(entry string) error {
+	if strings.TrimSpace(entry) == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry) {
+		return nil
+	}
+	h.entries = append(h.entries, entry)
+	if h.file == "" {
+		return nil
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(h.file), 0o700); err != nil {
+		return fmt.Errorf("writing history: %w", err)
+	}
+	// the queries may hold names of resources or secrets pasted by mistake, the history is private
+	f, err := os.OpenFile(h.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("writing history: %w", err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "%s\n", line); err != nil {
+		return fmt.Errorf("writing history: %w", err)
+	}
+	return nil
+}
+
+// rewrite replaces the file with the entries kept in memory.
+func (h *History) rewrite() error {
+	var sb strings.Builder
+	for _, entry := range h.entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		sb.Write(line)
+		sb.WriteString("\n")
+	}
+	tmp := h.file + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sb.String()), 0o600); err != nil {
+		return fmt.Errorf("compacting history: %w", err)
+	}
+	if err := os.Rename(tmp, h.file); err != nil {
+		return fmt.Errorf("compacting history: %w", err)
+	}
+	return nil
+}
@@ -27,9 +27,10 @@ type style struct {
 type ColorValue string
 
 const (
-	ColorGreen ColorValue = "green"
-	ColorWhite            = "white"
-	ColorRed              = "red"
+	ColorGreen  ColorValue = "green"
+	ColorWhite             = "white"
+	ColorRed               = "red"
+	ColorYellow            = "yellow"
 )
 
 type StyleOption func(s *style)
@@ -45,3 +46,10 @@ func RenderMarkdown() StyleOption {
 		s.renderMarkdown = true
 	}
 }
+
+// Completer completes the queries entered in the terminal.
+type Completer interface {
+	// Complete returns the completions of the word before the cursor, given the text of the line before it. The
+	// word is the text after the last space, and the completions replace it.
+	Complete(line string) []string
+}
@@ -0,0 +1,194 @@
+package ui
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/klog/v2"
+)
+
+// Event is a change of a block of the document, as emitted by JSONUI.
+type Event struct {
+	Time time.Time `json:"time"`
+
+	// Block is the index of the block in the document, the events of a block share it.
+	Block int `json:"block"`
+
+	// Type is the type of the block: agent-text, function-call-request, function-call-result, error, notice,
+	// status, diff, input-text or input-option.
+	Type string `json:"type"`
+
+	Text    string `json:"text,omitempty"`
+	Warning string `json:"warning,omitempty"`
+
+	// Streaming is true while the text of an agent-text block is streamed, JSONUI only emits the final text.
+	Streaming bool `json:"streaming,omitempty"`
+
+	// Title and Diff are set for diff blocks.
+	Title string `json:"title,omitempty"`
+	Diff  string `json:"diff,omitempty"`
+
+	// Prompt and Options are set for input-option blocks.
+	Prompt  string   `json:"prompt,omitempty"`
+	Options []string `json:"options,omitempty"`
+
+	// Input is the line read for input blocks, once it was read.
+	Input *string `json:"input,omitempty"`
+
+	// ToolCall is set for function call blocks, Decision, Approval and Result for function-call-result blocks.
+	ToolCall *ToolCall      `json:"toolCall,omitempty"`
+	Decision string         `json:"decision,omitempty"`
+	Approval string         `json:"approval,omitempty"`
+	Result   map[string]any `json:"result,omitempty"`
+}
+
+// JSONUI emits the changes of the blocks of the document as JSON events, so that other programs can drive the
+// conversation. In lines mode every event is written as a line as it happens, otherwise the events are written
+// as an array once the UI is closed, so only lines mode suits sessions waiting for input. The answers of the model are emitted once streamed, and the status blocks
+// are left out as they are transient.
+// Input blocks read a line of the input after emitting their event, e.g. the query or the number of the option.
+type JSONUI struct {
+	subscription io.Closer
+	streams      genericiooptions.IOStreams
+	lines        bool
+
+	mu     sync.Mutex
+	reader *bufio.Reader
+	events []*Event
+}
+
+var _ UI = &JSONUI{}
+
+func NewJSONUI(doc *Document, streams genericiooptions.IOStreams, lines bool) *JSONUI {
+	u := &JSONUI{streams: streams, lines: lines, reader: bufio.NewReader(streams.In)}
+	u.subscription = doc.AddSubscription(u)
+	return u
+}
+
+// Close stops listening to the document and writes the events, unless they were written as lines.
+func (u *JSONUI) Close() error {
+	if err := u.subscription.Close(); err != nil {
+		return err
+	}
+	if u.lines {
+		return nil
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	events := u.events
+	if events == nil {
+		events = []*Event{}
+	}
+	b, err := json.MarshalIndent(events, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(u.streams.Out, "%s\n", b)
+	return err
+}
+
+func (u *JSONUI) DocumentChanged(doc *Document, block Block, streams genericiooptions.IOStreams) {
+	event := newEvent(doc, block)
+	if event == nil || event.Streaming || event.Type == "status" {
+		return
+	}
+	u.emit(event)
+	switch block := block.(type) {
+	case *InputTextBlock:
+		u.readInput(event, block.Observable())
+	case *InputOptionBlock:
+		u.readInput(event, block.Observable())
+	}
+}
+
+// newEvent describes the current state of the block, it returns nil for the blocks which can not be described.
+func newEvent(doc *Document, block Block) *Event {
+	event := &Event{Block: doc.IndexOf(block)}
+	switch block := block.(type) {
+	case *AgentTextBlock:
+		event.Type = "agent-text"
+		event.Text = block.Text()
+		event.Streaming = block.Streaming()
+	case *FunctionCallRequestBlock:
+		event.Type = "function-call-request"
+		event.Text = strings.TrimSpace(block.Text())
+		event.Warning = block.Warning()
+		event.ToolCall = block.Call()
+	case *FunctionCallResultBlock:
+		event.Type = "function-call-result"
+		event.ToolCall = block.Call()
+		event.Decision = block.Decision()
+		event.Approval = block.Approval()
+		event.Result = block.Result()
+	case *ErrorBlock:
+		event.Type = "error"
+		event.Text = strings.TrimSpace(block.Text())
+	case *NoticeBlock:
+		event.Type = "notice"
+		event.Text = strings.TrimSpace(block.Text())
+	case *StatusBlock:
+		event.Type = "status"
+		event.Text = strings.TrimSpace(block.Text())
+	case *DiffBlock:
+		event.Type = "diff"
+		event.Title = block.Title()
+		event.Diff = block.Diff()
+	case *InputTextBlock:
+		event.Type = "input-text"
+	case *InputOptionBlock:
+		event.Type = "input-option"
+		event.Prompt = block.Prompt
+		event.Options = block.Options
+	default:
+		return nil
+	}
+	return event
+}
+
+// readInput reads a line of the input, emitting it along with the block which asked for it.
+// Lines which are not one of the options are reported as errors and read again.
+func (u *JSONUI) readInput(event *Event, observable *Observable[string]) {
+	for {
+		line, err := u.reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			observable.Set("", err)
+			return
+		}
+		line = strings.TrimSpace(line)
+		input := *event
+		input.Input = &line
+		u.emit(&input)
+		if event.Options != nil && !slices.Contains(event.Options, line) {
+			u.emit(&Event{Block: event.Block, Type: "error", Text: fmt.Sprintf("Invalid choice %q, enter one of: %s", line, strings.Join(event.Options, ", "))})
+			continue
+		}
+		observable.Set(line, nil)
+		return
+	}
+}
+
+func (u *JSONUI) emit(event *Event) {
+	event.Time = time.Now()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.lines {
+		u.events = append(u.events, event)
+		return
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		klog.Warningf("error marshaling event: %v", err)
+		return
+	}
+	fmt.Fprintf(u.streams.Out, "%s\n", b)
+}
+
+func (u *JSONUI) ClearScreen() {
+}
@@ -0,0 +1,664 @@
+package ui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+	"k8s.io/klog/v2"
+)
+
+// continuationPrompt prefixes the lines of a multi-line input after the first one.
+const continuationPrompt = "... "
+
+// key is a key press, once decoded from the bytes the terminal sends.
+type key int
+
+const (
+	keyUnknown key = iota
+	keyRune
+	keyPaste
+	keyEnter
+	keyNewline
+	keyTab
+	keyBackspace
+	keyDelete
+	keyLeft
+	keyRight
+	keyUp
+	keyDown
+	keyHome
+	keyEnd
+	keyWordLeft
+	keyWordRight
+	keyKillToEnd
+	keyKillToStart
+	keyKillWord
+	keySearch
+	keyCancel
+	keyInterrupt
+	keyEOF
+	keyClear
+	keyEscape
+)
+
+// keyPress is a key press along with the text it enters, for keyRune and keyPaste.
+type keyPress struct {
+	key  key
+	text string
+}
+
+// lineEditor reads lines from a terminal in raw mode, with the keys of the usual line editors: the arrows, Home,
+// End and their emacs equivalents move the cursor, Up and Down recall the history and Ctrl-R searches it.
+// Lines may span several lines: Alt-Enter or Ctrl-J insert a newline, so does Enter after a trailing backslash,
+// and pasted text is inserted as is, so that manifests can be pasted. Tab completes the word before the cursor.
+// The editor keeps reading the terminal through the same buffer, so that the keys typed ahead are not lost.
+type lineEditor struct {
+	fd     int
+	reader *bufio.Reader
+	out    io.Writer
+
+	// history is recalled and recorded, it is nil when reading something other than a query
+	history *History
+	// completer completes the words, it is nil when reading something other than a query
+	completer Completer
+
+	prompt string
+	buf    []rune
+	pos    int
+
+	// cursorRow is the row of the cursor, relative to the row of the prompt, as last rendered
+	cursorRow int
+
+	// historyIndex is the entry of the history recalled, the number of entries for the line being entered
+	historyIndex int
+	// draft is the line being entered while the history is recalled
+	draft []rune
+
+	searching    bool
+	searchQuery  []rune
+	searchFailed bool
+	// searchIndex is the entry of the history matching the search query
+	searchIndex int
+}
+
+func newLineEditor(in *os.File, out io.Writer) *lineEditor {
+	return &lineEditor{fd: int(in.Fd()), reader: bufio.NewReader(in), out: out}
+}
+
+// ReadLine reads a line, recalling and recording it in the history and completing its words unless they are nil.
+// The line is returned without its trailing newline, io.EOF is returned once Ctrl-D or Ctrl-C is hit on an empty
+// line.
+func (e *lineEditor) ReadLine(prompt string, history *History, completer Completer) (string, error) {
+	state, err := term.MakeRaw(e.fd)
+	if err != nil {
+		return "", fmt.Errorf("setting the terminal to raw mode: %w", err)
+	}
+	defer term.Restore(e.fd, state)
+	// bracketed paste mode tells the pasted text apart from the typed keys, so that pasted newlines do not submit
+	fmt.Fprint(e.out, "\033[?2004h")
+	defer fmt.Fprint(e.out, "\033[?2004l")
+
+	e.prompt, e.history, e.completer = prompt, history, completer
+	e.buf, e.pos, e.cursorRow, e.draft = nil, 0, 0, nil
+	e.historyIndex = len(e.historyEntries())
+	e.searching = false
+	e.render()
+
+	for {
+		k, err := e.readKey()
+		if err != nil {
+			fmt.Fprint(e.out, "\r\n")
+			return "", err
+		}
+		if e.searching && e.search(k) {
+			e.render()
+			continue
+		}
+		done, err := e.edit(k)
+		if err != nil {
+			e.pos = len(e.buf)
+			e.render()
+			fmt.Fprint(e.out, "\r\n")
+			return "", err
+		}
+		if done {
+			break
+		}
+		e.render()
+	}
+
+	e.pos = len(e.buf)
+	e.render()
+	fmt.Fprint(e.out, "\r\n")
+	line := string(e.buf)
+	if e.history != nil {
+		if err := e.history.Add(line); err != nil {
+			klog.Warningf("error recording the history: %v", err)
+		}
+	}
+	return line, nil
+}
+
+func (e *lineEditor) historyEntries() []string {
+	if e.history == nil {
+		return nil
+	}
+	return e.history.Entries()
+}
+
+// edit applies the key to the line, it returns true once the line is entered.
+func (e *lineEditor) edit(k keyPress) (bool, error) {
+	switch k.key {
+	case keyRune, keyPaste:
+		e.insert(k.text)
+	case keyEnter:
+		switch {
+		case e.reader.Buffered() > 0:
+			// more input came along with the newline, it is pasted by a terminal without bracketed paste mode
+			e.insert("\n")
+		case e.pos == len(e.buf) && len(e.buf) > 0 && e.buf[len(e.buf)-1] == '\\':
+			e.buf[len(e.buf)-1] = '\n'
+		default:
+			return true, nil
+		}
+	case keyNewline:
+		e.insert("\n")
+	case keyTab:
+		e.complete()
+	case keyBackspace:
+		if e.pos > 0 {
+			e.buf = slices.Delete(e.buf, e.pos-1, e.pos)
+			e.pos--
+		}
+	case keyEOF:
+		if len(e.buf) == 0 {
+			return false, io.EOF
+		}
+		fallthrough
+	case keyDelete:
+		if e.pos < len(e.buf) {
+			e.buf = slices.Delete(e.buf, e.pos, e.pos+1)
+		}
+	case keyInterrupt:
+		if len(e.buf) == 0 {
+			return false, io.EOF
+		}
+		// the line is discarded and entered again, as shells do
+		e.pos = len(e.buf)
+		e.render()
+		fmt.Fprint(e.out, "^C\r\n")
+		e.buf, e.pos, e.cursorRow = nil, 0, 0
+		e.historyIndex = len(e.historyEntries())
+	case keyLeft:
+		if e.pos > 0 {
+			e.pos--
+		}
+	case keyRight:
+		if e.pos < len(e.buf) {
+			e.pos++
+		}
+	case keyHome:
+		e.pos = e.lineStart(e.pos)
+	case keyEnd:
+		e.pos = e.lineEnd(e.pos)
+	case keyWordLeft:
+		e.pos = e.wordStart(e.pos)
+	case keyWordRight:
+		for e.pos < len(e.buf) && unicode.IsSpace(e.buf[e.pos]) {
+			e.pos++
+		}
+		for e.pos < len(e.buf) && !unicode.IsSpace(e.buf[e.pos]) {
+			e.pos++
+		}
+	case keyKillToEnd:
+		e.buf = slices.Delete(e.buf, e.pos, e.lineEnd(e.pos))
+	case keyKillToStart:
+		start := e.lineStart(e.pos)
+		e.buf = slices.Delete(e.buf, start, e.pos)
+		e.pos = start
+	case keyKillWord:
+		start := e.wordStart(e.pos)
+		e.buf = slices.Delete(e.buf, start, e.pos)
+		e.pos = start
+	case keyUp:
+		if start := e.lineStart(e.pos); start > 0 {
+			e.moveToLine(e.lineStart(start-1), e.pos-start)
+		} else {
+			e.recall(e.historyIndex - 1)
+		}
+	case keyDown:
+		if end := e.lineEnd(e.pos); end < len(e.buf) {
+			e.moveToLine(end+1, e.pos-e.lineStart(e.pos))
+		} else {
+			e.recall(e.historyIndex + 1)
+		}
+	case keySearch:
+		if e.history != nil {
+			e.searching, e.searchQuery, e.searchFailed = true, nil, false
+			e.searchIndex = len(e.historyEntries())
+			e.draft = slices.Clone(e.buf)
+		}
+	case keyClear:
+		fmt.Fprint(e.out, "\033[H\033[2J")
+		e.cursorRow = 0
+	}
+	return false, nil
+}
+
+// insert inserts the text at the cursor, the carriage returns of pasted text become newlines and the tabs
+// become spaces, as the other control characters can not be rendered.
+func (e *lineEditor) insert(text string) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = strings.ReplaceAll(text, "\t", "    ")
+	runes := []rune(strings.Map(func(r rune) rune {
+		if r != '\n' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text))
+	e.buf = slices.Insert(e.buf, e.pos, runes...)
+	e.pos += len(runes)
+}
+
+// complete replaces the word before the cursor with its completion, or with the prefix its completions share.
+// The completions are listed below the line if they do not share more than the word.
+func (e *lineEditor) complete() {
+	if e.completer == nil {
+		return
+	}
+	start := e.pos
+	for start > 0 && !unicode.IsSpace(e.buf[start-1]) {
+		start--
+	}
+	word := string(e.buf[start:e.pos])
+	var completions []string
+	for _, c := range e.completer.Complete(string(e.buf[:e.pos])) {
+		if strings.HasPrefix(c, word) && !slices.Contains(completions, c) {
+			completions = append(completions, c)
+		}
+	}
+
+	replace := func(text string) {
+		e.buf = slices.Delete(e.buf, start, e.pos)
+		e.pos = start
+		e.insert(text)
+	}
+	switch {
+	case len(completions) == 0:
+		fmt.Fprint(e.out, "\a")
+	case len(completions) == 1:
+		completion := completions[0]
+		// the names of kind/name completions are completed next
+		if !strings.HasSuffix(completion, "/") && (e.pos == len(e.buf) || !unicode.IsSpace(e.buf[e.pos])) {
+			completion += " "
+		}
+		replace(completion)
+	default:
+		if prefix := commonPrefix(completions); len(prefix) > len(word) {
+			replace(prefix)
+			return
+		}
+		e.listCompletions(completions)
+	}
+}
+
+// maxListedCompletions bounds the number of completions listed.
+const maxListedCompletions = 100
+
+// listCompletions lists the completions in columns below the line, the line is rendered again below them.
+func (e *lineEditor) listCompletions(completions []string) {
+	width, _, err := term.GetSize(e.fd)
+	if err != nil || width <= 0 {
+		width = 80
+	}
+	slices.Sort(completions)
+	more := len(completions) - maxListedCompletions
+	if more > 0 {
+		completions = completions[:maxListedCompletions]
+	}
+	columnWidth := 0
+	for _, c := range completions {
+		columnWidth = max(columnWidth, runewidth.StringWidth(c)+2)
+	}
+	columns := max(1, width/columnWidth)
+
+	pos := e.pos
+	e.pos = len(e.buf)
+	e.render()
+	e.pos = pos
+
+	var sb strings.Builder
+	sb.WriteString("\r\n")
+	for i, c := range completions {
+		if i > 0 && i%columns == 0 {
+			sb.WriteString("\r\n")
+		}
+		sb.WriteString(runewidth.FillRight(c, columnWidth))
+	}
+	sb.WriteString("\r\n")
+	if more > 0 {
+		fmt.Fprintf(&sb, "... and %d more\r\n", more)
+	}
+	fmt.Fprint(e.out, sb.String())
+	e.cursorRow = 0
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+// lineStart returns the start of the line of the position, lines being separated by newlines.
+func (e *lineEditor) lineStart(pos int) int {
+	for pos > 0 && e.buf[pos-1] != '\n' {
+		pos--
+	}
+	return pos
+}
+
+// lineEnd returns the end of the line of the position, before its newline.
+func (e *lineEditor) lineEnd(pos int) int {
+	for pos < len(e.buf) && e.buf[pos] != '\n' {
+		pos++
+	}
+	return pos
+}
+
+func (e *lineEditor) wordStart(pos int) int {
+	for pos > 0 && unicode.IsSpace(e.buf[pos-1]) {
+		pos--
+	}
+	for pos > 0 && !unicode.IsSpace(e.buf[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+// moveToLine moves the cursor to the column of the line starting at start, or to its end if it is shorter.
+func (e *lineEditor) moveToLine(start, column int) {
+	e.pos = min(start+column, e.lineEnd(start))
+}
+
+// recall replaces the line with the entry of the history, the line being entered is kept aside meanwhile.
+func (e *lineEditor) recall(index int) {
+	entries := e.historyEntries()
+	if index < 0 || index > len(entries) || index == e.historyIndex {
+		return
+	}
+	if e.historyIndex == len(entries) {
+		e.draft = slices.Clone(e.buf)
+	}
+	e.historyIndex = index
+	if index == len(entries) {
+		e.buf = slices.Clone(e.draft)
+	} else {
+		e.buf = []rune(entries[index])
+	}
+	e.pos = len(e.buf)
+}
+
+// search applies the key to the reverse search of the history, it returns false if the key ends the search
+// and is to be applied to the line found.
+func (e *lineEditor) search(k keyPress) bool {
+	switch k.key {
+	case keyRune, keyPaste:
+		e.searchQuery = append(e.searchQuery, []rune(k.text)...)
+		e.find(e.searchIndex)
+	case keySearch:
+		e.find(e.searchIndex - 1)
+	case keyBackspace:
+		if len(e.searchQuery) > 0 {
+			e.searchQuery = e.searchQuery[:len(e.searchQuery)-1]
+			e.find(len(e.historyEntries()) - 1)
+		}
+	case keyCancel, keyEscape, keyInterrupt:
+		e.searching = false
+		e.buf, e.pos = e.draft, len(e.draft)
+	default:
+		e.searching = false
+		if e.searchIndex < len(e.historyEntries()) {
+			e.historyIndex = e.searchIndex
+		}
+		return false
+	}
+	return true
+}
+
+// find shows the most recent entry of the history matching the search query, starting from the entry at from.
+func (e *lineEditor) find(from int) {
+	entries := e.historyEntries()
+	query := string(e.searchQuery)
+	if query == "" {
+		e.searchIndex, e.searchFailed = len(entries), false
+		e.buf, e.pos = slices.Clone(e.draft), len(e.draft)
+		return
+	}
+	for i := min(from, len(entries)-1); i >= 0; i-- {
+		if at := strings.LastIndex(entries[i], query); at >= 0 {
+			e.searchIndex, e.searchFailed = i, false
+			e.buf, e.pos = []rune(entries[i]), len([]rune(entries[i][:at]))
+			return
+		}
+	}
+	e.searchFailed = true
+}
+
+// render redraws the prompt and the line, and places the cursor. The rows the line wraps to are tracked so that
+// the cursor can be moved back to the prompt on the next render.
+func (e *lineEditor) render() {
+	width, _, err := term.GetSize(e.fd)
+	if err != nil || width <= 0 {
+		width = 80
+	}
+	prompt := e.prompt
+	if e.searching {
+		failed := ""
+		if e.searchFailed {
+			failed = "failing "
+		}
+		prompt = fmt.Sprintf("(%sreverse-i-search)`%s': ", failed, string(e.searchQuery))
+	}
+
+	var sb strings.Builder
+	if e.cursorRow > 0 {
+		fmt.Fprintf(&sb, "\033[%dA", e.cursorRow)
+	}
+	sb.WriteString("\r\033[J")
+
+	// row and col are where the next rune goes, pending is set once a rune filled the last column of the row as
+	// terminals only wrap when writing the next rune
+	row, col, pending := 0, 0, false
+	write := func(r rune) {
+		w := runewidth.RuneWidth(r)
+		if col+w > width {
+			row, col = row+1, 0
+		}
+		sb.WriteRune(r)
+		col += w
+		pending = col >= width
+		if pending {
+			row, col = row+1, 0
+		}
+	}
+	for _, r := range prompt {
+		write(r)
+	}
+	cursorRow, cursorCol := row, col
+	for i, r := range e.buf {
+		if r == '\n' {
+			sb.WriteString("\r\n")
+			if !pending {
+				row++
+			}
+			col, pending = 0, false
+			for _, r := range continuationPrompt {
+				write(r)
+			}
+		} else {
+			write(r)
+		}
+		if i+1 == e.pos {
+			cursorRow, cursorCol = row, col
+		}
+	}
+	if pending {
+		sb.WriteString("\r\n")
+	}
+
+	if up := row - cursorRow; up > 0 {
+		fmt.Fprintf(&sb, "\033[%dA", up)
+	}
+	sb.WriteString("\r")
+	if cursorCol > 0 {
+		fmt.Fprintf(&sb, "\033[%dC", cursorCol)
+	}
+	e.cursorRow = cursorRow
+	fmt.Fprint(e.out, sb.String())
+}
+
+// readKey reads and decodes the next key press.
+func (e *lineEditor) readKey() (keyPress, error) {
+	r, _, err := e.reader.ReadRune()
+	if err != nil {
+		return keyPress{}, err
+	}
+	switch r {
+	case '\r':
+		return keyPress{key: keyEnter}, nil
+	case '\n':
+		return keyPress{key: keyNewline}, nil
+	case '\t':
+		return keyPress{key: keyTab}, nil
+	case 0x01:
+		return keyPress{key: keyHome}, nil
+	case 0x02:
+		return keyPress{key: keyLeft}, nil
+	case 0x03:
+		return keyPress{key: keyInterrupt}, nil
+	case 0x04:
+		return keyPress{key: keyEOF}, nil
+	case 0x05:
+		return keyPress{key: keyEnd}, nil
+	case 0x06:
+		return keyPress{key: keyRight}, nil
+	case 0x07:
+		return keyPress{key: keyCancel}, nil
+	case 0x08, 0x7f:
+		return keyPress{key: keyBackspace}, nil
+	case 0x0b:
+		return keyPress{key: keyKillToEnd}, nil
+	case 0x0c:
+		return keyPress{key: keyClear}, nil
+	case 0x0e:
+		return keyPress{key: keyDown}, nil
+	case 0x10:
+		return keyPress{key: keyUp}, nil
+	case 0x12:
+		return keyPress{key: keySearch}, nil
+	case 0x15:
+		return keyPress{key: keyKillToStart}, nil
+	case 0x17:
+		return keyPress{key: keyKillWord}, nil
+	case 0x1b:
+		return e.readEscape()
+	}
+	if unicode.IsControl(r) {
+		return keyPress{key: keyUnknown}, nil
+	}
+	return keyPress{key: keyRune, text: string(r)}, nil
+}
+
+// readEscape decodes the escape sequences of the special keys, the sequences arrive at once so an escape
+// without anything buffered after it is the Escape key.
+func (e *lineEditor) readEscape() (keyPress, error) {
+	if e.reader.Buffered() == 0 {
+		return keyPress{key: keyEscape}, nil
+	}
+	r, _, err := e.reader.ReadRune()
+	if err != nil {
+		return keyPress{}, err
+	}
+	switch r {
+	case '\r', '\n':
+		return keyPress{key: keyNewline}, nil
+	case 'b':
+		return keyPress{key: keyWordLeft}, nil
+	case 'f':
+		return keyPress{key: keyWordRight}, nil
+	case 0x08, 0x7f:
+		return keyPress{key: keyKillWord}, nil
+	case 'O':
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return keyPress{}, err
+		}
+		return keyPress{key: csiKeys[string(r)]}, nil
+	case '[':
+		var seq strings.Builder
+		for {
+			r, _, err := e.reader.ReadRune()
+			if err != nil {
+				return keyPress{}, err
+			}
+			seq.WriteRune(r)
+			if r >= 0x40 && r <= 0x7e {
+				break
+			}
+		}
+		if seq.String() == "200~" {
+			return e.readPaste()
+		}
+		return keyPress{key: csiKeys[seq.String()]}, nil
+	}
+	return keyPress{key: keyUnknown}, nil
+}
+
+// csiKeys are the keys of the escape sequences, by the sequence following the escape and the bracket.
+var csiKeys = map[string]key{
+	"A":    keyUp,
+	"B":    keyDown,
+	"C":    keyRight,
+	"D":    keyLeft,
+	"H":    keyHome,
+	"F":    keyEnd,
+	"1~":   keyHome,
+	"7~":   keyHome,
+	"4~":   keyEnd,
+	"8~":   keyEnd,
+	"3~":   keyDelete,
+	"1;5C": keyWordRight,
+	"1;3C": keyWordRight,
+	"1;5D": keyWordLeft,
+	"1;3D": keyWordLeft,
+}
+
+// readPaste reads the text pasted in bracketed paste mode, up to the sequence ending it.
+func (e *lineEditor) readPaste() (keyPress, error) {
+	const end = "\033[201~"
+	var text strings.Builder
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return keyPress{}, err
+		}
+		text.WriteRune(r)
+		if r == '~' && strings.HasSuffix(text.String(), end) {
+			return keyPress{key: keyPaste, text: strings.TrimSuffix(text.String(), end)}, nil
+		}
+	}
+}
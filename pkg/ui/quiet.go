@@ -0,0 +1,57 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+)
+
+// QuietUI renders the answers of the model as plain text, and the errors to the error stream. Everything else,
+// such as the tool calls and the notices, is left out so that the output can be consumed by scripts.
+// There is no one to answer the questions, input blocks read the end of the input.
+type QuietUI struct {
+	subscription io.Closer
+
+	// streamed are the answers of the model, they are rendered once their streaming ended
+	streamed map[*AgentTextBlock]bool
+}
+
+var _ UI = &QuietUI{}
+
+func NewQuietUI(doc *Document) *QuietUI {
+	u := &QuietUI{streamed: map[*AgentTextBlock]bool{}}
+	u.subscription = doc.AddSubscription(u)
+	return u
+}
+
+func (u *QuietUI) Close() error {
+	return u.subscription.Close()
+}
+
+func (u *QuietUI) DocumentChanged(doc *Document, block Block, streams genericiooptions.IOStreams) {
+	switch block := block.(type) {
+	case *AgentTextBlock:
+		// the answers of the model are streamed, the other texts are notes of kubectl interact
+		if block.Streaming() {
+			u.streamed[block] = true
+			return
+		}
+		if u.streamed[block] {
+			delete(u.streamed, block)
+			if text := strings.TrimSpace(block.Text()); text != "" {
+				fmt.Fprintln(streams.Out, text)
+			}
+		}
+	case *ErrorBlock:
+		fmt.Fprint(streams.ErrOut, block.Text())
+	case *InputTextBlock:
+		block.Observable().Set("", io.EOF)
+	case *InputOptionBlock:
+		block.Observable().Set("", io.EOF)
+	}
+}
+
+func (u *QuietUI) ClearScreen() {
+}
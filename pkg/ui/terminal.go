@@ -21,10 +21,12 @@ import (
 	"fmt"
 	"io"
 	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"os"
 	"slices"
 	"strings"
 
 	"github.com/charmbracelet/glamour"
+	"golang.org/x/term"
 	"k8s.io/klog/v2"
 )
 
@@ -37,11 +39,23 @@ type TerminalUI struct {
 	currentBlock Block
 	// currentBlockText is text of the currentBlock that we have already rendered to the screen
 	currentBlockText string
+
+	// history is the history of the queries, recalled by the line editor
+	history *History
+	// completer completes the queries in the line editor
+	completer Completer
+
+	// editor reads the input if it is a terminal, reader reads it otherwise. Either is kept across the reads so
+	// that the input buffered by a read is not lost.
+	editor *lineEditor
+	reader *bufio.Reader
 }
 
 var _ UI = &TerminalUI{}
 
-func NewTerminalUI(doc *Document) (*TerminalUI, error) {
+// NewTerminalUI renders the document to the terminal. The queries are recorded in the history and completed by
+// the completer, either may be nil.
+func NewTerminalUI(doc *Document, history *History, completer Completer) (*TerminalUI, error) {
 	mdRenderer, err := glamour.NewTermRenderer(
 		glamour.WithAutoStyle(),
 		glamour.WithPreservedNewLines(),
@@ -50,7 +64,7 @@ func NewTerminalUI(doc *Document) (*TerminalUI, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error initializing the markdown renderer: %w", err)
 	}
-	u := &TerminalUI{markdownRenderer: mdRenderer}
+	u := &TerminalUI{markdownRenderer: mdRenderer, history: history, completer: completer}
 
 	subscription := doc.AddSubscription(u)
 	u.subscription = subscription
@@ -78,6 +92,14 @@ func (u *TerminalUI) DocumentChanged(doc *Document, block Block, streams generic
 		return
 	}
 
+	if status, ok := block.(*StatusBlock); ok {
+		u.renderStatus(status)
+		return
+	}
+	if _, ok := block.(*FunctionCallResultBlock); ok {
+		return
+	}
+
 	if u.currentBlock != block {
 		u.currentBlock = block
 		if u.currentBlockText != "" {
@@ -97,6 +119,14 @@ func (u *TerminalUI) DocumentChanged(doc *Document, block Block, streams generic
 	case *FunctionCallRequestBlock:
 		styleOptions = append(styleOptions, Foreground(ColorGreen))
 		text = block.Text()
+		if block.Warning() != "" {
+			text += fmt.Sprintf("  Warning: %s\n", block.Warning())
+		}
+	case *NoticeBlock:
+		styleOptions = append(styleOptions, Foreground(ColorYellow))
+		text = block.Text()
+	case *DiffBlock:
+		text = colorDiff(block.Title(), block.Diff())
 	case *AgentTextBlock:
 		styleOptions = append(styleOptions, RenderMarkdown())
 		if block.Color != "" {
@@ -105,10 +135,8 @@ func (u *TerminalUI) DocumentChanged(doc *Document, block Block, streams generic
 		text = block.Text()
 		streaming = block.Streaming()
 	case *InputTextBlock:
-		fmt.Print("\n>>> ")
-		var reader *bufio.Reader
-		reader = bufio.NewReader(streams.In)
-		query, err := reader.ReadString('\n')
+		fmt.Print("\n")
+		query, err := u.readLine(streams.In, ">>> ", u.history, u.completer)
 		if err != nil {
 			block.Observable().Set("", err)
 		} else {
@@ -118,13 +146,9 @@ func (u *TerminalUI) DocumentChanged(doc *Document, block Block, streams generic
 
 	case *InputOptionBlock:
 		fmt.Printf("%s\n", block.Prompt)
-		var reader *bufio.Reader
-		reader = bufio.NewReader(streams.In)
 
 		for {
-			fmt.Print("  Enter your choice (number): ")
-			var response string
-			response, err := reader.ReadString('\n')
+			response, err := u.readLine(streams.In, "  Enter your choice (number): ", nil, nil)
 			if err != nil {
 				block.Observable().Set("", err)
 				break
@@ -186,6 +210,9 @@ func (u *TerminalUI) DocumentChanged(doc *Document, block Block, streams generic
 	case ColorWhite:
 		fmt.Printf("\033[37m")
 		reset += "\033[0m"
+	case ColorYellow:
+		fmt.Printf("\033[33m")
+		reset += "\033[0m"
 
 	case "":
 	default:
@@ -195,6 +222,37 @@ func (u *TerminalUI) DocumentChanged(doc *Document, block Block, streams generic
 	fmt.Printf("%s%s", printText, reset)
 }
 
+// readLine reads a line of the input, with the line editor if the input is a terminal.
+func (u *TerminalUI) readLine(in io.Reader, prompt string, history *History, completer Completer) (string, error) {
+	if u.editor == nil && u.reader == nil {
+		if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+			u.editor = newLineEditor(f, os.Stdout)
+		} else {
+			u.reader = bufio.NewReader(in)
+		}
+	}
+	if u.editor != nil {
+		return u.editor.ReadLine(prompt, history, completer)
+	}
+	fmt.Print(prompt)
+	return u.reader.ReadString('\n')
+}
+
+// renderStatus overwrites the current line with the status, so that it disappears once cleared.
+func (u *TerminalUI) renderStatus(block *StatusBlock) {
+	if u.currentBlock != block {
+		u.currentBlock = block
+		if u.currentBlockText != "" {
+			fmt.Printf("\n")
+		}
+	}
+	u.currentBlockText = block.Text()
+	fmt.Print("\r\033[K")
+	if text := strings.TrimSuffix(block.Text(), "\n"); text != "" {
+		fmt.Printf("\033[33m%s\033[0m", text)
+	}
+}
+
 func (u *TerminalUI) RenderOutput(ctx context.Context, s string, styleOptions ...StyleOption) {
 	log := klog.FromContext(ctx)
 
@@ -222,6 +280,9 @@ func (u *TerminalUI) RenderOutput(ctx context.Context, s string, styleOptions ..
 	case ColorWhite:
 		fmt.Printf("\033[37m")
 		reset += "\033[0m"
+	case ColorYellow:
+		fmt.Printf("\033[33m")
+		reset += "\033[0m"
 
 	case "":
 	default:
@@ -234,3 +295,27 @@ func (u *TerminalUI) RenderOutput(ctx context.Context, s string, styleOptions ..
 func (u *TerminalUI) ClearScreen() {
 	fmt.Print("\033[H\033[2J")
 }
+
+// colorDiff colors the lines of a unified diff, removals in red and additions in green.
+func colorDiff(title, diff string) string {
+	var sb strings.Builder
+	sb.WriteString("  " + title + "\n")
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if line == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"), strings.HasPrefix(line, "diff "):
+			sb.WriteString("\033[1m" + line + "\033[0m")
+		case strings.HasPrefix(line, "@@"):
+			sb.WriteString("\033[36m" + line + "\033[0m")
+		case strings.HasPrefix(line, "+"):
+			sb.WriteString("\033[32m" + line + "\033[0m")
+		case strings.HasPrefix(line, "-"):
+			sb.WriteString("\033[31m" + line + "\033[0m")
+		default:
+			sb.WriteString(line)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,249 @@
+package ui
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/klog/v2"
+)
+
+//go:embed web/index.html
+var webPage []byte
+
+// webWriteTimeout bounds the time to send an event to a browser, slow browsers are disconnected.
+const webWriteTimeout = 10 * time.Second
+
+// WebUI serves the conversation to browsers. The changes of the blocks are streamed over a websocket as the
+// events JSONUI emits, and the browsers answer the input blocks, e.g. the queries and the confirmations.
+// Browsers connecting late, or reconnecting, receive the current state of every block first.
+// The page and the websocket require the token of the URL, as any local user could connect otherwise.
+type WebUI struct {
+	subscription io.Closer
+	server       *http.Server
+	url          string
+	token        string
+	upgrader     websocket.Upgrader
+
+	mu sync.Mutex
+
+	// events is the latest event of every block, by block index
+	events []*Event
+
+	// cleared is the number of blocks the browsers connecting later do not receive, as the screen was cleared
+	cleared int
+
+	// inputs are the input blocks waiting for an answer, by block index
+	inputs map[int]*webInput
+
+	clients map[*webClient]bool
+}
+
+var _ UI = &WebUI{}
+
+// webInput is an input block waiting for an answer of a browser.
+type webInput struct {
+	observable *Observable[string]
+
+	// options are the valid answers, any answer is valid if nil
+	options []string
+}
+
+// webClient is a browser connected to the websocket.
+type webClient struct {
+	conn *websocket.Conn
+
+	// mu serializes the writes, websockets support a single writer
+	mu sync.Mutex
+}
+
+// webAnswer is the answer of a browser to an input block.
+type webAnswer struct {
+	Block int    `json:"block"`
+	Input string `json:"input"`
+}
+
+// NewWebUI listens on the given address and serves the conversation of the document.
+func NewWebUI(doc *Document, listen string) (*WebUI, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("generating the token of the web UI: %w", err)
+	}
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, fmt.Errorf("listening on %s: %w", listen, err)
+	}
+	u := &WebUI{
+		token:   hex.EncodeToString(token),
+		inputs:  map[int]*webInput{},
+		clients: map[*webClient]bool{},
+	}
+	u.url = fmt.Sprintf("http://%s/?token=%s", listener.Addr(), u.token)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", u.servePage)
+	mux.HandleFunc("GET /ws", u.serveWebsocket)
+	u.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := u.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			klog.Errorf("web UI server failed: %v", err)
+		}
+	}()
+
+	u.subscription = doc.AddSubscription(u)
+	return u, nil
+}
+
+// URL returns the URL of the page, along with its token.
+func (u *WebUI) URL() string {
+	return u.url
+}
+
+// Close stops listening to the document and shuts the server down, disconnecting the browsers.
+func (u *WebUI) Close() error {
+	err := u.subscription.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	u.mu.Lock()
+	for client := range u.clients {
+		client.conn.Close()
+	}
+	u.mu.Unlock()
+	return errors.Join(err, u.server.Shutdown(ctx))
+}
+
+func (u *WebUI) authorized(r *http.Request) bool {
+	return subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(u.token)) == 1
+}
+
+func (u *WebUI) servePage(w http.ResponseWriter, r *http.Request) {
+	if !u.authorized(r) {
+		http.Error(w, "the token of the URL is missing or invalid", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'")
+	w.Write(webPage)
+}
+
+// serveWebsocket sends the current state of the blocks, then streams their changes and reads the answers.
+func (u *WebUI) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	if !u.authorized(r) {
+		http.Error(w, "the token of the URL is missing or invalid", http.StatusUnauthorized)
+		return
+	}
+	// the upgrader rejects the requests of other origins, so that other pages can not drive the conversation
+	conn, err := u.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		klog.V(1).Infof("error upgrading to websocket: %v", err)
+		return
+	}
+	client := &webClient{conn: conn}
+
+	u.mu.Lock()
+	for _, event := range u.events[u.cleared:] {
+		if event != nil {
+			client.send(event)
+		}
+	}
+	u.clients[client] = true
+	u.mu.Unlock()
+
+	defer func() {
+		u.mu.Lock()
+		delete(u.clients, client)
+		u.mu.Unlock()
+		conn.Close()
+	}()
+	for {
+		var answer webAnswer
+		if err := conn.ReadJSON(&answer); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				klog.V(1).Infof("error reading from websocket: %v", err)
+			}
+			return
+		}
+		u.answer(answer)
+	}
+}
+
+// answer sets the answer of a browser to the input block it is for, ignoring the answers to blocks which were
+// answered already, e.g. by another browser.
+func (u *WebUI) answer(answer webAnswer) {
+	u.mu.Lock()
+	input, ok := u.inputs[answer.Block]
+	if !ok || (input.options != nil && !slices.Contains(input.options, answer.Input)) {
+		u.mu.Unlock()
+		klog.V(1).Infof("ignoring answer %q to block %d", answer.Input, answer.Block)
+		return
+	}
+	delete(u.inputs, answer.Block)
+	event := *u.events[answer.Block]
+	event.Input = &answer.Input
+	u.broadcastLocked(&event)
+	u.mu.Unlock()
+
+	input.observable.Set(answer.Input, nil)
+}
+
+func (u *WebUI) DocumentChanged(doc *Document, block Block, streams genericiooptions.IOStreams) {
+	event := newEvent(doc, block)
+	if event == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	switch block := block.(type) {
+	case *InputTextBlock:
+		u.inputs[event.Block] = &webInput{observable: block.Observable()}
+	case *InputOptionBlock:
+		u.inputs[event.Block] = &webInput{observable: block.Observable(), options: block.Options}
+	}
+	u.broadcastLocked(event)
+}
+
+// broadcastLocked records the event as the latest of its block and sends it to the browsers, it must be called
+// with the lock held.
+func (u *WebUI) broadcastLocked(event *Event) {
+	event.Time = time.Now()
+	for len(u.events) <= event.Block {
+		u.events = append(u.events, nil)
+	}
+	u.events[event.Block] = event
+	for client := range u.clients {
+		client.send(event)
+	}
+}
+
+func (c *webClient) send(event *Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(webWriteTimeout))
+	if err := c.conn.WriteJSON(event); err != nil {
+		klog.V(1).Infof("error writing to websocket: %v", err)
+		// the read loop returns once the connection is closed
+		c.conn.Close()
+	}
+}
+
+// ClearScreen clears the page of the browsers.
+func (u *WebUI) ClearScreen() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.cleared = len(u.events)
+	for client := range u.clients {
+		client.send(&Event{Block: -1, Type: "clear", Time: time.Now()})
+	}
+}
@@ -0,0 +1,162 @@
+// Package usage accounts for the tokens consumed by the LLM and estimates their cost.
+//
+// Prices are read from a YAML file, in US dollars per million tokens. The first model
+// pattern matching the model ID applies:
+//
+//	models:
+//	- model: "gpt-4o-mini*"
+//	  prompt: 0.15
+//	  completion: 0.60
+//	- model: "granite-*"
+//	  prompt: 0
+//	  completion: 0
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"k8s.io/client-go/util/homedir"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultPricesFile is the price table used if it exists and none is configured.
+var DefaultPricesFile = filepath.Join(homedir.HomeDir(), ".kubectl-interact", "prices.yaml")
+
+// Usage counts the tokens of one or more LLM calls.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+
+	// Calls is the number of LLM calls.
+	Calls int
+}
+
+// Total returns the number of prompt and completion tokens.
+func (u Usage) Total() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// Add adds the usage of other calls.
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.Calls += other.Calls
+}
+
+func (u Usage) String() string {
+	calls := "call"
+	if u.Calls != 1 {
+		calls = "calls"
+	}
+	return fmt.Sprintf("%d tokens (%d prompt, %d completion) in %d %s", u.Total(), u.PromptTokens, u.CompletionTokens, u.Calls, calls)
+}
+
+// FromMetadata reads the usage of a single LLM call from the usage metadata of a response,
+// as reported by OpenAI compatible APIs, Anthropic or Gemini. It returns false if there is none.
+func FromMetadata(metadata any) (Usage, bool) {
+	if metadata == nil {
+		return Usage{}, false
+	}
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return Usage{}, false
+	}
+	fields := map[string]any{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return Usage{}, false
+	}
+	count := func(names ...string) int {
+		for _, name := range names {
+			if n, ok := fields[name].(float64); ok {
+				return int(n)
+			}
+		}
+		return 0
+	}
+	u := Usage{
+		PromptTokens:     count("prompt_tokens", "input_tokens", "promptTokenCount"),
+		CompletionTokens: count("completion_tokens", "output_tokens", "candidatesTokenCount"),
+		Calls:            1,
+	}
+	if u.Total() == 0 {
+		return Usage{}, false
+	}
+	return u, true
+}
+
+// Price is the price of a model in US dollars per million tokens.
+type Price struct {
+	// Model is a glob pattern of model IDs.
+	Model      string  `json:"model"`
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// Prices is a table of model prices.
+type Prices struct {
+	Models []Price `json:"models,omitempty"`
+}
+
+// LoadPrices reads a price table from the given YAML file.
+func LoadPrices(filename string) (*Prices, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading price file: %w", err)
+	}
+	p := &Prices{}
+	if err := yaml.UnmarshalStrict(b, p); err != nil {
+		return nil, fmt.Errorf("parsing price file %q: %w", filename, err)
+	}
+	for i, price := range p.Models {
+		if _, err := path.Match(price.Model, ""); err != nil {
+			return nil, fmt.Errorf("price %d: invalid model pattern %q: %w", i, price.Model, err)
+		}
+		if price.Prompt < 0 || price.Completion < 0 {
+			return nil, fmt.Errorf("price %d (%s): prices must not be negative", i, price.Model)
+		}
+	}
+	return p, nil
+}
+
+// Cost estimates the cost of the usage in US dollars. It returns false if the model has no price.
+func (p *Prices) Cost(model string, u Usage) (float64, bool) {
+	if p == nil {
+		return 0, false
+	}
+	for _, price := range p.Models {
+		if ok, _ := path.Match(price.Model, model); ok {
+			return (float64(u.PromptTokens)*price.Prompt + float64(u.CompletionTokens)*price.Completion) / 1e6, true
+		}
+	}
+	return 0, false
+}
+
+// TotalCost estimates the cost of the usage of several models in US dollars. It returns false if a model which
+// used tokens has no price.
+func (p *Prices) TotalCost(byModel map[string]Usage) (float64, bool) {
+	if p == nil {
+		return 0, false
+	}
+	total := 0.0
+	for model, u := range byModel {
+		if u.Total() == 0 {
+			continue
+		}
+		cost, ok := p.Cost(model, u)
+		if !ok {
+			return 0, false
+		}
+		total += cost
+	}
+	return total, true
+}
+
+// EstimateTokens approximates the number of tokens of a text, for when the tokenizer of the model is
+// unknown. English text and YAML average about four characters per token.
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}